@@ -0,0 +1,253 @@
+package broadcast
+
+import (
+	"fmt"
+
+	"github.com/fintcloud/wechat/context"
+	"github.com/fintcloud/wechat/message"
+	"github.com/fintcloud/wechat/util"
+)
+
+const (
+	sendAllURL   = "https://api.weixin.qq.com/cgi-bin/message/mass/sendall?access_token=%s"
+	sendURL      = "https://api.weixin.qq.com/cgi-bin/message/mass/send?access_token=%s"
+	previewURL   = "https://api.weixin.qq.com/cgi-bin/message/mass/preview?access_token=%s"
+	getStatusURL = "https://api.weixin.qq.com/cgi-bin/message/mass/get?access_token=%s"
+	deleteURL    = "https://api.weixin.qq.com/cgi-bin/message/mass/delete?access_token=%s"
+	getSpeedURL  = "https://api.weixin.qq.com/cgi-bin/message/mass/speed/get?access_token=%s"
+	setSpeedURL  = "https://api.weixin.qq.com/cgi-bin/message/mass/speed/set?access_token=%s"
+)
+
+//Broadcast 群发消息
+type Broadcast struct {
+	*context.Context
+}
+
+//NewBroadcast 实例化
+func NewBroadcast(context *context.Context) *Broadcast {
+	broadcast := new(Broadcast)
+	broadcast.Context = context
+	return broadcast
+}
+
+//Message 群发的消息内容
+type Message struct {
+	MsgType           message.MsgType        `json:"msgtype"`
+	Text              *message.MediaText     `json:"text,omitempty"`
+	Image             *message.MediaResource `json:"image,omitempty"`
+	Voice             *message.MediaResource `json:"voice,omitempty"`
+	MpNews            *message.MediaResource `json:"mpnews,omitempty"`
+	MpVideo           *message.MediaResource `json:"mpvideo,omitempty"`
+	WxCard            *message.MediaWxcard   `json:"wxcard,omitempty"`
+	SendIgnoreReprint int                    `json:"send_ignore_reprint,omitempty"` //图文消息被判定为转载时，1为继续群发，0为停止群发
+	ClientMsgID       string                 `json:"clientmsgid,omitempty"`         //开发者侧群发msgid，长度限制64字节，24小时内相同的 clientmsgid 不会重复群发
+}
+
+//NewTextMessage 文本群发消息
+func NewTextMessage(content string) *Message {
+	return &Message{
+		MsgType: message.MsgTypeText,
+		Text:    &message.MediaText{Content: content},
+	}
+}
+
+//NewImageMessage 图片群发消息
+func NewImageMessage(mediaID string) *Message {
+	return &Message{
+		MsgType: message.MsgTypeImage,
+		Image:   &message.MediaResource{MediaID: mediaID},
+	}
+}
+
+//NewVoiceMessage 语音群发消息
+func NewVoiceMessage(mediaID string) *Message {
+	return &Message{
+		MsgType: message.MsgTypeVoice,
+		Voice:   &message.MediaResource{MediaID: mediaID},
+	}
+}
+
+//NewMpNewsMessage 图文群发消息，ignoreReprint 为 true 时图文被判定为转载也继续群发
+func NewMpNewsMessage(mediaID string, ignoreReprint bool) *Message {
+	msg := &Message{
+		MsgType: message.MsgTypeMpNews,
+		MpNews:  &message.MediaResource{MediaID: mediaID},
+	}
+	if ignoreReprint {
+		msg.SendIgnoreReprint = 1
+	}
+	return msg
+}
+
+//NewMpVideoMessage 视频群发消息，mediaID 需通过上传视频素材得到
+func NewMpVideoMessage(mediaID string) *Message {
+	return &Message{
+		MsgType: message.MsgTypeMpVideo,
+		MpVideo: &message.MediaResource{MediaID: mediaID},
+	}
+}
+
+//NewWxCardMessage 卡券群发消息
+func NewWxCardMessage(cardID string) *Message {
+	return &Message{
+		MsgType: message.MsgTypeWxCard,
+		WxCard:  &message.MediaWxcard{CardID: cardID},
+	}
+}
+
+//Filter 群发的接收者
+type Filter struct {
+	IsToAll bool `json:"is_to_all"`        //为 true 时发送给全部用户
+	TagID   int  `json:"tag_id,omitempty"` //IsToAll 为 false 时发送给该标签下的用户
+}
+
+type reqSendAll struct {
+	Filter *Filter `json:"filter"`
+	*Message
+}
+
+type reqSend struct {
+	ToUser []string `json:"touser"`
+	*Message
+}
+
+type reqPreview struct {
+	ToUser   string `json:"touser,omitempty"`
+	ToWxName string `json:"towxname,omitempty"`
+	*Message
+}
+
+//Result 群发接口返回结果
+type Result struct {
+	util.CommonError
+
+	MsgID     int64 `json:"msg_id"`      //消息发送任务的ID
+	MsgDataID int64 `json:"msg_data_id"` //消息的数据ID，仅在群发图文消息时返回
+}
+
+//SendAll 根据标签群发，tagID 为0时发送给全部用户
+func (broadcast *Broadcast) SendAll(tagID int, msg *Message) (*Result, error) {
+	filter := &Filter{IsToAll: tagID == 0, TagID: tagID}
+	return broadcast.post(sendAllURL, &reqSendAll{Filter: filter, Message: msg}, "BroadcastSendAll")
+}
+
+//Send 根据 openid 列表群发，至少2个，最多10000个
+func (broadcast *Broadcast) Send(openIDs []string, msg *Message) (*Result, error) {
+	if len(openIDs) < 2 || len(openIDs) > 10000 {
+		return nil, fmt.Errorf("broadcast send error : the number of openids must be between 2 and 10000, got %d", len(openIDs))
+	}
+	return broadcast.post(sendURL, &reqSend{ToUser: openIDs, Message: msg}, "BroadcastSend")
+}
+
+//Preview 预览接口，发送给指定 openid 查看效果，每日调用上限为100次
+func (broadcast *Broadcast) Preview(openID string, msg *Message) error {
+	_, err := broadcast.post(previewURL, &reqPreview{ToUser: openID, Message: msg}, "BroadcastPreview")
+	return err
+}
+
+//PreviewByWxName 预览接口，发送给指定微信号查看效果
+func (broadcast *Broadcast) PreviewByWxName(wxName string, msg *Message) error {
+	_, err := broadcast.post(previewURL, &reqPreview{ToWxName: wxName, Message: msg}, "BroadcastPreview")
+	return err
+}
+
+func (broadcast *Broadcast) post(urlStr string, req interface{}, apiName string) (res *Result, err error) {
+	var accessToken string
+	accessToken, err = broadcast.GetAccessToken()
+	if err != nil {
+		return
+	}
+	var response []byte
+	response, err = util.PostJSON(fmt.Sprintf(urlStr, accessToken), req)
+	if err != nil {
+		return
+	}
+	res = new(Result)
+	err = util.DecodeWithError(response, res, apiName)
+	return
+}
+
+//Status 群发消息的发送状态
+type Status struct {
+	util.CommonError
+
+	MsgID     int64  `json:"msg_id"`
+	MsgStatus string `json:"msg_status"` //SEND_SUCCESS 表示发送成功，SENDING 表示发送中，SEND_FAIL 表示发送失败，DELETE 表示已删除
+}
+
+type reqMsgID struct {
+	MsgID      int64  `json:"msg_id"`
+	ArticleIdx int    `json:"article_idx,omitempty"`
+	URL        string `json:"url,omitempty"`
+}
+
+//GetStatus 查询群发消息发送状态
+func (broadcast *Broadcast) GetStatus(msgID int64) (status *Status, err error) {
+	var accessToken string
+	accessToken, err = broadcast.GetAccessToken()
+	if err != nil {
+		return
+	}
+	var response []byte
+	response, err = util.PostJSON(fmt.Sprintf(getStatusURL, accessToken), &reqMsgID{MsgID: msgID})
+	if err != nil {
+		return
+	}
+	status = new(Status)
+	err = util.DecodeWithError(response, status, "BroadcastGetStatus")
+	return
+}
+
+//Delete 删除群发，只能删除图文和视频消息，articleIdx 为要删除的文章在图文消息中的位置，从1开始，为0时删除全部文章
+func (broadcast *Broadcast) Delete(msgID int64, articleIdx int) error {
+	accessToken, err := broadcast.GetAccessToken()
+	if err != nil {
+		return err
+	}
+	response, err := util.PostJSON(fmt.Sprintf(deleteURL, accessToken), &reqMsgID{MsgID: msgID, ArticleIdx: articleIdx})
+	if err != nil {
+		return err
+	}
+	return util.DecodeWithCommonError(response, "BroadcastDelete")
+}
+
+//Speed 群发速度
+type Speed struct {
+	util.CommonError
+
+	Speed     int `json:"speed"`     //群发速度的级别，0: 80w/分钟，1: 60w/分钟，2: 45w/分钟，3: 30w/分钟，4: 10w/分钟
+	RealSpeed int `json:"realspeed"` //群发速度的真实值，单位：万/分钟
+}
+
+//GetSpeed 获取群发速度
+func (broadcast *Broadcast) GetSpeed() (speed *Speed, err error) {
+	var accessToken string
+	accessToken, err = broadcast.GetAccessToken()
+	if err != nil {
+		return
+	}
+	var response []byte
+	response, err = util.PostJSON(fmt.Sprintf(getSpeedURL, accessToken), struct{}{})
+	if err != nil {
+		return
+	}
+	speed = new(Speed)
+	err = util.DecodeWithError(response, speed, "BroadcastGetSpeed")
+	return
+}
+
+//SetSpeed 设置群发速度，speed 为0到4的级别
+func (broadcast *Broadcast) SetSpeed(speed int) error {
+	if speed < 0 || speed > 4 {
+		return fmt.Errorf("broadcast set speed error : speed must be between 0 and 4, got %d", speed)
+	}
+	accessToken, err := broadcast.GetAccessToken()
+	if err != nil {
+		return err
+	}
+	response, err := util.PostJSON(fmt.Sprintf(setSpeedURL, accessToken), map[string]int{"speed": speed})
+	if err != nil {
+		return err
+	}
+	return util.DecodeWithCommonError(response, "BroadcastSetSpeed")
+}
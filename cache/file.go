@@ -0,0 +1,172 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+//File 基于本地文件的缓存，适用于单机部署，进程重启后缓存依然有效
+type File struct {
+	mu   sync.RWMutex
+	path string
+	data map[string]*data
+
+	stop chan struct{}
+	once sync.Once
+}
+
+//FileOpts 文件缓存属性
+type FileOpts struct {
+	Path            string        `yml:"path" json:"path"`                         //缓存文件路径
+	CompactInterval time.Duration `yml:"compact_interval" json:"compact_interval"` //清理过期数据的间隔，为0时不自动清理
+}
+
+//NewFile 实例化文件缓存，文件已存在时会载入其中未过期的数据
+func NewFile(opts *FileOpts) (*File, error) {
+	if opts.Path == "" {
+		return nil, fmt.Errorf("file cache path is empty")
+	}
+	f := &File{
+		path: opts.Path,
+		data: map[string]*data{},
+		stop: make(chan struct{}),
+	}
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	if opts.CompactInterval > 0 {
+		go f.compactLoop(opts.CompactInterval)
+	}
+	return f, nil
+}
+
+//Get 获取一个值
+func (f *File) Get(key string) interface{} {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if ret, ok := f.data[key]; ok && ret.Expired.After(time.Now()) {
+		return ret.Data
+	}
+	return nil
+}
+
+//IsExist 判断key是否存在
+func (f *File) IsExist(key string) bool {
+	return f.Get(key) != nil
+}
+
+//Set 设置一个值，并立即写入文件
+func (f *File) Set(key string, val interface{}, timeout time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.data[key] = &data{
+		Data:    val,
+		Expired: time.Now().Add(timeout),
+	}
+	return f.flush()
+}
+
+//Delete 删除
+func (f *File) Delete(key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.data[key]; !ok {
+		return nil
+	}
+	delete(f.data, key)
+	return f.flush()
+}
+
+//Compact 清理过期数据并重写文件
+func (f *File) Compact() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	for key, val := range f.data {
+		if !val.Expired.After(now) {
+			delete(f.data, key)
+		}
+	}
+	return f.flush()
+}
+
+//Close 停止自动清理
+func (f *File) Close() error {
+	f.once.Do(func() {
+		close(f.stop)
+	})
+	return nil
+}
+
+func (f *File) compactLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			f.Compact()
+		case <-f.stop:
+			return
+		}
+	}
+}
+
+//load 从文件中载入未过期的数据
+func (f *File) load() error {
+	content, err := ioutil.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read cache file error, path=%s, err=%v", f.path, err)
+	}
+	if len(content) == 0 {
+		return nil
+	}
+	stored := map[string]*data{}
+	if err = json.Unmarshal(content, &stored); err != nil {
+		return fmt.Errorf("decode cache file error, path=%s, err=%v", f.path, err)
+	}
+	now := time.Now()
+	for key, val := range stored {
+		if val != nil && val.Expired.After(now) {
+			f.data[key] = val
+		}
+	}
+	return nil
+}
+
+//flush 先写入临时文件再重命名，保证文件内容始终完整，调用方需持有写锁
+func (f *File) flush() error {
+	content, err := json.Marshal(f.data)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), filepath.Base(f.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = os.Rename(tmp.Name(), f.path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wechat-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := &FileOpts{
+		Path: filepath.Join(dir, "cache.json"),
+	}
+	file, err := NewFile(opts)
+	if err != nil {
+		t.Fatal("new file cache error", err)
+	}
+	timeoutDuration := 10 * time.Second
+	if err = file.Set("username", "fintcloud", timeoutDuration); err != nil {
+		t.Error("set Error", err)
+	}
+	if err = file.Set("expired", "fintcloud", -time.Second); err != nil {
+		t.Error("set Error", err)
+	}
+
+	if !file.IsExist("username") {
+		t.Error("IsExist Error")
+	}
+	if file.IsExist("expired") {
+		t.Error("expired key should not exist")
+	}
+
+	//重新载入文件
+	reloaded, err := NewFile(opts)
+	if err != nil {
+		t.Fatal("reload file cache error", err)
+	}
+	name, _ := reloaded.Get("username").(string)
+	if name != "fintcloud" {
+		t.Error("get Error")
+	}
+
+	if err = reloaded.Delete("username"); err != nil {
+		t.Errorf("delete Error , err=%v", err)
+	}
+	if reloaded.IsExist("username") {
+		t.Error("delete Error")
+	}
+	if err = reloaded.Compact(); err != nil {
+		t.Errorf("compact Error , err=%v", err)
+	}
+	if len(reloaded.data) != 0 {
+		t.Errorf("compact Error , remain=%d", len(reloaded.data))
+	}
+}
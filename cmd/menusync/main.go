@@ -0,0 +1,52 @@
+//menusync 将公众号菜单同步为配置文件中的内容，可在 CI 中使用
+//
+//	menusync -file menu.yaml -dry-run
+//	menusync -file menu.yaml -check    //有差异时退出码为2
+//	menusync -file menu.yaml
+//
+//appid 与 secret 可通过参数或环境变量 WECHAT_APPID、WECHAT_APPSECRET 传入
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/fintcloud/wechat"
+	"github.com/fintcloud/wechat/cache"
+	"github.com/fintcloud/wechat/menu"
+)
+
+func main() {
+	appID := flag.String("appid", os.Getenv("WECHAT_APPID"), "公众号 appid，默认读取环境变量 WECHAT_APPID")
+	appSecret := flag.String("secret", os.Getenv("WECHAT_APPSECRET"), "公众号 secret，默认读取环境变量 WECHAT_APPSECRET")
+	file := flag.String("file", "menu.yaml", "菜单配置文件，支持 yaml 和 json")
+	dryRun := flag.Bool("dry-run", false, "只输出变更，不修改线上菜单")
+	check := flag.Bool("check", false, "只输出变更，线上菜单与配置不一致时退出码为2")
+	flag.Parse()
+
+	if *appID == "" || *appSecret == "" {
+		fmt.Fprintln(os.Stderr, "appid and secret are required")
+		os.Exit(1)
+	}
+
+	spec, err := menu.LoadSpec(*file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	wc := wechat.NewWechat(&wechat.Config{
+		AppID:     *appID,
+		AppSecret: *appSecret,
+		Cache:     cache.NewMemory(),
+	})
+	plan, err := wc.GetMenu().Sync(spec, os.Stdout, *dryRun || *check)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *check && plan.HasChanges() {
+		os.Exit(2)
+	}
+}
@@ -83,3 +83,28 @@ func (ctx *Context) GetAccessTokenFromServer() (resAccessToken ResAccessToken, e
 	err = ctx.Cache.Set(accessTokenCacheKey, resAccessToken.AccessToken, time.Duration(expires)*time.Second)
 	return
 }
+
+//RefreshAccessToken access_token 失效（如 40001、42001）时调用，stale 为失效的 access_token
+//
+//与 GetAccessToken 共用读写锁，缓存中的 access_token 已被其他调用方刷新时直接返回，避免并发重复刷新；
+//设置了 GetAccessTokenFunc 时交由自定义方法处理
+func (ctx *Context) RefreshAccessToken(stale string) (accessToken string, err error) {
+	ctx.accessTokenLock.Lock()
+	defer ctx.accessTokenLock.Unlock()
+
+	if ctx.accessTokenFunc != nil {
+		return ctx.accessTokenFunc(ctx)
+	}
+	accessTokenCacheKey := fmt.Sprintf("access_token_%s", ctx.AppID)
+	if val, ok := ctx.Cache.Get(accessTokenCacheKey).(string); ok && val != "" && val != stale {
+		return val, nil
+	}
+
+	var resAccessToken ResAccessToken
+	resAccessToken, err = ctx.GetAccessTokenFromServer()
+	if err != nil {
+		return
+	}
+	accessToken = resAccessToken.AccessToken
+	return
+}
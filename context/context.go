@@ -5,6 +5,7 @@ import (
 	"sync"
 
 	"github.com/fintcloud/wechat/cache"
+	"github.com/fintcloud/wechat/util"
 )
 
 // Context struct
@@ -17,6 +18,10 @@ type Context struct {
 	PayNotifyURL   string
 	PayKey         string
 
+	PayAPIv3Key     string //支付 v3 - APIv3 密钥，用于解密平台证书和回调通知
+	PayCertSerialNo string //支付 v3 - 商户 API 证书序列号
+	PayPrivateKey   string //支付 v3 - 商户 API 私钥，PEM 格式
+
 	Cache cache.Cache
 
 	Writer  http.ResponseWriter
@@ -30,6 +35,12 @@ type Context struct {
 
 	//accessTokenFunc 自定义获取 access token 的方法
 	accessTokenFunc GetAccessTokenFunc
+
+	//payTLSClient 使用商户 API 证书的 http.Client，同一个商户一个
+	payTLSClient *util.TLSClient
+
+	//payV3Client 微信支付 v3 客户端，同一个商户一个
+	payV3Client interface{}
 }
 
 // Query returns the keyed url query value if it exists
@@ -56,3 +67,23 @@ func (ctx *Context) SetJsAPITicketLock(lock *sync.RWMutex) {
 func (ctx *Context) GetJsAPITicketLock() *sync.RWMutex {
 	return ctx.jsAPITicketLock
 }
+
+// SetPayTLSClient 设置使用商户 API 证书的 http.Client
+func (ctx *Context) SetPayTLSClient(client *util.TLSClient) {
+	ctx.payTLSClient = client
+}
+
+// GetPayTLSClient 获取使用商户 API 证书的 http.Client
+func (ctx *Context) GetPayTLSClient() *util.TLSClient {
+	return ctx.payTLSClient
+}
+
+// SetPayV3Client 设置微信支付 v3 客户端，值为 *pay.V3Client，这里不能引用 pay 包
+func (ctx *Context) SetPayV3Client(client interface{}) {
+	ctx.payV3Client = client
+}
+
+// GetPayV3Client 获取微信支付 v3 客户端
+func (ctx *Context) GetPayV3Client() interface{} {
+	return ctx.payV3Client
+}
@@ -0,0 +1,171 @@
+package draft
+
+import (
+	"fmt"
+
+	"github.com/fintcloud/wechat/context"
+	"github.com/fintcloud/wechat/util"
+)
+
+const (
+	addURL      = "https://api.weixin.qq.com/cgi-bin/draft/add?access_token=%s"
+	updateURL   = "https://api.weixin.qq.com/cgi-bin/draft/update?access_token=%s"
+	getURL      = "https://api.weixin.qq.com/cgi-bin/draft/get?access_token=%s"
+	batchGetURL = "https://api.weixin.qq.com/cgi-bin/draft/batchget?access_token=%s"
+	countURL    = "https://api.weixin.qq.com/cgi-bin/draft/count?access_token=%s"
+	deleteURL   = "https://api.weixin.qq.com/cgi-bin/draft/delete?access_token=%s"
+)
+
+//Draft 草稿箱
+type Draft struct {
+	*context.Context
+}
+
+//NewDraft 实例化
+func NewDraft(context *context.Context) *Draft {
+	draft := new(Draft)
+	draft.Context = context
+	return draft
+}
+
+//Article 草稿箱中的图文，字段与 material.Article 一致，增加了评论相关的设置
+type Article struct {
+	Title              string `json:"title"`
+	ThumbMediaID       string `json:"thumb_media_id"` //封面图片素材id，必须是永久素材
+	Author             string `json:"author,omitempty"`
+	Digest             string `json:"digest,omitempty"` //仅单图文有摘要，多图文此处为空，不填时默认抓取正文前54个字
+	ShowCoverPic       int    `json:"show_cover_pic"`
+	Content            string `json:"content"` //图片url必须来源于 material.ImageUpload
+	ContentSourceURL   string `json:"content_source_url,omitempty"`
+	NeedOpenComment    int    `json:"need_open_comment"`     //是否打开评论，0不打开，1打开
+	OnlyFansCanComment int    `json:"only_fans_can_comment"` //是否粉丝才可评论，0所有人可评论，1粉丝才可评论
+	URL                string `json:"url,omitempty"`         //草稿的临时链接，仅查询时返回
+	ThumbURL           string `json:"thumb_url,omitempty"`   //封面图片url，仅查询时返回
+	IsDeleted          bool   `json:"is_deleted,omitempty"`  //文章是否已被删除，仅查询已发布文章时返回
+}
+
+type reqAdd struct {
+	Articles []*Article `json:"articles"`
+}
+
+type reqMediaID struct {
+	MediaID string `json:"media_id"`
+}
+
+type reqUpdate struct {
+	MediaID  string   `json:"media_id"`
+	Index    int      `json:"index"`
+	Articles *Article `json:"articles"`
+}
+
+type resMediaID struct {
+	util.CommonError
+
+	MediaID string `json:"media_id"`
+}
+
+type resNewsItem struct {
+	util.CommonError
+
+	NewsItem []*Article `json:"news_item"`
+}
+
+//Add 新建草稿，返回草稿的 media_id
+func (draft *Draft) Add(articles []*Article) (mediaID string, err error) {
+	var res resMediaID
+	if err = draft.post(addURL, &reqAdd{Articles: articles}, &res, "AddDraft"); err != nil {
+		return
+	}
+	mediaID = res.MediaID
+	return
+}
+
+//Update 修改草稿中的一篇图文，index 为文章在图文消息中的位置，第一篇为0
+func (draft *Draft) Update(mediaID string, index int, article *Article) error {
+	var res struct{ util.CommonError }
+	return draft.post(updateURL, &reqUpdate{MediaID: mediaID, Index: index, Articles: article}, &res, "UpdateDraft")
+}
+
+//Get 获取草稿中的图文
+func (draft *Draft) Get(mediaID string) ([]*Article, error) {
+	var res resNewsItem
+	if err := draft.post(getURL, &reqMediaID{MediaID: mediaID}, &res, "GetDraft"); err != nil {
+		return nil, err
+	}
+	return res.NewsItem, nil
+}
+
+//Delete 删除草稿
+func (draft *Draft) Delete(mediaID string) error {
+	var res struct{ util.CommonError }
+	return draft.post(deleteURL, &reqMediaID{MediaID: mediaID}, &res, "DeleteDraft")
+}
+
+//Count 获取草稿总数
+func (draft *Draft) Count() (total int64, err error) {
+	var res struct {
+		util.CommonError
+
+		TotalCount int64 `json:"total_count"`
+	}
+	if err = draft.post(countURL, nil, &res, "CountDraft"); err != nil {
+		return
+	}
+	total = res.TotalCount
+	return
+}
+
+//Item 草稿列表中的一条草稿
+type Item struct {
+	MediaID string `json:"media_id"`
+	Content struct {
+		NewsItem []*Article `json:"news_item"`
+	} `json:"content"`
+	UpdateTime int64 `json:"update_time"`
+}
+
+//List 草稿列表
+type List struct {
+	util.CommonError
+
+	TotalCount int64   `json:"total_count"`
+	ItemCount  int64   `json:"item_count"`
+	Item       []*Item `json:"item"`
+}
+
+type reqBatchGet struct {
+	Offset    int `json:"offset"`
+	Count     int `json:"count"`
+	NoContent int `json:"no_content"`
+}
+
+//BatchGet 获取草稿列表，count 取值在1到20之间，noContent 为 true 时不返回 content 字段
+func (draft *Draft) BatchGet(offset, count int, noContent bool) (*List, error) {
+	req := &reqBatchGet{Offset: offset, Count: count}
+	if noContent {
+		req.NoContent = 1
+	}
+	list := new(List)
+	if err := draft.post(batchGetURL, req, list, "BatchGetDraft"); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+//post 发送 json 请求，req 为 nil 时发送 get 请求
+func (draft *Draft) post(urlStr string, req, res interface{}, apiName string) error {
+	accessToken, err := draft.GetAccessToken()
+	if err != nil {
+		return err
+	}
+	var response []byte
+	if req == nil {
+		response, err = util.HTTPGet(fmt.Sprintf(urlStr, accessToken))
+	} else {
+		response, err = util.PostJSON(fmt.Sprintf(urlStr, accessToken), req)
+	}
+	if err != nil {
+		return err
+	}
+	return util.DecodeWithError(response, res, apiName)
+}
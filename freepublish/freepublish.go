@@ -0,0 +1,206 @@
+package freepublish
+
+import (
+	icontext "context"
+	"fmt"
+	"time"
+
+	"github.com/fintcloud/wechat/context"
+	"github.com/fintcloud/wechat/draft"
+	"github.com/fintcloud/wechat/util"
+)
+
+const (
+	submitURL     = "https://api.weixin.qq.com/cgi-bin/freepublish/submit?access_token=%s"
+	getURL        = "https://api.weixin.qq.com/cgi-bin/freepublish/get?access_token=%s"
+	deleteURL     = "https://api.weixin.qq.com/cgi-bin/freepublish/delete?access_token=%s"
+	getArticleURL = "https://api.weixin.qq.com/cgi-bin/freepublish/getarticle?access_token=%s"
+	batchGetURL   = "https://api.weixin.qq.com/cgi-bin/freepublish/batchget?access_token=%s"
+)
+
+//Status 发布状态
+type Status int
+
+const (
+	//StatusSuccess 发布成功
+	StatusSuccess Status = 0
+	//StatusPublishing 发布中
+	StatusPublishing Status = 1
+	//StatusOriginalFailed 原创声明失败
+	StatusOriginalFailed Status = 2
+	//StatusFailed 常规失败
+	StatusFailed Status = 3
+	//StatusAuditRejected 平台审核不通过
+	StatusAuditRejected Status = 4
+	//StatusDeleted 发布成功后用户删除了所有文章
+	StatusDeleted Status = 5
+	//StatusBanned 发布成功后文章被系统封禁
+	StatusBanned Status = 6
+)
+
+//FreePublish 发布能力，发布后的图文不会推送给用户，也不会展示在公众号主页中
+type FreePublish struct {
+	*context.Context
+}
+
+//NewFreePublish 实例化
+func NewFreePublish(context *context.Context) *FreePublish {
+	freePublish := new(FreePublish)
+	freePublish.Context = context
+	return freePublish
+}
+
+//SubmitResult 发布任务提交结果
+type SubmitResult struct {
+	util.CommonError
+
+	PublishID string `json:"publish_id"`
+	MsgDataID int64  `json:"msg_data_id"`
+}
+
+//Submit 将草稿提交发布，发布结果通过 PUBLISHJOBFINISH 事件推送，也可以使用 Get 或 WaitPublish 查询
+func (freePublish *FreePublish) Submit(mediaID string) (*SubmitResult, error) {
+	var req struct {
+		MediaID string `json:"media_id"`
+	}
+	req.MediaID = mediaID
+	res := new(SubmitResult)
+	if err := freePublish.post(submitURL, &req, res, "SubmitFreePublish"); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+//ArticleDetail 发布成功的文章链接
+type ArticleDetail struct {
+	Count int `json:"count"`
+	Item  []struct {
+		Idx        int    `json:"idx"`
+		ArticleURL string `json:"article_url"`
+	} `json:"item"`
+}
+
+//PublishStatus 发布状态
+type PublishStatus struct {
+	util.CommonError
+
+	PublishID     string         `json:"publish_id"`
+	PublishStatus Status         `json:"publish_status"`
+	ArticleID     string         `json:"article_id"`     //发布成功时返回，用于 GetArticle 和 Delete
+	ArticleDetail *ArticleDetail `json:"article_detail"` //发布成功时返回
+	FailIdx       []int          `json:"fail_idx"`       //发布失败的文章编号，从1开始
+}
+
+//Get 查询发布状态
+func (freePublish *FreePublish) Get(publishID string) (*PublishStatus, error) {
+	var req struct {
+		PublishID string `json:"publish_id"`
+	}
+	req.PublishID = publishID
+	status := new(PublishStatus)
+	if err := freePublish.post(getURL, &req, status, "GetFreePublish"); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+//WaitPublish 每隔 interval 查询一次发布状态，直到不再是发布中或 ctx 结束，interval 小于等于0时为5秒
+func (freePublish *FreePublish) WaitPublish(ctx icontext.Context, publishID string, interval time.Duration) (*PublishStatus, error) {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		status, err := freePublish.Get(publishID)
+		if err != nil {
+			return nil, err
+		}
+		if status.PublishStatus != StatusPublishing {
+			return status, nil
+		}
+		select {
+		case <-ctx.Done():
+			return status, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+//Delete 删除已发布的文章，index 为要删除的文章编号，从1开始，为0时删除全部文章
+func (freePublish *FreePublish) Delete(articleID string, index int) error {
+	var req struct {
+		ArticleID string `json:"article_id"`
+		Index     int    `json:"index,omitempty"`
+	}
+	req.ArticleID = articleID
+	req.Index = index
+	var res struct{ util.CommonError }
+	return freePublish.post(deleteURL, &req, &res, "DeleteFreePublish")
+}
+
+//GetArticle 获取已发布的图文
+func (freePublish *FreePublish) GetArticle(articleID string) ([]*draft.Article, error) {
+	var req struct {
+		ArticleID string `json:"article_id"`
+	}
+	req.ArticleID = articleID
+	var res struct {
+		util.CommonError
+
+		NewsItem []*draft.Article `json:"news_item"`
+	}
+	if err := freePublish.post(getArticleURL, &req, &res, "GetFreePublishArticle"); err != nil {
+		return nil, err
+	}
+	return res.NewsItem, nil
+}
+
+//Item 已发布文章列表中的一条
+type Item struct {
+	ArticleID string `json:"article_id"`
+	Content   struct {
+		NewsItem []*draft.Article `json:"news_item"`
+	} `json:"content"`
+	UpdateTime int64 `json:"update_time"`
+}
+
+//List 已发布文章列表
+type List struct {
+	util.CommonError
+
+	TotalCount int64   `json:"total_count"`
+	ItemCount  int64   `json:"item_count"`
+	Item       []*Item `json:"item"`
+}
+
+//BatchGet 获取已发布成功的文章列表，count 取值在1到20之间，noContent 为 true 时不返回 content 字段
+func (freePublish *FreePublish) BatchGet(offset, count int, noContent bool) (*List, error) {
+	var req struct {
+		Offset    int `json:"offset"`
+		Count     int `json:"count"`
+		NoContent int `json:"no_content"`
+	}
+	req.Offset = offset
+	req.Count = count
+	if noContent {
+		req.NoContent = 1
+	}
+	list := new(List)
+	if err := freePublish.post(batchGetURL, &req, list, "BatchGetFreePublish"); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (freePublish *FreePublish) post(urlStr string, req, res interface{}, apiName string) error {
+	accessToken, err := freePublish.GetAccessToken()
+	if err != nil {
+		return err
+	}
+	response, err := util.PostJSON(fmt.Sprintf(urlStr, accessToken), req)
+	if err != nil {
+		return err
+	}
+	return util.DecodeWithError(response, res, apiName)
+}
@@ -0,0 +1,171 @@
+package kf
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/fintcloud/wechat/context"
+	"github.com/fintcloud/wechat/util"
+)
+
+const (
+	kfListURL          = "https://api.weixin.qq.com/cgi-bin/customservice/getkflist?access_token=%s"
+	kfOnlineListURL    = "https://api.weixin.qq.com/cgi-bin/customservice/getonlinekflist?access_token=%s"
+	kfAccountAddURL    = "https://api.weixin.qq.com/customservice/kfaccount/add?access_token=%s"
+	kfAccountUpdateURL = "https://api.weixin.qq.com/customservice/kfaccount/update?access_token=%s"
+	kfAccountDelURL    = "https://api.weixin.qq.com/customservice/kfaccount/del?access_token=%s&kf_account=%s"
+	kfInviteWorkerURL  = "https://api.weixin.qq.com/customservice/kfaccount/inviteworker?access_token=%s"
+	kfUploadHeadImgURL = "https://api.weixin.qq.com/customservice/kfaccount/uploadheadimg?access_token=%s&kf_account=%s"
+)
+
+//Kf 客服管理
+type Kf struct {
+	*context.Context
+}
+
+//NewKf 实例化
+func NewKf(context *context.Context) *Kf {
+	kf := new(Kf)
+	kf.Context = context
+	return kf
+}
+
+//AccountInfo 客服基本信息
+type AccountInfo struct {
+	KfAccount        string `json:"kf_account"`         //完整客服帐号，格式为：帐号前缀@公众号微信号
+	KfNick           string `json:"kf_nick"`            //客服昵称
+	KfID             string `json:"kf_id"`              //客服编号
+	KfHeadImgURL     string `json:"kf_headimgurl"`      //客服头像
+	KfWX             string `json:"kf_wx"`              //如果客服帐号已绑定了客服人员微信号，则此处显示微信号
+	InviteWX         string `json:"invite_wx"`          //如果客服帐号尚未绑定微信号，但是已经发起了一个绑定邀请，则此处显示绑定邀请的微信号
+	InviteExpireTime int64  `json:"invite_expire_time"` //如果客服帐号尚未绑定微信号，但是已经发起过一个绑定邀请，邀请的过期时间，为unix 时间戳
+	InviteStatus     string `json:"invite_status"`      //邀请的状态，有等待确认“waiting”，被拒绝“rejected”，过期“expired”
+}
+
+//OnlineAccountInfo 在线客服信息
+type OnlineAccountInfo struct {
+	KfAccount    string `json:"kf_account"`    //完整客服帐号
+	Status       int    `json:"status"`        //客服在线状态，目前为：1、web 在线
+	KfID         string `json:"kf_id"`         //客服编号
+	AcceptedCase int    `json:"accepted_case"` //客服当前正在接待的会话数
+}
+
+type resKfList struct {
+	util.CommonError
+
+	KfList []*AccountInfo `json:"kf_list"`
+}
+
+type resKfOnlineList struct {
+	util.CommonError
+
+	KfOnlineList []*OnlineAccountInfo `json:"kf_online_list"`
+}
+
+type reqKfAccount struct {
+	KfAccount string `json:"kf_account"`
+	Nickname  string `json:"nickname,omitempty"`
+	InviteWX  string `json:"invite_wx,omitempty"`
+}
+
+//GetKfList 获取所有客服基本信息
+func (kf *Kf) GetKfList() (list []*AccountInfo, err error) {
+	var accessToken string
+	accessToken, err = kf.GetAccessToken()
+	if err != nil {
+		return
+	}
+
+	var response []byte
+	response, err = util.HTTPGet(fmt.Sprintf(kfListURL, accessToken))
+	if err != nil {
+		return
+	}
+	var res resKfList
+	err = util.DecodeWithError(response, &res, "GetKfList")
+	if err != nil {
+		return
+	}
+	list = res.KfList
+	return
+}
+
+//GetOnlineKfList 获取在线客服信息
+func (kf *Kf) GetOnlineKfList() (list []*OnlineAccountInfo, err error) {
+	var accessToken string
+	accessToken, err = kf.GetAccessToken()
+	if err != nil {
+		return
+	}
+
+	var response []byte
+	response, err = util.HTTPGet(fmt.Sprintf(kfOnlineListURL, accessToken))
+	if err != nil {
+		return
+	}
+	var res resKfOnlineList
+	err = util.DecodeWithError(response, &res, "GetOnlineKfList")
+	if err != nil {
+		return
+	}
+	list = res.KfOnlineList
+	return
+}
+
+//AddAccount 添加客服帐号，kfAccount 格式为：帐号前缀@公众号微信号
+func (kf *Kf) AddAccount(kfAccount, nickname string) error {
+	return kf.postAccount(kfAccountAddURL, &reqKfAccount{KfAccount: kfAccount, Nickname: nickname}, "AddAccount")
+}
+
+//UpdateAccount 设置客服信息
+func (kf *Kf) UpdateAccount(kfAccount, nickname string) error {
+	return kf.postAccount(kfAccountUpdateURL, &reqKfAccount{KfAccount: kfAccount, Nickname: nickname}, "UpdateAccount")
+}
+
+//InviteWorker 邀请绑定客服帐号，inviteWX 为接收绑定邀请的客服微信号
+func (kf *Kf) InviteWorker(kfAccount, inviteWX string) error {
+	return kf.postAccount(kfInviteWorkerURL, &reqKfAccount{KfAccount: kfAccount, InviteWX: inviteWX}, "InviteWorker")
+}
+
+//DeleteAccount 删除客服帐号
+func (kf *Kf) DeleteAccount(kfAccount string) error {
+	accessToken, err := kf.GetAccessToken()
+	if err != nil {
+		return err
+	}
+
+	uri := fmt.Sprintf(kfAccountDelURL, accessToken, url.QueryEscape(kfAccount))
+	response, err := util.HTTPGet(uri)
+	if err != nil {
+		return err
+	}
+	return util.DecodeWithCommonError(response, "DeleteAccount")
+}
+
+//UploadHeadImg 上传客服头像，头像图片文件必须是jpg格式，推荐使用640*640大小的图片
+func (kf *Kf) UploadHeadImg(kfAccount, filename string) error {
+	accessToken, err := kf.GetAccessToken()
+	if err != nil {
+		return err
+	}
+
+	uri := fmt.Sprintf(kfUploadHeadImgURL, accessToken, url.QueryEscape(kfAccount))
+	response, err := util.PostFile("media", filename, uri)
+	if err != nil {
+		return err
+	}
+	return util.DecodeWithCommonError(response, "UploadHeadImg")
+}
+
+func (kf *Kf) postAccount(urlStr string, req *reqKfAccount, apiName string) error {
+	accessToken, err := kf.GetAccessToken()
+	if err != nil {
+		return err
+	}
+
+	response, err := util.PostJSON(fmt.Sprintf(urlStr, accessToken), req)
+	if err != nil {
+		return err
+	}
+	return util.DecodeWithCommonError(response, apiName)
+}
@@ -0,0 +1,201 @@
+package kf
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/fintcloud/wechat/util"
+)
+
+const (
+	kfSessionCreateURL  = "https://api.weixin.qq.com/customservice/kfsession/create?access_token=%s"
+	kfSessionCloseURL   = "https://api.weixin.qq.com/customservice/kfsession/close?access_token=%s"
+	kfSessionGetURL     = "https://api.weixin.qq.com/customservice/kfsession/getsession?access_token=%s&openid=%s"
+	kfSessionListURL    = "https://api.weixin.qq.com/customservice/kfsession/getsessionlist?access_token=%s&kf_account=%s"
+	kfSessionWaitURL    = "https://api.weixin.qq.com/customservice/kfsession/getwaitcase?access_token=%s"
+	kfMsgRecordListURL  = "https://api.weixin.qq.com/customservice/msgrecord/getmsglist?access_token=%s"
+	maxMsgRecordNumber  = 10000
+	maxMsgRecordSeconds = 24 * 60 * 60
+)
+
+//Session 客服会话
+type Session struct {
+	KfAccount  string `json:"kf_account,omitempty"` //正在接待的客服，为空表示没有人在接待
+	OpenID     string `json:"openid,omitempty"`     //客户openid
+	CreateTime int64  `json:"createtime"`           //会话接入的时间
+}
+
+//WaitCase 未接入会话
+type WaitCase struct {
+	LatestTime int64  `json:"latest_time"` //粉丝的最后一条消息的时间
+	OpenID     string `json:"openid"`      //粉丝的openid
+}
+
+//ResWaitCase 未接入会话列表
+type ResWaitCase struct {
+	util.CommonError
+
+	Count        int         `json:"count"`        //未接入会话数量
+	WaitCaseList []*WaitCase `json:"waitcaselist"` //未接入会话列表，最多返回100条数据，按照来访顺序
+}
+
+type resSession struct {
+	util.CommonError
+	Session
+}
+
+type resSessionList struct {
+	util.CommonError
+
+	SessionList []*Session `json:"sessionlist"`
+}
+
+type reqSession struct {
+	KfAccount string `json:"kf_account"`
+	OpenID    string `json:"openid"`
+}
+
+//CreateSession 创建会话，kfAccount 必须是已在线的客服
+func (kf *Kf) CreateSession(kfAccount, openID string) error {
+	return kf.postSession(kfSessionCreateURL, kfAccount, openID, "CreateSession")
+}
+
+//CloseSession 关闭会话
+func (kf *Kf) CloseSession(kfAccount, openID string) error {
+	return kf.postSession(kfSessionCloseURL, kfAccount, openID, "CloseSession")
+}
+
+//GetSession 获取客户会话状态
+func (kf *Kf) GetSession(openID string) (session *Session, err error) {
+	var accessToken string
+	accessToken, err = kf.GetAccessToken()
+	if err != nil {
+		return
+	}
+
+	var response []byte
+	response, err = util.HTTPGet(fmt.Sprintf(kfSessionGetURL, accessToken, url.QueryEscape(openID)))
+	if err != nil {
+		return
+	}
+	var res resSession
+	err = util.DecodeWithError(response, &res, "GetSession")
+	if err != nil {
+		return
+	}
+	session = &res.Session
+	session.OpenID = openID
+	return
+}
+
+//GetSessionList 获取客服会话列表
+func (kf *Kf) GetSessionList(kfAccount string) (list []*Session, err error) {
+	var accessToken string
+	accessToken, err = kf.GetAccessToken()
+	if err != nil {
+		return
+	}
+
+	var response []byte
+	response, err = util.HTTPGet(fmt.Sprintf(kfSessionListURL, accessToken, url.QueryEscape(kfAccount)))
+	if err != nil {
+		return
+	}
+	var res resSessionList
+	err = util.DecodeWithError(response, &res, "GetSessionList")
+	if err != nil {
+		return
+	}
+	for _, session := range res.SessionList {
+		session.KfAccount = kfAccount
+	}
+	list = res.SessionList
+	return
+}
+
+//GetWaitCase 获取未接入会话列表
+func (kf *Kf) GetWaitCase() (res *ResWaitCase, err error) {
+	var accessToken string
+	accessToken, err = kf.GetAccessToken()
+	if err != nil {
+		return
+	}
+
+	var response []byte
+	response, err = util.HTTPGet(fmt.Sprintf(kfSessionWaitURL, accessToken))
+	if err != nil {
+		return
+	}
+	res = new(ResWaitCase)
+	err = util.DecodeWithError(response, res, "GetWaitCase")
+	return
+}
+
+func (kf *Kf) postSession(urlStr, kfAccount, openID, apiName string) error {
+	accessToken, err := kf.GetAccessToken()
+	if err != nil {
+		return err
+	}
+
+	response, err := util.PostJSON(fmt.Sprintf(urlStr, accessToken), &reqSession{KfAccount: kfAccount, OpenID: openID})
+	if err != nil {
+		return err
+	}
+	return util.DecodeWithCommonError(response, apiName)
+}
+
+//MsgRecord 聊天记录
+type MsgRecord struct {
+	Worker   string `json:"worker"`   //完整客服帐号
+	OpenID   string `json:"openid"`   //用户标识
+	OperCode int    `json:"opercode"` //操作码，2002（客服发送信息），2003（客服接收消息）
+	Text     string `json:"text"`     //聊天记录
+	Time     int64  `json:"time"`     //操作时间，unix时间戳
+}
+
+//ResMsgRecordList 聊天记录列表
+type ResMsgRecordList struct {
+	util.CommonError
+
+	RecordList []*MsgRecord `json:"recordlist"`
+	Number     int          `json:"number"` //本次返回的记录数
+	MsgID      int64        `json:"msgid"`  //下一次调用时传入的msgid
+}
+
+type reqMsgRecordList struct {
+	StartTime int64 `json:"starttime"`
+	EndTime   int64 `json:"endtime"`
+	MsgID     int64 `json:"msgid"`
+	Number    int   `json:"number"`
+}
+
+//GetMsgList 获取聊天记录，起止时间间隔不能超过24小时，msgID 首次传1，之后传上次返回的 MsgID，number 最多10000
+func (kf *Kf) GetMsgList(startTime, endTime, msgID int64, number int) (res *ResMsgRecordList, err error) {
+	if endTime-startTime > maxMsgRecordSeconds {
+		err = fmt.Errorf("GetMsgList Error , the interval between starttime and endtime must be within 24 hours")
+		return
+	}
+	if number <= 0 || number > maxMsgRecordNumber {
+		number = maxMsgRecordNumber
+	}
+	var accessToken string
+	accessToken, err = kf.GetAccessToken()
+	if err != nil {
+		return
+	}
+
+	req := &reqMsgRecordList{
+		StartTime: startTime,
+		EndTime:   endTime,
+		MsgID:     msgID,
+		Number:    number,
+	}
+	var response []byte
+	response, err = util.PostJSON(fmt.Sprintf(kfMsgRecordListURL, accessToken), req)
+	if err != nil {
+		return
+	}
+	res = new(ResMsgRecordList)
+	err = util.DecodeWithError(response, res, "GetMsgList")
+	return
+}
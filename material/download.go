@@ -0,0 +1,162 @@
+package material
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/fintcloud/wechat/util"
+)
+
+const (
+	mediaGetJssdkURL = "https://api.weixin.qq.com/cgi-bin/media/get/jssdk"
+
+	//maxJSONResponseSize 返回 json 时最多读取的长度，避免误将大文件读入内存
+	maxJSONResponseSize = 1 << 20
+)
+
+//Video 永久视频素材信息
+type Video struct {
+	util.CommonError
+
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	DownURL     string `json:"down_url"`
+}
+
+//DownloadMaterial 下载永久图片、语音或缩略图素材并写入 w，返回写入的字节数
+//
+//视频和图文素材返回的是 json，请分别使用 GetVideo 和 GetNews
+func (material *Material) DownloadMaterial(mediaID string, w io.Writer) (int64, error) {
+	n, jsonBody, err := material.downloadMaterial(mediaID, w)
+	if err != nil || jsonBody == nil {
+		return n, err
+	}
+	return 0, fmt.Errorf("DownloadMaterial error : media %s is not a binary material, use GetVideo or GetNews", mediaID)
+}
+
+//GetVideo 获取永久视频素材的标题、描述和下载地址
+func (material *Material) GetVideo(mediaID string) (*Video, error) {
+	_, jsonBody, err := material.downloadMaterial(mediaID, ioutil.Discard)
+	if err != nil {
+		return nil, err
+	}
+	if jsonBody == nil {
+		return nil, fmt.Errorf("GetVideo error : media %s is not a video material", mediaID)
+	}
+	video := new(Video)
+	err = util.DecodeWithError(jsonBody, video, "GetVideo")
+	return video, err
+}
+
+func (material *Material) downloadMaterial(mediaID string, w io.Writer) (n int64, jsonBody []byte, err error) {
+	accessToken, err := material.GetAccessToken()
+	if err != nil {
+		return
+	}
+	uri := fmt.Sprintf("%s?access_token=%s", getMaterialURL, accessToken)
+	var reqGet struct {
+		MediaID string `json:"media_id"`
+	}
+	reqGet.MediaID = mediaID
+	data, err := json.Marshal(reqGet)
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, uri, bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json;charset=utf-8")
+	return download(req, w, "GetMaterial")
+}
+
+//DownloadMedia 下载临时素材并写入 w，返回写入的字节数，视频素材会从返回的 video_url 继续下载
+func (material *Material) DownloadMedia(mediaID string, w io.Writer) (int64, error) {
+	n, jsonBody, err := material.downloadMedia(mediaGetURL, mediaID, w, "DownloadMedia")
+	if err != nil || jsonBody == nil {
+		return n, err
+	}
+
+	var res struct {
+		util.CommonError
+
+		VideoURL string `json:"video_url"`
+	}
+	if err = util.DecodeWithError(jsonBody, &res, "DownloadMedia"); err != nil {
+		return 0, err
+	}
+	if res.VideoURL == "" {
+		return 0, fmt.Errorf("DownloadMedia error : unexpected response %s", jsonBody)
+	}
+	response, err := http.Get(res.VideoURL)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("http get error : uri=%v , statusCode=%v", res.VideoURL, response.StatusCode)
+	}
+	return io.Copy(w, response.Body)
+}
+
+//DownloadHDVoice 下载 JSSDK uploadVoice 上传的高清语音素材（speex 格式）并写入 w，返回写入的字节数
+func (material *Material) DownloadHDVoice(mediaID string, w io.Writer) (int64, error) {
+	n, jsonBody, err := material.downloadMedia(mediaGetJssdkURL, mediaID, w, "DownloadHDVoice")
+	if err != nil || jsonBody == nil {
+		return n, err
+	}
+	return 0, fmt.Errorf("DownloadHDVoice error : unexpected response %s", jsonBody)
+}
+
+func (material *Material) downloadMedia(urlStr, mediaID string, w io.Writer, apiName string) (n int64, jsonBody []byte, err error) {
+	accessToken, err := material.GetAccessToken()
+	if err != nil {
+		return
+	}
+	uri := fmt.Sprintf("%s?access_token=%s&media_id=%s", urlStr, accessToken, url.QueryEscape(mediaID))
+	req, err := http.NewRequest(http.MethodGet, uri, nil)
+	if err != nil {
+		return
+	}
+	return download(req, w, apiName)
+}
+
+//download 发送请求，返回文件时写入 w，返回 json 时读出内容，包含错误码的 json 返回 APIError
+//
+//与 miniprogram 的 fetchCode 一样根据 Content-Type 区分，接口出错时 Content-Type 可能是 text/plain
+func download(req *http.Request, w io.Writer, apiName string) (n int64, jsonBody []byte, err error) {
+	response, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		err = fmt.Errorf("http code error : uri=%v , statusCode=%v", req.URL.Path, response.StatusCode)
+		return
+	}
+
+	contentType := response.Header.Get("Content-Type")
+	if !strings.Contains(contentType, "json") && !strings.HasPrefix(contentType, "text/plain") {
+		n, err = io.Copy(w, response.Body)
+		return
+	}
+	jsonBody, err = ioutil.ReadAll(io.LimitReader(response.Body, maxJSONResponseSize))
+	if err != nil {
+		return
+	}
+	var result util.CommonError
+	if e := json.Unmarshal(jsonBody, &result); e != nil {
+		err = fmt.Errorf("%s error : unexpected response content type %s", apiName, contentType)
+		return
+	}
+	if result.ErrCode != 0 {
+		err = &util.APIError{APIName: apiName, ErrCode: result.ErrCode, ErrMsg: result.ErrMsg}
+	}
+	return
+}
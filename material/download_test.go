@@ -0,0 +1,120 @@
+package material
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fintcloud/wechat/cache"
+	"github.com/fintcloud/wechat/context"
+	"github.com/fintcloud/wechat/util"
+)
+
+func TestDownload(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		wantWritten string
+		wantJSON    string
+		wantErrCode int64
+		wantErr     bool
+	}{
+		{name: "image", status: http.StatusOK, contentType: "image/jpeg", body: "\xff\xd8jpeg", wantWritten: "\xff\xd8jpeg"},
+		{name: "voice without content type", status: http.StatusOK, body: "#!AMR", wantWritten: "#!AMR"},
+		{name: "video json", status: http.StatusOK, contentType: "application/json; charset=UTF-8", body: `{"video_url":"http://v"}`, wantJSON: `{"video_url":"http://v"}`},
+		{name: "json error", status: http.StatusOK, contentType: "application/json", body: `{"errcode":40007,"errmsg":"invalid media_id"}`, wantErrCode: 40007},
+		{name: "text plain error", status: http.StatusOK, contentType: "text/plain", body: `{"errcode":40001,"errmsg":"invalid credential"}`, wantErrCode: 40001},
+		{name: "text plain not json", status: http.StatusOK, contentType: "text/plain", body: "hello", wantErr: true},
+		{name: "http error", status: http.StatusBadGateway, contentType: "image/jpeg", body: "bad gateway", wantErr: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tt.contentType != "" {
+				w.Header().Set("Content-Type", tt.contentType)
+			} else {
+				//阻止 net/http 根据内容推断 Content-Type
+				w.Header()["Content-Type"] = nil
+			}
+			w.WriteHeader(tt.status)
+			w.Write([]byte(tt.body))
+		}))
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		var buf bytes.Buffer
+		n, jsonBody, err := download(req, &buf, "Test")
+		server.Close()
+
+		switch {
+		case tt.wantErrCode != 0:
+			if !util.IsErrCode(err, tt.wantErrCode) {
+				t.Errorf("%s: expected errcode %d, got %v", tt.name, tt.wantErrCode, err)
+			}
+		case tt.wantErr:
+			if err == nil {
+				t.Errorf("%s: expected error", tt.name)
+			}
+		case err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if buf.String() != tt.wantWritten || n != int64(len(tt.wantWritten)) {
+			t.Errorf("%s: wrote %d bytes %q, want %q", tt.name, n, buf.String(), tt.wantWritten)
+		}
+		if string(jsonBody) != tt.wantJSON && !tt.wantErr && tt.wantErrCode == 0 {
+			t.Errorf("%s: json body %q, want %q", tt.name, jsonBody, tt.wantJSON)
+		}
+	}
+}
+
+type handlerTransport struct {
+	handler http.Handler
+}
+
+func (t *handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rec := httptest.NewRecorder()
+	t.handler.ServeHTTP(rec, req)
+	return rec.Result(), nil
+}
+
+func TestDownloadMediaVideo(t *testing.T) {
+	transport := http.DefaultTransport
+	defer func() {
+		http.DefaultTransport = transport
+	}()
+	http.DefaultTransport = &handlerTransport{handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Host + r.URL.Path {
+		case "api.weixin.qq.com/cgi-bin/media/get":
+			switch r.URL.Query().Get("media_id") {
+			case "video":
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"video_url":"http://video.example.com/v.mp4"}`))
+			case "image+1&x":
+				w.Header().Set("Content-Type", "image/png")
+				w.Write([]byte("png"))
+			default:
+				http.NotFound(w, r)
+			}
+		case "video.example.com/v.mp4":
+			w.Header().Set("Content-Type", "video/mp4")
+			w.Write([]byte("mp4"))
+		default:
+			http.NotFound(w, r)
+		}
+	})}
+
+	ctx := &context.Context{AppID: "wx_test", Cache: cache.NewMemory()}
+	ctx.SetAccessTokenLock(new(sync.RWMutex))
+	ctx.Cache.Set("access_token_wx_test", "token", time.Hour)
+	material := NewMaterial(ctx)
+
+	for mediaID, want := range map[string]string{"image+1&x": "png", "video": "mp4"} {
+		var buf bytes.Buffer
+		if n, err := material.DownloadMedia(mediaID, &buf); err != nil || buf.String() != want || n != int64(len(want)) {
+			t.Errorf("DownloadMedia(%s) = %d %q %v, want %q", mediaID, n, buf.String(), err, want)
+		}
+	}
+}
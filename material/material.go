@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+
 	"github.com/fintcloud/wechat/context"
 	"github.com/fintcloud/wechat/util"
 )
@@ -14,6 +16,8 @@ const (
 	delMaterialURL = "https://api.weixin.qq.com/cgi-bin/material/del_material"
 	getMaterialURL = "https://api.weixin.qq.com/cgi-bin/material/get_material"
 	batchgetMaterialURL = "https://api.weixin.qq.com/cgi-bin/material/batchget_material"
+	updateNewsURL       = "https://api.weixin.qq.com/cgi-bin/material/update_news"
+	getMaterialCountURL = "https://api.weixin.qq.com/cgi-bin/material/get_materialcount"
 )
 
 //Material 素材管理
@@ -150,8 +154,28 @@ type resAddMaterial struct {
 
 //AddMaterial 上传永久性素材（处理视频需要单独上传）
 func (material *Material) AddMaterial(mediaType MediaType, filename string) (mediaID string, url string, err error) {
+	return material.addMaterial(mediaType, util.MultipartFormField{Filename: filename})
+}
+
+//AddMaterialFromReader 上传永久性素材，文件内容从 reader 中读取，filename 用于确定文件类型，size 小于0表示长度未知
+func (material *Material) AddMaterialFromReader(mediaType MediaType, filename string, reader io.Reader, size int64) (mediaID string, url string, err error) {
+	return material.addMaterial(mediaType, util.MultipartFormField{Filename: filename, Reader: reader, Size: size})
+}
+
+//AddMaterialFromURL 下载 fileURL 的内容并作为永久性素材上传
+func (material *Material) AddMaterialFromURL(mediaType MediaType, fileURL string) (mediaID string, url string, err error) {
+	body, filename, size, err := util.OpenURL(fileURL)
+	if err != nil {
+		return
+	}
+	defer body.Close()
+	return material.AddMaterialFromReader(mediaType, filename, body, size)
+}
+
+func (material *Material) addMaterial(mediaType MediaType, field util.MultipartFormField) (mediaID string, url string, err error) {
 	if mediaType == MediaTypeVideo {
 		err = errors.New("永久视频素材上传使用 AddVideo 方法")
+		return
 	}
 	var accessToken string
 	accessToken, err = material.GetAccessToken()
@@ -160,8 +184,10 @@ func (material *Material) AddMaterial(mediaType MediaType, filename string) (med
 	}
 
 	uri := fmt.Sprintf("%s?access_token=%s&type=%s", addMaterialURL, accessToken, mediaType)
+	field.IsFile = true
+	field.Fieldname = "media"
 	var response []byte
-	response, err = util.PostFile("media", filename, uri)
+	response, err = util.PostMultipartForm([]util.MultipartFormField{field}, uri)
 	if err != nil {
 		return
 	}
@@ -186,6 +212,25 @@ type reqVideo struct {
 
 //AddVideo 永久视频素材文件上传
 func (material *Material) AddVideo(filename, title, introduction string) (mediaID string, url string, err error) {
+	return material.addVideo(util.MultipartFormField{Filename: filename}, title, introduction)
+}
+
+//AddVideoFromReader 永久视频素材上传，文件内容从 reader 中读取，size 小于0表示长度未知
+func (material *Material) AddVideoFromReader(filename string, reader io.Reader, size int64, title, introduction string) (mediaID string, url string, err error) {
+	return material.addVideo(util.MultipartFormField{Filename: filename, Reader: reader, Size: size}, title, introduction)
+}
+
+//AddVideoFromURL 下载 fileURL 的视频并作为永久视频素材上传
+func (material *Material) AddVideoFromURL(fileURL, title, introduction string) (mediaID string, url string, err error) {
+	body, filename, size, err := util.OpenURL(fileURL)
+	if err != nil {
+		return
+	}
+	defer body.Close()
+	return material.AddVideoFromReader(filename, body, size, title, introduction)
+}
+
+func (material *Material) addVideo(field util.MultipartFormField, title, introduction string) (mediaID string, url string, err error) {
 	var accessToken string
 	accessToken, err = material.GetAccessToken()
 	if err != nil {
@@ -204,12 +249,10 @@ func (material *Material) AddVideo(filename, title, introduction string) (mediaI
 		return
 	}
 
+	field.IsFile = true
+	field.Fieldname = "media"
 	fields := []util.MultipartFormField{
-		{
-			IsFile:    true,
-			Fieldname: "media",
-			Filename:  filename,
-		},
+		field,
 		{
 			IsFile:    false,
 			Fieldname: "description",
@@ -256,3 +299,54 @@ func (material *Material) DeleteMaterial(mediaID string) error {
 
 	return util.DecodeWithCommonError(response, "DeleteMaterial")
 }
+
+//reqUpdateNews 修改永久图文素材请求信息
+type reqUpdateNews struct {
+	MediaID  string   `json:"media_id"`
+	Index    int      `json:"index"`
+	Articles *Article `json:"articles"`
+}
+
+//UpdateNews 修改永久图文素材，index 为要更新的文章在图文消息中的位置，第一篇为0
+func (material *Material) UpdateNews(mediaID string, index int, article *Article) error {
+	accessToken, err := material.GetAccessToken()
+	if err != nil {
+		return err
+	}
+
+	uri := fmt.Sprintf("%s?access_token=%s", updateNewsURL, accessToken)
+	response, err := util.PostJSON(uri, &reqUpdateNews{MediaID: mediaID, Index: index, Articles: article})
+	if err != nil {
+		return err
+	}
+
+	return util.DecodeWithCommonError(response, "UpdateNews")
+}
+
+//MaterialCount 永久素材的总数
+type MaterialCount struct {
+	util.CommonError
+
+	VoiceCount int64 `json:"voice_count"`
+	VideoCount int64 `json:"video_count"`
+	ImageCount int64 `json:"image_count"`
+	NewsCount  int64 `json:"news_count"`
+}
+
+//GetMaterialCount 获取永久素材的总数
+func (material *Material) GetMaterialCount() (*MaterialCount, error) {
+	accessToken, err := material.GetAccessToken()
+	if err != nil {
+		return nil, err
+	}
+
+	uri := fmt.Sprintf("%s?access_token=%s", getMaterialCountURL, accessToken)
+	response, err := util.HTTPGet(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	count := new(MaterialCount)
+	err = util.DecodeWithError(response, count, "GetMaterialCount")
+	return count, err
+}
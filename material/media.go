@@ -3,6 +3,7 @@ package material
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 
 	"github.com/fintcloud/wechat/util"
 )
@@ -39,6 +40,25 @@ type Media struct {
 
 //MediaUpload 临时素材上传
 func (material *Material) MediaUpload(mediaType MediaType, filename string) (media Media, err error) {
+	return material.mediaUpload(mediaType, util.MultipartFormField{Filename: filename})
+}
+
+//MediaUploadFromReader 临时素材上传，文件内容从 reader 中读取，filename 用于确定文件类型，size 小于0表示长度未知
+func (material *Material) MediaUploadFromReader(mediaType MediaType, filename string, reader io.Reader, size int64) (media Media, err error) {
+	return material.mediaUpload(mediaType, util.MultipartFormField{Filename: filename, Reader: reader, Size: size})
+}
+
+//MediaUploadFromURL 下载 fileURL 的内容并作为临时素材上传
+func (material *Material) MediaUploadFromURL(mediaType MediaType, fileURL string) (media Media, err error) {
+	body, filename, size, err := util.OpenURL(fileURL)
+	if err != nil {
+		return
+	}
+	defer body.Close()
+	return material.MediaUploadFromReader(mediaType, filename, body, size)
+}
+
+func (material *Material) mediaUpload(mediaType MediaType, field util.MultipartFormField) (media Media, err error) {
 	var accessToken string
 	accessToken, err = material.GetAccessToken()
 	if err != nil {
@@ -46,8 +66,10 @@ func (material *Material) MediaUpload(mediaType MediaType, filename string) (med
 	}
 
 	uri := fmt.Sprintf("%s?access_token=%s&type=%s", mediaUploadURL, accessToken, mediaType)
+	field.IsFile = true
+	field.Fieldname = "media"
 	var response []byte
-	response, err = util.PostFile("media", filename, uri)
+	response, err = util.PostMultipartForm([]util.MultipartFormField{field}, uri)
 	if err != nil {
 		return
 	}
@@ -63,7 +85,7 @@ func (material *Material) MediaUpload(mediaType MediaType, filename string) (med
 }
 
 //GetMediaURL 返回临时素材的下载地址供用户自己处理
-//NOTICE: URL 不可公开，因为含access_token 需要立即另存文件
+//NOTICE: URL 不可公开，因为含access_token 需要立即另存文件，可使用 DownloadMedia 直接下载
 func (material *Material) GetMediaURL(mediaID string) (mediaURL string, err error) {
 	var accessToken string
 	accessToken, err = material.GetAccessToken()
@@ -83,6 +105,25 @@ type resMediaImage struct {
 
 //ImageUpload 图片上传
 func (material *Material) ImageUpload(filename string) (url string, err error) {
+	return material.imageUpload(util.MultipartFormField{Filename: filename})
+}
+
+//ImageUploadFromReader 图片上传，文件内容从 reader 中读取，size 小于0表示长度未知
+func (material *Material) ImageUploadFromReader(filename string, reader io.Reader, size int64) (url string, err error) {
+	return material.imageUpload(util.MultipartFormField{Filename: filename, Reader: reader, Size: size})
+}
+
+//ImageUploadFromURL 下载 fileURL 的图片并上传
+func (material *Material) ImageUploadFromURL(fileURL string) (url string, err error) {
+	body, filename, size, err := util.OpenURL(fileURL)
+	if err != nil {
+		return
+	}
+	defer body.Close()
+	return material.ImageUploadFromReader(filename, body, size)
+}
+
+func (material *Material) imageUpload(field util.MultipartFormField) (url string, err error) {
 	var accessToken string
 	accessToken, err = material.GetAccessToken()
 	if err != nil {
@@ -90,8 +131,10 @@ func (material *Material) ImageUpload(filename string) (url string, err error) {
 	}
 
 	uri := fmt.Sprintf("%s?access_token=%s", mediaUploadImageURL, accessToken)
+	field.IsFile = true
+	field.Fieldname = "media"
 	var response []byte
-	response, err = util.PostFile("media", filename, uri)
+	response, err = util.PostMultipartForm([]util.MultipartFormField{field}, uri)
 	if err != nil {
 		return
 	}
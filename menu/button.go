@@ -9,6 +9,7 @@ type Button struct {
 	MediaID    string    `json:"media_id,omitempty"`
 	AppID      string    `json:"appid,omitempty"`
 	PagePath   string    `json:"pagepath,omitempty"`
+	ArticleID  string    `json:"article_id,omitempty"`
 	SubButtons []*Button `json:"sub_button,omitempty"`
 }
 
@@ -141,3 +142,27 @@ func (btn *Button) SetMiniprogramButton(name, url, appID, pagePath string) {
 	btn.MediaID = ""
 	btn.SubButtons = nil
 }
+
+//SetArticleIDButton 设置 发送发布后的图文消息 类型按钮，articleID 为发布接口返回的 article_id
+func (btn *Button) SetArticleIDButton(name, articleID string) {
+	btn.Type = "article_id"
+	btn.Name = name
+	btn.ArticleID = articleID
+
+	btn.Key = ""
+	btn.URL = ""
+	btn.MediaID = ""
+	btn.SubButtons = nil
+}
+
+//SetArticleViewLimitedButton 设置 跳转发布后的图文消息URL 类型按钮
+func (btn *Button) SetArticleViewLimitedButton(name, articleID string) {
+	btn.Type = "article_view_limited"
+	btn.Name = name
+	btn.ArticleID = articleID
+
+	btn.Key = ""
+	btn.URL = ""
+	btn.MediaID = ""
+	btn.SubButtons = nil
+}
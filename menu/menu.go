@@ -3,6 +3,7 @@ package menu
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
 
 	"github.com/fintcloud/wechat/context"
 	"github.com/fintcloud/wechat/util"
@@ -102,6 +103,7 @@ type ButtonNew struct {
 
 //MatchRule 个性化菜单规则
 type MatchRule struct {
+	TagID              string `json:"tag_id,omitempty"`
 	GroupID            int32  `json:"group_id,omitempty"`
 	Sex                int32  `json:"sex,omitempty"`
 	Country            string `json:"country,omitempty"`
@@ -111,6 +113,56 @@ type MatchRule struct {
 	Language           string `json:"language,omitempty"`
 }
 
+//UnmarshalJSON 查询菜单时微信返回的 group_id、sex、client_platform_type 等为字符串（如 "1"，未设置时为 ""），两种格式都可以解析
+func (rule *MatchRule) UnmarshalJSON(data []byte) error {
+	type plainMatchRule MatchRule
+	var raw struct {
+		*plainMatchRule
+		TagID              json.RawMessage `json:"tag_id"`
+		GroupID            json.RawMessage `json:"group_id"`
+		Sex                json.RawMessage `json:"sex"`
+		ClientPlatformType json.RawMessage `json:"client_platform_type"`
+	}
+	raw.plainMatchRule = (*plainMatchRule)(rule)
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	rule.TagID = rawJSONString(raw.TagID)
+	for _, field := range []struct {
+		name  string
+		raw   json.RawMessage
+		value *int32
+	}{
+		{"group_id", raw.GroupID, &rule.GroupID},
+		{"sex", raw.Sex, &rule.Sex},
+		{"client_platform_type", raw.ClientPlatformType, &rule.ClientPlatformType},
+	} {
+		*field.value = 0
+		str := rawJSONString(field.raw)
+		if str == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(str, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid matchrule %s %s", field.name, field.raw)
+		}
+		*field.value = int32(n)
+	}
+	return nil
+}
+
+//rawJSONString 返回 json 字符串或数字的文本，null 时为空
+func rawJSONString(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	var str string
+	if err := json.Unmarshal(raw, &str); err == nil {
+		return str
+	}
+	return string(raw)
+}
+
 //NewMenu 实例
 func NewMenu(context *context.Context) *Menu {
 	menu := new(Menu)
@@ -118,8 +170,11 @@ func NewMenu(context *context.Context) *Menu {
 	return menu
 }
 
-//SetMenu 设置按钮
+//SetMenu 设置按钮，请求前会检查菜单结构，不符合要求时返回 ValidationErrors
 func (menu *Menu) SetMenu(buttons []*Button) error {
+	if err := ValidateButtons(buttons); err != nil {
+		return err
+	}
 	accessToken, err := menu.GetAccessToken()
 	if err != nil {
 		return err
@@ -177,8 +232,11 @@ func (menu *Menu) DeleteMenu() error {
 	return util.DecodeWithCommonError(response, "GetMenu")
 }
 
-//AddConditional 添加个性化菜单
+//AddConditional 添加个性化菜单，请求前会检查菜单结构和匹配规则，不符合要求时返回 ValidationErrors
 func (menu *Menu) AddConditional(buttons []*Button, matchRule *MatchRule) error {
+	if err := ValidateConditional(buttons, matchRule); err != nil {
+		return err
+	}
 	accessToken, err := menu.GetAccessToken()
 	if err != nil {
 		return err
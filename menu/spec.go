@@ -0,0 +1,125 @@
+package menu
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+//Spec 声明式的菜单配置，包括默认菜单和个性化菜单
+//
+//json 与 yaml 格式使用相同的字段名，与微信菜单接口一致，例如：
+//
+//	button:
+//	  - type: click
+//	    name: 今日歌曲
+//	    key: V1001_TODAY_MUSIC
+//	conditional:
+//	  - matchrule:
+//	      tag_id: "2"
+//	    button:
+//	      - type: view
+//	        name: 会员中心
+//	        url: https://example.com/vip
+type Spec struct {
+	Button      []*Button          `json:"button"`
+	Conditional []*ConditionalSpec `json:"conditional,omitempty"`
+}
+
+//ConditionalSpec 个性化菜单配置
+type ConditionalSpec struct {
+	Button    []*Button  `json:"button"`
+	MatchRule *MatchRule `json:"matchrule"`
+}
+
+//Validate 检查默认菜单和所有个性化菜单，个性化菜单的错误路径以 conditional[i]. 开头
+func (spec *Spec) Validate() error {
+	var errs ValidationErrors
+	validateButtons(&errs, spec.Button)
+	for i, conditional := range spec.Conditional {
+		var condErrs ValidationErrors
+		validateButtons(&condErrs, conditional.Button)
+		validateMatchRule(&condErrs, conditional.MatchRule)
+		for _, err := range condErrs {
+			err.Path = fmt.Sprintf("conditional[%d].%s", i, err.Path)
+		}
+		errs = append(errs, condErrs...)
+	}
+	return errs.err()
+}
+
+//LoadSpec 从文件中读取菜单配置，根据扩展名判断格式，.yaml/.yml 为 yaml，其他为 json
+func LoadSpec(filename string) (*Spec, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext == ".yaml" || ext == ".yml" {
+		return ParseYAMLSpec(content)
+	}
+	return ParseJSONSpec(content)
+}
+
+//ParseJSONSpec 解析 json 格式的菜单配置
+func ParseJSONSpec(content []byte) (*Spec, error) {
+	spec := new(Spec)
+	if err := json.Unmarshal(content, spec); err != nil {
+		return nil, fmt.Errorf("parse menu spec error : %v", err)
+	}
+	return spec, nil
+}
+
+//ParseYAMLSpec 解析 yaml 格式的菜单配置
+func ParseYAMLSpec(content []byte) (*Spec, error) {
+	var raw interface{}
+	if err := yaml.Unmarshal(content, &raw); err != nil {
+		return nil, fmt.Errorf("parse menu spec error : %v", err)
+	}
+	normalized, err := normalizeYAML(raw)
+	if err != nil {
+		return nil, err
+	}
+	//转换为 json 后再解析，保证两种格式的字段名一致
+	content, err = json.Marshal(normalized)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJSONSpec(content)
+}
+
+//normalizeYAML 将 yaml 解析得到的 map[interface{}]interface{} 转换为 json 可以处理的 map[string]interface{}
+func normalizeYAML(v interface{}) (interface{}, error) {
+	switch vv := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(vv))
+		for key, val := range vv {
+			k, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("parse menu spec error : unsupported key %v", key)
+			}
+			normalized, err := normalizeYAML(val)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = normalized
+		}
+		return m, nil
+	case []interface{}:
+		list := make([]interface{}, len(vv))
+		for i, val := range vv {
+			normalized, err := normalizeYAML(val)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = normalized
+		}
+		return list, nil
+	default:
+		return v, nil
+	}
+}
@@ -0,0 +1,329 @@
+package menu
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/fintcloud/wechat/util"
+)
+
+//errCodeMenuNotExist 菜单不存在
+const errCodeMenuNotExist int64 = 46003
+
+//CurrentConditional 线上已有的个性化菜单
+type CurrentConditional struct {
+	MenuID    int64
+	Button    []*Button
+	MatchRule *MatchRule
+}
+
+//SyncPlan 菜单同步计划
+type SyncPlan struct {
+	Spec *Spec
+
+	CurrentButton      []*Button
+	CurrentConditional []*CurrentConditional
+
+	SetDefault        bool               //是否需要重新创建默认菜单
+	DeleteConditional []int64            //需要删除的个性化菜单
+	AddConditional    []*ConditionalSpec //需要新增的个性化菜单，按顺序创建
+}
+
+//HasChanges 线上菜单与配置是否有差异
+func (plan *SyncPlan) HasChanges() bool {
+	return plan.SetDefault || len(plan.DeleteConditional) > 0 || len(plan.AddConditional) > 0
+}
+
+//PlanSync 获取线上菜单并与配置比较，得到需要执行的变更
+func (menu *Menu) PlanSync(spec *Spec) (*SyncPlan, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	plan := &SyncPlan{Spec: spec}
+	if err := menu.loadCurrent(plan); err != nil {
+		return nil, err
+	}
+	plan.SetDefault = !equalButtons(plan.CurrentButton, spec.Button)
+	plan.planConditional()
+	return plan, nil
+}
+
+//loadCurrent 优先使用 GetMenu 获取通过接口创建的菜单，不存在时使用 GetCurrentSelfMenuInfo 获取在公众平台设置的菜单
+func (menu *Menu) loadCurrent(plan *SyncPlan) error {
+	resMenu, err := menu.GetMenu()
+	if err == nil {
+		plan.CurrentButton = toButtonPtrs(resMenu.Menu.Button)
+		for _, conditional := range resMenu.Conditionalmenu {
+			matchRule := conditional.MatchRule
+			plan.CurrentConditional = append(plan.CurrentConditional, &CurrentConditional{
+				MenuID:    conditional.MenuID,
+				Button:    toButtonPtrs(conditional.Button),
+				MatchRule: &matchRule,
+			})
+		}
+		return nil
+	}
+	if resMenu.ErrCode != errCodeMenuNotExist {
+		return err
+	}
+
+	selfMenu, err := menu.GetCurrentSelfMenuInfo()
+	if err != nil {
+		return err
+	}
+	if selfMenu.IsMenuOpen == 1 {
+		plan.CurrentButton = selfMenuToButtons(selfMenu.SelfMenuInfo.Button)
+	}
+	return nil
+}
+
+//planConditional 个性化菜单按创建顺序匹配，保留与配置一致的最长前缀，其余删除后按配置顺序重新创建
+func (plan *SyncPlan) planConditional() {
+	current := plan.CurrentConditional
+	desired := plan.Spec.Conditional
+	keep := 0
+	//默认菜单重新创建时，个性化菜单全部重建
+	if !plan.SetDefault {
+		for keep < len(current) && keep < len(desired) {
+			if !equalMatchRule(current[keep].MatchRule, desired[keep].MatchRule) || !equalButtons(current[keep].Button, desired[keep].Button) {
+				break
+			}
+			keep++
+		}
+	}
+	for _, conditional := range current[keep:] {
+		plan.DeleteConditional = append(plan.DeleteConditional, conditional.MenuID)
+	}
+	plan.AddConditional = desired[keep:]
+}
+
+//WriteDiff 输出可读的变更内容
+func (plan *SyncPlan) WriteDiff(w io.Writer) error {
+	var buf bytes.Buffer
+	if !plan.HasChanges() {
+		buf.WriteString("menu is up to date\n")
+		_, err := w.Write(buf.Bytes())
+		return err
+	}
+	if plan.SetDefault {
+		buf.WriteString("default menu:\n")
+		writeButtonDiff(&buf, "  ", plan.CurrentButton, plan.Spec.Button)
+	}
+	if len(plan.DeleteConditional) > 0 || len(plan.AddConditional) > 0 {
+		buf.WriteString("conditional menus:\n")
+		for _, menuID := range plan.DeleteConditional {
+			for _, conditional := range plan.CurrentConditional {
+				if conditional.MenuID == menuID {
+					fmt.Fprintf(&buf, "  - delete menuid=%d matchrule=%s (%d buttons)\n", menuID, toJSON(conditional.MatchRule), len(conditional.Button))
+				}
+			}
+		}
+		for _, conditional := range plan.AddConditional {
+			fmt.Fprintf(&buf, "  + add matchrule=%s (%d buttons)\n", toJSON(conditional.MatchRule), len(conditional.Button))
+			writeButtonDiff(&buf, "      ", nil, conditional.Button)
+		}
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+//ApplySync 执行同步计划，先创建默认菜单，再删除和新增个性化菜单
+//
+//微信没有批量修改菜单的接口，同步不是原子的：某一步失败时立即返回错误，之前的步骤已经生效，之后的不再执行。
+//例如删除了个性化菜单但新增失败时，对应的用户会暂时看到默认菜单。此时重新调用 Sync 即可，
+//PlanSync 总是与线上菜单比较，已完成的变更不会重复执行
+func (menu *Menu) ApplySync(plan *SyncPlan) error {
+	if plan.SetDefault {
+		if err := menu.SetMenu(plan.Spec.Button); err != nil {
+			return err
+		}
+	}
+	for _, menuID := range plan.DeleteConditional {
+		err := menu.DeleteConditional(menuID)
+		//重新创建默认菜单时个性化菜单可能已被一并清除
+		if err != nil && !(plan.SetDefault && util.IsErrCode(err, errCodeMenuNotExist)) {
+			return err
+		}
+	}
+	for _, conditional := range plan.AddConditional {
+		if err := menu.AddConditional(conditional.Button, conditional.MatchRule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Sync 将线上菜单同步为配置的内容，变更内容写入 w，dryRun 为 true 时只输出变更不执行
+func (menu *Menu) Sync(spec *Spec, w io.Writer, dryRun bool) (*SyncPlan, error) {
+	plan, err := menu.PlanSync(spec)
+	if err != nil {
+		return nil, err
+	}
+	if w != nil {
+		if err = plan.WriteDiff(w); err != nil {
+			return plan, err
+		}
+	}
+	if dryRun || !plan.HasChanges() {
+		return plan, nil
+	}
+	return plan, menu.ApplySync(plan)
+}
+
+//writeButtonDiff 按路径比较两组菜单按钮，每个按钮输出一行
+func writeButtonDiff(buf *bytes.Buffer, indent string, from, to []*Button) {
+	fromLines := flattenButtons(from)
+	toLines := flattenButtons(to)
+	paths := make([]string, 0, len(fromLines)+len(toLines))
+	for path := range fromLines {
+		paths = append(paths, path)
+	}
+	for path := range toLines {
+		if _, ok := fromLines[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		oldLine, inFrom := fromLines[path]
+		newLine, inTo := toLines[path]
+		switch {
+		case inFrom && !inTo:
+			fmt.Fprintf(buf, "%s- %s %s\n", indent, path, oldLine)
+		case !inFrom && inTo:
+			fmt.Fprintf(buf, "%s+ %s %s\n", indent, path, newLine)
+		case oldLine != newLine:
+			fmt.Fprintf(buf, "%s- %s %s\n", indent, path, oldLine)
+			fmt.Fprintf(buf, "%s+ %s %s\n", indent, path, newLine)
+		}
+	}
+}
+
+func flattenButtons(buttons []*Button) map[string]string {
+	lines := make(map[string]string)
+	for i, btn := range normalizeButtons(buttons) {
+		path := fmt.Sprintf("button[%d]", i)
+		lines[path] = describeButton(btn)
+		for j, sub := range btn.SubButtons {
+			lines[fmt.Sprintf("%s.sub_button[%d]", path, j)] = describeButton(sub)
+		}
+	}
+	return lines
+}
+
+func describeButton(btn *Button) string {
+	if len(btn.SubButtons) > 0 {
+		return fmt.Sprintf("%q (%d sub buttons)", btn.Name, len(btn.SubButtons))
+	}
+	desc := fmt.Sprintf("%s %q", btn.Type, btn.Name)
+	if btn.Key != "" {
+		desc += " key=" + btn.Key
+	}
+	if btn.URL != "" {
+		desc += " url=" + btn.URL
+	}
+	if btn.MediaID != "" {
+		desc += " media_id=" + btn.MediaID
+	}
+	if btn.AppID != "" {
+		desc += " appid=" + btn.AppID
+	}
+	if btn.PagePath != "" {
+		desc += " pagepath=" + btn.PagePath
+	}
+	if btn.ArticleID != "" {
+		desc += " article_id=" + btn.ArticleID
+	}
+	return desc
+}
+
+func toButtonPtrs(buttons []Button) []*Button {
+	ptrs := make([]*Button, 0, len(buttons))
+	for i := range buttons {
+		ptrs = append(ptrs, &buttons[i])
+	}
+	return ptrs
+}
+
+//selfMenuToButtons 转换在公众平台设置的菜单，news、text 等仅在公众平台支持的类型无法对应，会被视为有差异
+func selfMenuToButtons(selfButtons []SelfMenuButton) []*Button {
+	buttons := make([]*Button, 0, len(selfButtons))
+	for _, selfBtn := range selfButtons {
+		btn := &Button{
+			Type: selfBtn.Type,
+			Name: selfBtn.Name,
+			Key:  selfBtn.Key,
+			URL:  selfBtn.URL,
+		}
+		if len(selfBtn.SubButton.List) > 0 {
+			btn.Type = ""
+			btn.SubButtons = selfMenuToButtons(selfBtn.SubButton.List)
+		}
+		buttons = append(buttons, btn)
+	}
+	return buttons
+}
+
+func toJSON(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func equalJSON(a, b interface{}) bool {
+	return toJSON(a) == toJSON(b)
+}
+
+func equalButtons(a, b []*Button) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return len(a) == len(b)
+	}
+	return equalJSON(normalizeButtons(a), normalizeButtons(b))
+}
+
+func equalMatchRule(a, b *MatchRule) bool {
+	return equalJSON(normalizeMatchRule(a), normalizeMatchRule(b))
+}
+
+//normalizeButtons 只保留按钮类型对应的字段，配置中多余的字段微信不会保存，查询时也不会返回，不视为差异
+func normalizeButtons(buttons []*Button) []*Button {
+	normalized := make([]*Button, 0, len(buttons))
+	for _, btn := range buttons {
+		n := &Button{Type: btn.Type, Name: btn.Name}
+		switch {
+		case len(btn.SubButtons) > 0:
+			n.Type = ""
+			n.SubButtons = normalizeButtons(btn.SubButtons)
+		case btn.Type == "view":
+			n.URL = btn.URL
+		case btn.Type == "media_id" || btn.Type == "view_limited":
+			n.MediaID = btn.MediaID
+		case btn.Type == "article_id" || btn.Type == "article_view_limited":
+			n.ArticleID = btn.ArticleID
+		case btn.Type == "miniprogram":
+			n.URL = btn.URL
+			n.AppID = btn.AppID
+			n.PagePath = btn.PagePath
+		default:
+			n.Key = btn.Key
+		}
+		normalized = append(normalized, n)
+	}
+	return normalized
+}
+
+//normalizeMatchRule 查询菜单时微信以 group_id 返回按标签匹配的规则，统一为 tag_id
+func normalizeMatchRule(rule *MatchRule) *MatchRule {
+	if rule == nil {
+		return nil
+	}
+	n := *rule
+	if n.TagID == "" && n.GroupID != 0 {
+		n.TagID = strconv.FormatInt(int64(n.GroupID), 10)
+	}
+	n.GroupID = 0
+	return &n
+}
@@ -0,0 +1,217 @@
+package menu
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMatchRuleUnmarshal(t *testing.T) {
+	tests := []struct {
+		data string
+		want MatchRule
+	}{
+		{`{"tag_id":"2","sex":1,"client_platform_type":2}`, MatchRule{TagID: "2", Sex: 1, ClientPlatformType: 2}},
+		//查询菜单时返回的格式
+		{`{"group_id":"2","sex":"1","country":"中国","province":"广东","city":"","client_platform_type":""}`, MatchRule{GroupID: 2, Sex: 1, Country: "中国", Province: "广东"}},
+		{`{"tag_id":100,"language":"zh_CN"}`, MatchRule{TagID: "100", Language: "zh_CN"}},
+	}
+	for _, tt := range tests {
+		var rule MatchRule
+		if err := json.Unmarshal([]byte(tt.data), &rule); err != nil {
+			t.Errorf("%s: %v", tt.data, err)
+			continue
+		}
+		if rule != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.data, rule, tt.want)
+		}
+	}
+	var rule MatchRule
+	if err := json.Unmarshal([]byte(`{"sex":"male"}`), &rule); err == nil {
+		t.Error("invalid sex should fail")
+	}
+}
+
+func TestPlanConditional(t *testing.T) {
+	vipButtons := []*Button{{Type: "view", Name: "会员中心", URL: "https://example.com/vip"}}
+	iosButtons := []*Button{{Type: "click", Name: "iOS", Key: "IOS"}}
+	vip := &ConditionalSpec{MatchRule: &MatchRule{TagID: "2"}, Button: vipButtons}
+	ios := &ConditionalSpec{MatchRule: &MatchRule{ClientPlatformType: 1}, Button: iosButtons}
+
+	tests := []struct {
+		name       string
+		setDefault bool
+		current    []*CurrentConditional
+		desired    []*ConditionalSpec
+		wantDelete []int64
+		wantAdd    []*ConditionalSpec
+	}{
+		{
+			name:    "create all",
+			desired: []*ConditionalSpec{vip, ios},
+			wantAdd: []*ConditionalSpec{vip, ios},
+		},
+		{
+			name: "up to date with echoed fields",
+			current: []*CurrentConditional{
+				{MenuID: 1, MatchRule: &MatchRule{GroupID: 2}, Button: vipButtons},
+				{MenuID: 2, MatchRule: &MatchRule{ClientPlatformType: 1}, Button: iosButtons},
+			},
+			desired: []*ConditionalSpec{vip, ios},
+		},
+		{
+			name: "keep prefix",
+			current: []*CurrentConditional{
+				{MenuID: 1, MatchRule: &MatchRule{TagID: "2"}, Button: vipButtons},
+				{MenuID: 2, MatchRule: &MatchRule{ClientPlatformType: 2}, Button: iosButtons},
+			},
+			desired:    []*ConditionalSpec{vip, ios},
+			wantDelete: []int64{2},
+			wantAdd:    []*ConditionalSpec{ios},
+		},
+		{
+			name: "reorder",
+			current: []*CurrentConditional{
+				{MenuID: 1, MatchRule: &MatchRule{ClientPlatformType: 1}, Button: iosButtons},
+				{MenuID: 2, MatchRule: &MatchRule{TagID: "2"}, Button: vipButtons},
+			},
+			desired:    []*ConditionalSpec{vip, ios},
+			wantDelete: []int64{1, 2},
+			wantAdd:    []*ConditionalSpec{vip, ios},
+		},
+		{
+			name:       "remove",
+			current:    []*CurrentConditional{{MenuID: 1, MatchRule: &MatchRule{TagID: "2"}, Button: vipButtons}},
+			wantDelete: []int64{1},
+		},
+		{
+			name:       "default menu changed",
+			setDefault: true,
+			current:    []*CurrentConditional{{MenuID: 1, MatchRule: &MatchRule{TagID: "2"}, Button: vipButtons}},
+			desired:    []*ConditionalSpec{vip},
+			wantDelete: []int64{1},
+			wantAdd:    []*ConditionalSpec{vip},
+		},
+	}
+	for _, tt := range tests {
+		plan := &SyncPlan{
+			Spec:               &Spec{Conditional: tt.desired},
+			SetDefault:         tt.setDefault,
+			CurrentConditional: tt.current,
+		}
+		plan.planConditional()
+		if !reflect.DeepEqual(plan.DeleteConditional, tt.wantDelete) {
+			t.Errorf("%s: delete %v, want %v", tt.name, plan.DeleteConditional, tt.wantDelete)
+		}
+		if len(plan.AddConditional) != len(tt.wantAdd) {
+			t.Errorf("%s: add %d menus, want %d", tt.name, len(plan.AddConditional), len(tt.wantAdd))
+			continue
+		}
+		for i := range tt.wantAdd {
+			if plan.AddConditional[i] != tt.wantAdd[i] {
+				t.Errorf("%s: add[%d] is %s", tt.name, i, toJSON(plan.AddConditional[i].MatchRule))
+			}
+		}
+	}
+}
+
+func TestEqualButtons(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  []*Button
+		desired  []*Button
+		expected bool
+	}{
+		{"empty", nil, []*Button{}, true},
+		{"missing", nil, []*Button{{Type: "click", Name: "a", Key: "A"}}, false},
+		{
+			name:     "field not used by type",
+			current:  []*Button{{Type: "view", Name: "a", URL: "http://a"}},
+			desired:  []*Button{{Type: "view", Name: "a", URL: "http://a", Key: "A"}},
+			expected: true,
+		},
+		{
+			name:     "parent type",
+			current:  []*Button{{Name: "a", SubButtons: []*Button{{Type: "click", Name: "b", Key: "B"}}}},
+			desired:  []*Button{{Type: "click", Name: "a", Key: "A", SubButtons: []*Button{{Type: "click", Name: "b", Key: "B"}}}},
+			expected: true,
+		},
+		{
+			name:     "url changed",
+			current:  []*Button{{Type: "view", Name: "a", URL: "http://a"}},
+			desired:  []*Button{{Type: "view", Name: "a", URL: "http://b"}},
+			expected: false,
+		},
+		{
+			name:     "sub button changed",
+			current:  []*Button{{Name: "a", SubButtons: []*Button{{Type: "click", Name: "b", Key: "B"}}}},
+			desired:  []*Button{{Name: "a", SubButtons: []*Button{{Type: "click", Name: "b", Key: "C"}}}},
+			expected: false,
+		},
+	}
+	for _, tt := range tests {
+		if got := equalButtons(tt.current, tt.desired); got != tt.expected {
+			t.Errorf("%s: equalButtons=%v", tt.name, got)
+		}
+	}
+}
+
+func TestWriteDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		plan *SyncPlan
+		want string
+	}{
+		{
+			name: "up to date",
+			plan: &SyncPlan{Spec: &Spec{}},
+			want: "menu is up to date\n",
+		},
+		{
+			name: "default menu",
+			plan: &SyncPlan{
+				Spec: &Spec{Button: []*Button{
+					{Type: "click", Name: "a", Key: "A"},
+					{Name: "b", SubButtons: []*Button{{Type: "view", Name: "c", URL: "http://c2"}}},
+				}},
+				CurrentButton: []*Button{
+					{Type: "click", Name: "a", Key: "A"},
+					{Name: "b", SubButtons: []*Button{{Type: "view", Name: "c", URL: "http://c"}, {Type: "click", Name: "d", Key: "D"}}},
+				},
+				SetDefault: true,
+			},
+			want: "default menu:\n" +
+				"  - button[1] \"b\" (2 sub buttons)\n" +
+				"  + button[1] \"b\" (1 sub buttons)\n" +
+				"  - button[1].sub_button[0] view \"c\" url=http://c\n" +
+				"  + button[1].sub_button[0] view \"c\" url=http://c2\n" +
+				"  - button[1].sub_button[1] click \"d\" key=D\n",
+		},
+		{
+			name: "conditional menus",
+			plan: &SyncPlan{
+				Spec:               &Spec{},
+				CurrentConditional: []*CurrentConditional{{MenuID: 1, MatchRule: &MatchRule{TagID: "2"}, Button: []*Button{{}}}},
+				DeleteConditional:  []int64{1},
+				AddConditional: []*ConditionalSpec{{
+					MatchRule: &MatchRule{Sex: 1},
+					Button:    []*Button{{Type: "view", Name: "a", URL: "http://a", Key: "ignored"}},
+				}},
+			},
+			want: "conditional menus:\n" +
+				"  - delete menuid=1 matchrule={\"tag_id\":\"2\"} (1 buttons)\n" +
+				"  + add matchrule={\"sex\":1} (1 buttons)\n" +
+				"      + button[0] view \"a\" url=http://a\n",
+		},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := tt.plan.WriteDiff(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, buf.String(), tt.want)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package menu
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	maxButtonCount        = 3    //一级菜单最多3个
+	maxSubButtonCount     = 5    //二级菜单最多5个
+	maxButtonNameBytes    = 16   //一级菜单名称最多16个字节
+	maxSubButtonNameBytes = 60   //二级菜单名称最多60个字节
+	maxKeyBytes           = 128  //key 最多128个字节
+	maxURLBytes           = 1024 //url 最多1024个字节
+)
+
+//ValidationError 菜单中的一处错误，Path 为出错字段的位置，例如 button[1].sub_button[3].name
+type ValidationError struct {
+	Path string
+	Msg  string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Path + ": " + e.Msg
+}
+
+//ValidationErrors 菜单中所有的错误
+type ValidationErrors []*ValidationError
+
+func (errs ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return "invalid menu: " + strings.Join(msgs, "; ")
+}
+
+func (errs *ValidationErrors) add(path, format string, args ...interface{}) {
+	*errs = append(*errs, &ValidationError{Path: path, Msg: fmt.Sprintf(format, args...)})
+}
+
+//err 没有错误时返回 nil，避免返回值为 nil 的 ValidationErrors 被当作非 nil 的 error
+func (errs ValidationErrors) err() error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+//ValidateButtons 检查菜单结构是否符合微信的限制，返回所有错误，类型为 ValidationErrors
+func ValidateButtons(buttons []*Button) error {
+	var errs ValidationErrors
+	validateButtons(&errs, buttons)
+	return errs.err()
+}
+
+//ValidateMatchRule 检查个性化菜单的匹配规则，返回所有错误，类型为 ValidationErrors
+func ValidateMatchRule(matchRule *MatchRule) error {
+	var errs ValidationErrors
+	validateMatchRule(&errs, matchRule)
+	return errs.err()
+}
+
+//ValidateConditional 检查个性化菜单及其匹配规则
+func ValidateConditional(buttons []*Button, matchRule *MatchRule) error {
+	var errs ValidationErrors
+	validateButtons(&errs, buttons)
+	validateMatchRule(&errs, matchRule)
+	return errs.err()
+}
+
+func validateButtons(errs *ValidationErrors, buttons []*Button) {
+	if len(buttons) == 0 {
+		errs.add("button", "at least 1 button is required")
+		return
+	}
+	if len(buttons) > maxButtonCount {
+		errs.add("button", "at most %d buttons are allowed, got %d", maxButtonCount, len(buttons))
+	}
+	for i, btn := range buttons {
+		path := fmt.Sprintf("button[%d]", i)
+		if btn == nil {
+			errs.add(path, "button is nil")
+			continue
+		}
+		validateName(errs, path, btn.Name, maxButtonNameBytes)
+		if len(btn.SubButtons) == 0 {
+			validateAction(errs, path, btn)
+			continue
+		}
+		if len(btn.SubButtons) > maxSubButtonCount {
+			errs.add(path+".sub_button", "at most %d sub buttons are allowed, got %d", maxSubButtonCount, len(btn.SubButtons))
+		}
+		for j, sub := range btn.SubButtons {
+			subPath := fmt.Sprintf("%s.sub_button[%d]", path, j)
+			if sub == nil {
+				errs.add(subPath, "button is nil")
+				continue
+			}
+			validateName(errs, subPath, sub.Name, maxSubButtonNameBytes)
+			if len(sub.SubButtons) > 0 {
+				errs.add(subPath+".sub_button", "sub button can not contain sub buttons")
+			}
+			validateAction(errs, subPath, sub)
+		}
+	}
+}
+
+func validateName(errs *ValidationErrors, path, name string, maxBytes int) {
+	path += ".name"
+	if name == "" {
+		errs.add(path, "name is required")
+		return
+	}
+	if len(name) > maxBytes {
+		errs.add(path, "name must be at most %d bytes, got %d", maxBytes, len(name))
+	}
+}
+
+//validateAction 检查没有二级菜单的按钮的类型及对应字段
+func validateAction(errs *ValidationErrors, path string, btn *Button) {
+	if len(btn.Key) > maxKeyBytes {
+		errs.add(path+".key", "key must be at most %d bytes, got %d", maxKeyBytes, len(btn.Key))
+	}
+	switch btn.Type {
+	case "":
+		errs.add(path+".type", "type is required for button without sub buttons")
+	case "click", "scancode_push", "scancode_waitmsg", "pic_sysphoto", "pic_photo_or_album", "pic_weixin", "location_select":
+		validateRequired(errs, path+".key", "key", btn.Key, 0)
+	case "view":
+		validateRequired(errs, path+".url", "url", btn.URL, maxURLBytes)
+	case "media_id", "view_limited":
+		validateRequired(errs, path+".media_id", "media_id", btn.MediaID, 0)
+	case "article_id", "article_view_limited":
+		validateRequired(errs, path+".article_id", "article_id", btn.ArticleID, 0)
+	case "miniprogram":
+		//不支持小程序的老版本客户端将打开 url
+		validateRequired(errs, path+".url", "url", btn.URL, maxURLBytes)
+		validateRequired(errs, path+".appid", "appid", btn.AppID, 0)
+		validateRequired(errs, path+".pagepath", "pagepath", btn.PagePath, 0)
+	default:
+		errs.add(path+".type", "unknown button type %q", btn.Type)
+	}
+}
+
+//validateRequired 检查必填字段，maxBytes 为0时不限制长度
+func validateRequired(errs *ValidationErrors, path, field, value string, maxBytes int) {
+	if value == "" {
+		errs.add(path, "%s is required", field)
+		return
+	}
+	if maxBytes > 0 && len(value) > maxBytes {
+		errs.add(path, "%s must be at most %d bytes, got %d", field, maxBytes, len(value))
+	}
+}
+
+func validateMatchRule(errs *ValidationErrors, matchRule *MatchRule) {
+	const path = "matchrule"
+	if matchRule == nil {
+		errs.add(path, "matchrule is required")
+		return
+	}
+	if *matchRule == (MatchRule{}) {
+		errs.add(path, "at least one match rule is required")
+		return
+	}
+	if matchRule.Sex != 0 && matchRule.Sex != 1 && matchRule.Sex != 2 {
+		errs.add(path+".sex", "sex must be 1 (male) or 2 (female), got %d", matchRule.Sex)
+	}
+	if matchRule.ClientPlatformType != 0 && (matchRule.ClientPlatformType < 1 || matchRule.ClientPlatformType > 3) {
+		errs.add(path+".client_platform_type", "client_platform_type must be 1 (IOS), 2 (Android) or 3 (Others), got %d", matchRule.ClientPlatformType)
+	}
+	//地区信息从大到小验证，小的可以不填
+	if matchRule.Province != "" && matchRule.Country == "" {
+		errs.add(path+".country", "country is required when province is set")
+	}
+	if matchRule.City != "" && matchRule.Province == "" {
+		errs.add(path+".province", "province is required when city is set")
+	}
+}
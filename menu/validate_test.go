@@ -0,0 +1,92 @@
+package menu
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateButtons(t *testing.T) {
+	buttons := []*Button{
+		{Type: "click", Name: "今日歌曲", Key: "V1001_TODAY_MUSIC"},
+		{Name: "菜单", SubButtons: []*Button{
+			{Type: "view", Name: "搜索", URL: "http://www.soso.com/"},
+			{Type: "miniprogram", Name: "wxa", URL: "http://mp.weixin.qq.com", AppID: "wx286b93c14bbf93aa", PagePath: "pages/lunar/index"},
+			{Type: "article_id", Name: "文章", ArticleID: "Oj0rs8uDCm4GcOv7wHf_mCcl1zrWSXUeaD3XSK7KBe4"},
+			{Type: "article_view_limited", Name: "文章链接", ArticleID: "Oj0rs8uDCm4GcOv7wHf_mCcl1zrWSXUeaD3XSK7KBe4"},
+		}},
+	}
+	if err := ValidateButtons(buttons); err != nil {
+		t.Fatalf("expected valid menu, got %v", err)
+	}
+	if err := ValidateButtons([]*Button{{Type: "article_id", Name: "文章"}}); err == nil || !strings.Contains(err.Error(), "button[0].article_id") {
+		t.Errorf("expected article_id required error, got %v", err)
+	}
+
+	buttons = []*Button{
+		{Type: "click", Name: strings.Repeat("a", 17), Key: strings.Repeat("k", 129)},
+		{Name: "菜单", SubButtons: []*Button{
+			{Type: "view", Name: "a"},
+			{Type: "view", Name: "b", URL: "http://b"},
+			{Type: "view", Name: "c", URL: "http://c"},
+			{Type: "miniprogram", Name: "d", URL: "http://d"},
+			{Type: "view", Name: "e", URL: "http://e"},
+			{Type: "view", Name: "f", URL: "http://f"},
+		}},
+		{Type: "view", Name: "g", URL: "http://g"},
+		{Type: "view", Name: "h", URL: "http://h"},
+	}
+	err := ValidateButtons(buttons)
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("expected ValidationErrors, got %T %v", err, err)
+	}
+	paths := make(map[string]bool)
+	for _, e := range errs {
+		paths[e.Path] = true
+	}
+	for _, path := range []string{
+		"button",
+		"button[0].name",
+		"button[0].key",
+		"button[1].sub_button",
+		"button[1].sub_button[0].url",
+		"button[1].sub_button[3].appid",
+		"button[1].sub_button[3].pagepath",
+	} {
+		if !paths[path] {
+			t.Errorf("missing error for %s, got %v", path, errs)
+		}
+	}
+	if len(errs) != 7 {
+		t.Errorf("expected 7 errors, got %d: %v", len(errs), errs)
+	}
+}
+
+func TestValidateConditional(t *testing.T) {
+	buttons := []*Button{{Type: "click", Name: "a", Key: "a"}}
+	if err := ValidateConditional(buttons, &MatchRule{TagID: "2"}); err != nil {
+		t.Fatalf("expected valid conditional menu, got %v", err)
+	}
+	if err := ValidateConditional(buttons, nil); err == nil {
+		t.Error("expected error for nil matchrule")
+	}
+	err := ValidateConditional(buttons, &MatchRule{City: "广州", Sex: 3})
+	errs, ok := err.(ValidationErrors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %v", err)
+	}
+}
+
+func TestSpecValidatePath(t *testing.T) {
+	spec := &Spec{
+		Button: []*Button{{Type: "click", Name: "a", Key: "a"}},
+		Conditional: []*ConditionalSpec{
+			{Button: []*Button{{Type: "view", Name: "b"}}, MatchRule: &MatchRule{TagID: "2"}},
+		},
+	}
+	err := spec.Validate()
+	errs, ok := err.(ValidationErrors)
+	if !ok || len(errs) != 1 || errs[0].Path != "conditional[0].button[0].url" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
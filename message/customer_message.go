@@ -1,7 +1,6 @@
 package message
 
 import (
-	"encoding/json"
 	"fmt"
 	"github.com/fintcloud/wechat/context"
 	"github.com/fintcloud/wechat/util"
@@ -9,6 +8,14 @@ import (
 
 const (
 	customerSendMessage = "https://api.weixin.qq.com/cgi-bin/message/custom/send"
+	customerTypingURL   = "https://api.weixin.qq.com/cgi-bin/message/custom/typing"
+)
+
+const (
+	//ErrCodeResponseOutOfTime 回复时间超过限制，用户48小时内未与公众号互动时无法发送客服消息
+	ErrCodeResponseOutOfTime int64 = 45015
+	//ErrCodeNewsCountLimit 图文消息的文章数超过限制
+	ErrCodeNewsCountLimit int64 = 45008
 )
 
 //Manager 消息管理者，可以发送消息
@@ -37,6 +44,18 @@ type CustomerMessage struct {
 	Wxcard          *MediaWxcard          `json:"wxcard,omitempty"`          //可选
 	Msgmenu         *MediaMsgmenu         `json:"msgmenu,omitempty"`         //可选
 	Miniprogrampage *MediaMiniprogrampage `json:"miniprogrampage,omitempty"` //可选
+	Customservice   *MediaCustomservice   `json:"customservice,omitempty"`   //可选, 以某个客服帐号来发消息
+}
+
+//SetKfAccount 以指定客服帐号发送消息，kfAccount 为完整客服帐号
+func (msg *CustomerMessage) SetKfAccount(kfAccount string) {
+	if kfAccount == "" {
+		msg.Customservice = nil
+		return
+	}
+	msg.Customservice = &MediaCustomservice{
+		KfAccount: kfAccount,
+	}
 }
 
 //NewCustomerTextMessage 文本消息结构体构造方法
@@ -72,6 +91,139 @@ func NewCustomerVoiceMessage(toUser, mediaID string) *CustomerMessage {
 	}
 }
 
+//NewCustomerVideoMessage 视频消息的构造方法
+func NewCustomerVideoMessage(toUser, mediaID, thumbMediaID, title, description string) *CustomerMessage {
+	return &CustomerMessage{
+		ToUser:  toUser,
+		Msgtype: MsgTypeVideo,
+		Video: &MediaVideo{
+			MediaID:      mediaID,
+			ThumbMediaID: thumbMediaID,
+			Title:        title,
+			Description:  description,
+		},
+	}
+}
+
+//NewCustomerMusicMessage 音乐消息的构造方法
+func NewCustomerMusicMessage(toUser, title, description, musicURL, hqMusicURL, thumbMediaID string) *CustomerMessage {
+	return &CustomerMessage{
+		ToUser:  toUser,
+		Msgtype: MsgTypeMusic,
+		Music: &MediaMusic{
+			Title:        title,
+			Description:  description,
+			Musicurl:     musicURL,
+			Hqmusicurl:   hqMusicURL,
+			ThumbMediaID: thumbMediaID,
+		},
+	}
+}
+
+//NewCustomerNewsMessage 图文消息（点击跳转到外链）的构造方法，图文消息条数限制在1条以内
+func NewCustomerNewsMessage(toUser string, article MediaArticles) *CustomerMessage {
+	return &CustomerMessage{
+		ToUser:  toUser,
+		Msgtype: MsgTypeNews,
+		News: &MediaNews{
+			Articles: []MediaArticles{article},
+		},
+	}
+}
+
+//NewCustomerMpNewsMessage 图文消息（点击跳转到图文消息页面）的构造方法
+func NewCustomerMpNewsMessage(toUser, mediaID string) *CustomerMessage {
+	return &CustomerMessage{
+		ToUser:  toUser,
+		Msgtype: MsgTypeMpNews,
+		Mpnews: &MediaResource{
+			mediaID,
+		},
+	}
+}
+
+//NewCustomerMsgMenuMessage 菜单消息的构造方法
+func NewCustomerMsgMenuMessage(toUser, headContent string, list []MsgmenuItem, tailContent string) *CustomerMessage {
+	return &CustomerMessage{
+		ToUser:  toUser,
+		Msgtype: MsgTypeMsgMenu,
+		Msgmenu: &MediaMsgmenu{
+			HeadContent: headContent,
+			List:        list,
+			TailContent: tailContent,
+		},
+	}
+}
+
+//NewCustomerWxCardMessage 卡券消息的构造方法
+func NewCustomerWxCardMessage(toUser, cardID string) *CustomerMessage {
+	return &CustomerMessage{
+		ToUser:  toUser,
+		Msgtype: MsgTypeWxCard,
+		Wxcard: &MediaWxcard{
+			CardID: cardID,
+		},
+	}
+}
+
+//NewCustomerMiniprogramPageMessage 小程序卡片消息的构造方法
+func NewCustomerMiniprogramPageMessage(toUser, title, appID, pagePath, thumbMediaID string) *CustomerMessage {
+	return &CustomerMessage{
+		ToUser:  toUser,
+		Msgtype: MsgTypeMiniprogramPage,
+		Miniprogrampage: &MediaMiniprogrampage{
+			Title:        title,
+			Appid:        appID,
+			Pagepath:     pagePath,
+			ThumbMediaID: thumbMediaID,
+		},
+	}
+}
+
+//Validate 校验客服消息的必填字段
+func (msg *CustomerMessage) Validate() error {
+	if msg.ToUser == "" {
+		return fmt.Errorf("customer msg invalid : touser is empty")
+	}
+	var ok bool
+	switch msg.Msgtype {
+	case MsgTypeText:
+		ok = msg.Text != nil && msg.Text.Content != ""
+	case MsgTypeImage:
+		ok = msg.Image != nil && msg.Image.MediaID != ""
+	case MsgTypeVoice:
+		ok = msg.Voice != nil && msg.Voice.MediaID != ""
+	case MsgTypeVideo:
+		ok = msg.Video != nil && msg.Video.MediaID != "" && msg.Video.ThumbMediaID != ""
+	case MsgTypeMusic:
+		ok = msg.Music != nil && msg.Music.Musicurl != "" && msg.Music.Hqmusicurl != "" && msg.Music.ThumbMediaID != ""
+	case MsgTypeNews:
+		if msg.News != nil && len(msg.News.Articles) > 1 {
+			return fmt.Errorf("customer msg invalid : news only supports 1 article, got %d", len(msg.News.Articles))
+		}
+		ok = msg.News != nil && len(msg.News.Articles) == 1 && msg.News.Articles[0].Title != "" && msg.News.Articles[0].URL != ""
+	case MsgTypeMpNews:
+		ok = msg.Mpnews != nil && msg.Mpnews.MediaID != ""
+	case MsgTypeMsgMenu:
+		ok = msg.Msgmenu != nil && len(msg.Msgmenu.List) > 0
+	case MsgTypeWxCard:
+		ok = msg.Wxcard != nil && msg.Wxcard.CardID != ""
+	case MsgTypeMiniprogramPage:
+		ok = msg.Miniprogrampage != nil && msg.Miniprogrampage.Appid != "" && msg.Miniprogrampage.Pagepath != "" && msg.Miniprogrampage.ThumbMediaID != ""
+	default:
+		return fmt.Errorf("customer msg invalid : unsupported msgtype %q", msg.Msgtype)
+	}
+	if !ok {
+		return fmt.Errorf("customer msg invalid : missing required fields for msgtype %q", msg.Msgtype)
+	}
+	return nil
+}
+
+//MediaCustomservice 发送消息使用的客服帐号
+type MediaCustomservice struct {
+	KfAccount string `json:"kf_account"`
+}
+
 //MediaText 文本消息的文字
 type MediaText struct {
 	Content string `json:"content"`
@@ -138,23 +290,48 @@ type MediaMiniprogrampage struct {
 	ThumbMediaID string `json:"thumb_media_id"`
 }
 
-//Send 发送客服消息
+//Send 发送客服消息，用户48小时内未与公众号互动时返回错误码为 ErrCodeResponseOutOfTime 的 *util.APIError
 func (manager *Manager) Send(msg *CustomerMessage) error {
+	if err := msg.Validate(); err != nil {
+		return err
+	}
 	accessToken, err := manager.Context.GetAccessToken()
 	if err != nil {
 		return err
 	}
 	uri := fmt.Sprintf("%s?access_token=%s", customerSendMessage, accessToken)
 	response, err := util.PostJSON(uri, msg)
-	var result util.CommonError
-	err = json.Unmarshal(response, &result)
 	if err != nil {
 		return err
 	}
-	if result.ErrCode != 0 {
-		err = fmt.Errorf("customer msg send error : errcode=%v , errmsg=%v", result.ErrCode, result.ErrMsg)
+	return util.DecodeWithCommonError(response, "SendCustomerMessage")
+}
+
+//reqTyping 客服输入状态请求
+type reqTyping struct {
+	ToUser  string `json:"touser"`
+	Command string `json:"command"`
+}
+
+//Typing 下发“正在输入”状态，24小时内最多20次，每次持续15秒或直到客服发出消息
+func (manager *Manager) Typing(toUser string) error {
+	return manager.setTyping(toUser, "Typing")
+}
+
+//CancelTyping 取消“正在输入”状态
+func (manager *Manager) CancelTyping(toUser string) error {
+	return manager.setTyping(toUser, "CancelTyping")
+}
+
+func (manager *Manager) setTyping(toUser, command string) error {
+	accessToken, err := manager.Context.GetAccessToken()
+	if err != nil {
+		return err
+	}
+	uri := fmt.Sprintf("%s?access_token=%s", customerTypingURL, accessToken)
+	response, err := util.PostJSON(uri, &reqTyping{ToUser: toUser, Command: command})
+	if err != nil {
 		return err
 	}
-
-	return nil
+	return util.DecodeWithCommonError(response, "CustomerTyping")
 }
@@ -34,6 +34,16 @@ const (
 	MsgTypeMusic = "music"
 	//MsgTypeNews 表示图文消息[限回复]
 	MsgTypeNews = "news"
+	//MsgTypeMpNews 表示图文消息（点击跳转到图文消息页面）[限客服消息]
+	MsgTypeMpNews = "mpnews"
+	//MsgTypeMpVideo 表示视频消息[限群发]
+	MsgTypeMpVideo = "mpvideo"
+	//MsgTypeMsgMenu 表示菜单消息[限客服消息]
+	MsgTypeMsgMenu = "msgmenu"
+	//MsgTypeWxCard 表示卡券消息[限客服消息]
+	MsgTypeWxCard = "wxcard"
+	//MsgTypeMiniprogramPage 表示小程序卡片消息[限客服消息]
+	MsgTypeMiniprogramPage = "miniprogrampage"
 	//MsgTypeTransfer 表示消息消息转发到客服
 	MsgTypeTransfer = "transfer_customer_service"
 	//MsgTypeEvent 表示事件推送消息
@@ -67,8 +77,24 @@ const (
 	EventLocationSelect = "location_select"
 	//EventTemplateSendJobFinish 发送模板消息推送通知
 	EventTemplateSendJobFinish = "TEMPLATESENDJOBFINISH"
+	//EventMassSendJobFinish 群发消息发送任务完成推送通知
+	EventMassSendJobFinish = "MASSSENDJOBFINISH"
+	//EventSubscribeMsgPopup 用户在图文等场景内操作订阅通知弹窗
+	EventSubscribeMsgPopup = "subscribe_msg_popup_event"
+	//EventSubscribeMsgChange 用户在服务通知管理页面修改订阅通知状态
+	EventSubscribeMsgChange = "subscribe_msg_change_event"
+	//EventSubscribeMsgSent 发送订阅通知的结果推送
+	EventSubscribeMsgSent = "subscribe_msg_sent_event"
+	//EventPublishJobFinish 发布任务完成推送通知
+	EventPublishJobFinish = "PUBLISHJOBFINISH"
 	//EventWxaMediaCheck 异步校验图片/音频是否含有违法违规内容推送事件
 	EventWxaMediaCheck = "wxa_media_check"
+	//EventKfCreateSession 客服接入会话
+	EventKfCreateSession = "kf_create_session"
+	//EventKfCloseSession 客服关闭会话
+	EventKfCloseSession = "kf_close_session"
+	//EventKfSwitchSession 客服转接会话
+	EventKfSwitchSession = "kf_switch_session"
 )
 
 const (
@@ -112,6 +138,7 @@ type MixMessage struct {
 	MenuID      string    `xml:"MenuId"`
 	Status      string    `xml:"Status"`
 	SessionFrom string    `xml:"SessionFrom"`
+	EventMsgID  int64     `xml:"MsgID"` //模板消息、群发消息等任务完成事件中的消息ID
 
 	ScanCodeInfo struct {
 		ScanType   string `xml:"ScanType"`
@@ -151,6 +178,27 @@ type MixMessage struct {
 	IsRestoreMemberCard int32  `xml:"IsRestoreMemberCard"`
 	UnionID             string `xml:"UnionId"`
 
+	// 群发消息相关
+	TotalCount           int32                `xml:"TotalCount"`
+	FilterCount          int32                `xml:"FilterCount"`
+	SentCount            int32                `xml:"SentCount"`
+	ErrorCount           int32                `xml:"ErrorCount"`
+	CopyrightCheckResult CopyrightCheckResult `xml:"CopyrightCheckResult"`
+	ArticleURLResult     ArticleURLResult     `xml:"ArticleUrlResult"`
+
+	// 发布能力相关
+	PublishEventInfo PublishEventInfo `xml:"PublishEventInfo"`
+
+	// 订阅通知相关
+	SubscribeMsgPopupEvent  []SubscribeMsgPopupEvent  `xml:"SubscribeMsgPopupEvent>List"`
+	SubscribeMsgChangeEvent []SubscribeMsgChangeEvent `xml:"SubscribeMsgChangeEvent>List"`
+	SubscribeMsgSentEvent   []SubscribeMsgSentEvent   `xml:"SubscribeMsgSentEvent>List"`
+
+	// 客服会话相关
+	KfAccount     string `xml:"KfAccount"`
+	FromKfAccount string `xml:"FromKfAccount"`
+	ToKfAccount   string `xml:"ToKfAccount"`
+
 	// 内容审核相关
 	IsRisky       bool   `xml:"isrisky"`
 	ExtraInfoJSON string `xml:"extra_info_json"`
@@ -161,6 +209,76 @@ type MixMessage struct {
 	device.MsgDevice
 }
 
+//CopyrightCheckResult 群发图文消息的原创校验结果
+type CopyrightCheckResult struct {
+	Count      int32                `xml:"Count"`
+	ResultList []CopyrightCheckItem `xml:"ResultList>item"`
+	CheckState int32                `xml:"CheckState"` //整体校验结果，1:未被判为转载，可以群发，2:被判为转载，可以群发，3:被判为转载，不能群发
+}
+
+//CopyrightCheckItem 单篇文章的原创校验结果
+type CopyrightCheckItem struct {
+	ArticleIdx            int32  `xml:"ArticleIdx"`
+	UserDeclareState      int32  `xml:"UserDeclareState"`
+	AuditState            int32  `xml:"AuditState"`
+	OriginalArticleURL    string `xml:"OriginalArticleUrl"`
+	OriginalArticleType   int32  `xml:"OriginalArticleType"`
+	CanReprint            int32  `xml:"CanReprint"`
+	NeedReplaceContent    int32  `xml:"NeedReplaceContent"`
+	NeedShowReprintSource int32  `xml:"NeedShowReprintSource"`
+}
+
+//ArticleURLResult 群发图文消息的文章链接
+type ArticleURLResult struct {
+	Count      int32            `xml:"Count"`
+	ResultList []ArticleURLItem `xml:"ResultList>item"`
+}
+
+//ArticleURLItem 单篇文章的链接
+type ArticleURLItem struct {
+	ArticleIdx int32  `xml:"ArticleIdx"`
+	ArticleURL string `xml:"ArticleUrl"`
+}
+
+//PublishEventInfo 发布任务完成事件的结果
+type PublishEventInfo struct {
+	PublishID     string `xml:"publish_id"`
+	PublishStatus int32  `xml:"publish_status"` //0:成功，2:原创失败，3:常规失败，4:平台审核不通过，5:成功后用户删除所有文章，6:成功后系统封禁所有文章
+	ArticleID     string `xml:"article_id"`
+	ArticleDetail struct {
+		Count int32                     `xml:"count"`
+		Item  []PublishEventArticleItem `xml:"item"`
+	} `xml:"article_detail"`
+	FailIdx []int32 `xml:"fail_idx"` //原创失败或审核不通过的文章编号，从1开始
+}
+
+//PublishEventArticleItem 发布成功的单篇文章
+type PublishEventArticleItem struct {
+	Idx        int32  `xml:"idx"`
+	ArticleURL string `xml:"article_url"`
+}
+
+//SubscribeMsgPopupEvent 订阅通知弹窗事件中的单个模板
+type SubscribeMsgPopupEvent struct {
+	TemplateID            string `xml:"TemplateId"`
+	SubscribeStatusString string `xml:"SubscribeStatusString"` //accept 为同意，reject 为拒绝
+	PopupScene            int32  `xml:"PopupScene"`            //弹窗场景，1 为个人资料页，2 为文章页，3 为JSAPI
+}
+
+//SubscribeMsgChangeEvent 订阅通知状态变更事件中的单个模板
+type SubscribeMsgChangeEvent struct {
+	TemplateID            string `xml:"TemplateId"`
+	SubscribeStatusString string `xml:"SubscribeStatusString"` //reject 为取消订阅
+}
+
+//SubscribeMsgSentEvent 订阅通知发送结果事件中的单个模板
+type SubscribeMsgSentEvent struct {
+	TemplateID  string `xml:"TemplateId"`
+	MsgID       string `xml:"MsgID"`
+	ErrorCode   int32  `xml:"ErrorCode"`   //推送结果状态码，0 表示成功
+	ErrorStatus string `xml:"ErrorStatus"` //推送结果状态码对应的含义
+}
+
 //EventPic 发图事件推送
 type EventPic struct {
 	PicMd5Sum string `xml:"PicMd5Sum"`
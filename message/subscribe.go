@@ -0,0 +1,294 @@
+package message
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/fintcloud/wechat/context"
+	"github.com/fintcloud/wechat/util"
+)
+
+const (
+	subscribeBizSendURL        = "https://api.weixin.qq.com/cgi-bin/message/subscribe/bizsend"
+	subscribeOnceSendURL       = "https://api.weixin.qq.com/cgi-bin/message/template/subscribe"
+	subscribeGetCategoryURL    = "https://api.weixin.qq.com/wxaapi/newtmpl/getcategory"
+	subscribeGetPubTitlesURL   = "https://api.weixin.qq.com/wxaapi/newtmpl/getpubtemplatetitles"
+	subscribeGetPubKeywordsURL = "https://api.weixin.qq.com/wxaapi/newtmpl/getpubtemplatekeywords"
+	subscribeAddTemplateURL    = "https://api.weixin.qq.com/wxaapi/newtmpl/addtemplate"
+	subscribeDelTemplateURL    = "https://api.weixin.qq.com/wxaapi/newtmpl/deltemplate"
+	subscribeGetTemplateURL    = "https://api.weixin.qq.com/wxaapi/newtmpl/gettemplate"
+	subscribeOnceAuthURL       = "https://mp.weixin.qq.com/mp/subscribemsg"
+)
+
+//SubscribeMsg 公众号订阅通知（长期订阅）与一次性订阅消息
+type SubscribeMsg struct {
+	*context.Context
+}
+
+//NewSubscribeMsg 实例化
+func NewSubscribeMsg(context *context.Context) *SubscribeMsg {
+	sub := new(SubscribeMsg)
+	sub.Context = context
+	return sub
+}
+
+//SubscribeMiniProgram 点击消息跳转的小程序
+type SubscribeMiniProgram struct {
+	AppID    string `json:"appid"`
+	PagePath string `json:"pagepath"`
+}
+
+//SubscribeMessage 订阅通知内容
+type SubscribeMessage struct {
+	ToUser      string                `json:"touser"`                // 必须, 接收者OpenID
+	TemplateID  string                `json:"template_id"`           // 必须, 订阅通知模板ID
+	Page        string                `json:"page,omitempty"`        // 可选, 跳转网页时填写
+	MiniProgram *SubscribeMiniProgram `json:"miniprogram,omitempty"` // 可选, 跳转小程序时填写
+	Data        map[string]*DataItem  `json:"data"`                  // 必须, 模板内容
+}
+
+//Send 发送订阅通知
+func (sub *SubscribeMsg) Send(msg *SubscribeMessage) (err error) {
+	var accessToken string
+	accessToken, err = sub.GetAccessToken()
+	if err != nil {
+		return
+	}
+	uri := fmt.Sprintf("%s?access_token=%s", subscribeBizSendURL, accessToken)
+	var response []byte
+	response, err = util.PostJSON(uri, msg)
+	if err != nil {
+		return
+	}
+	return util.DecodeWithCommonError(response, "SendSubscribeMsg")
+}
+
+//OnceMessage 一次性订阅消息内容
+type OnceMessage struct {
+	ToUser      string                `json:"touser"`                // 必须, 接收者OpenID
+	TemplateID  string                `json:"template_id"`           // 必须, 一次性订阅消息模板ID
+	URL         string                `json:"url,omitempty"`         // 可选, 点击消息跳转的链接
+	MiniProgram *SubscribeMiniProgram `json:"miniprogram,omitempty"` // 可选, 跳转小程序
+	Scene       string                `json:"scene"`                 // 必须, 订阅场景值，与授权时的 scene 一致
+	Title       string                `json:"title"`                 // 必须, 消息标题，15字以内
+	Data        struct {
+		Content *DataItem `json:"content"`
+	} `json:"data"` // 必须, 消息正文
+}
+
+//SendOnce 推送一次性订阅消息，用户每次授权只能推送一条
+func (sub *SubscribeMsg) SendOnce(msg *OnceMessage) (err error) {
+	var accessToken string
+	accessToken, err = sub.GetAccessToken()
+	if err != nil {
+		return
+	}
+	uri := fmt.Sprintf("%s?access_token=%s", subscribeOnceSendURL, accessToken)
+	var response []byte
+	response, err = util.PostJSON(uri, msg)
+	if err != nil {
+		return
+	}
+	return util.DecodeWithCommonError(response, "SendOnceSubscribeMsg")
+}
+
+//GetOnceAuthURL 生成一次性订阅消息的授权页面地址
+//
+//scene 为0-10000的场景值，redirectURL 为授权后的回调地址，回调时会带上 openid、template_id、action、scene、reserved 参数
+func (sub *SubscribeMsg) GetOnceAuthURL(scene int, templateID, redirectURL, reserved string) string {
+	q := url.Values{}
+	q.Set("action", "get_confirm")
+	q.Set("appid", sub.AppID)
+	q.Set("scene", strconv.Itoa(scene))
+	q.Set("template_id", templateID)
+	q.Set("redirect_url", redirectURL)
+	if reserved != "" {
+		q.Set("reserved", reserved)
+	}
+	return subscribeOnceAuthURL + "?" + q.Encode() + "#wechat_redirect"
+}
+
+//SubscribeCategory 公众号类目
+type SubscribeCategory struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type resSubscribeCategory struct {
+	util.CommonError
+
+	Data []*SubscribeCategory `json:"data"`
+}
+
+//GetCategory 获取公众号所属类目
+func (sub *SubscribeMsg) GetCategory() (list []*SubscribeCategory, err error) {
+	var res resSubscribeCategory
+	err = sub.get(subscribeGetCategoryURL, nil, &res, "GetSubscribeCategory")
+	if err != nil {
+		return
+	}
+	list = res.Data
+	return
+}
+
+//PubTemplateTitle 公共模板标题
+type PubTemplateTitle struct {
+	Tid        int64  `json:"tid"`        //模板标题 id
+	Title      string `json:"title"`      //模板标题
+	Type       int    `json:"type"`       //模板类型，2 为一次性订阅，3 为长期订阅
+	CategoryID string `json:"categoryId"` //模板所属类目 id
+}
+
+//ResPubTemplateTitles 公共模板标题列表
+type ResPubTemplateTitles struct {
+	util.CommonError
+
+	Count int                 `json:"count"`
+	Data  []*PubTemplateTitle `json:"data"`
+}
+
+//GetPubTemplateTitles 获取类目下的公共模板，categoryIDs 为类目 id，start 从0开始，limit 最大为30
+func (sub *SubscribeMsg) GetPubTemplateTitles(categoryIDs []int64, start, limit int) (res *ResPubTemplateTitles, err error) {
+	ids := make([]string, 0, len(categoryIDs))
+	for _, id := range categoryIDs {
+		ids = append(ids, strconv.FormatInt(id, 10))
+	}
+	q := url.Values{}
+	q.Set("ids", strings.Join(ids, ","))
+	q.Set("start", strconv.Itoa(start))
+	q.Set("limit", strconv.Itoa(limit))
+	res = new(ResPubTemplateTitles)
+	err = sub.get(subscribeGetPubTitlesURL, q, res, "GetPubTemplateTitles")
+	return
+}
+
+//PubTemplateKeyword 公共模板关键词
+type PubTemplateKeyword struct {
+	Kid     int64  `json:"kid"`     //关键词 id，选用模板时需要
+	Name    string `json:"name"`    //关键词内容
+	Example string `json:"example"` //关键词内容对应的示例
+	Rule    string `json:"rule"`    //参数类型
+}
+
+type resPubTemplateKeywords struct {
+	util.CommonError
+
+	Count int                   `json:"count"`
+	Data  []*PubTemplateKeyword `json:"data"`
+}
+
+//GetPubTemplateKeywords 获取模板标题下的关键词
+func (sub *SubscribeMsg) GetPubTemplateKeywords(tid int64) (list []*PubTemplateKeyword, err error) {
+	q := url.Values{}
+	q.Set("tid", strconv.FormatInt(tid, 10))
+	var res resPubTemplateKeywords
+	err = sub.get(subscribeGetPubKeywordsURL, q, &res, "GetPubTemplateKeywords")
+	if err != nil {
+		return
+	}
+	list = res.Data
+	return
+}
+
+type reqAddSubscribeTemplate struct {
+	Tid       string  `json:"tid"`
+	KidList   []int64 `json:"kidList"`
+	SceneDesc string  `json:"sceneDesc,omitempty"`
+}
+
+type resAddSubscribeTemplate struct {
+	util.CommonError
+
+	PriTmplID string `json:"priTmplId"`
+}
+
+//AddTemplate 从公共模板库中选用模板，kidList 为关键词 id 列表（最多5个），返回私有模板 id
+func (sub *SubscribeMsg) AddTemplate(tid int64, kidList []int64, sceneDesc string) (priTmplID string, err error) {
+	req := &reqAddSubscribeTemplate{
+		Tid:       strconv.FormatInt(tid, 10),
+		KidList:   kidList,
+		SceneDesc: sceneDesc,
+	}
+	var res resAddSubscribeTemplate
+	err = sub.post(subscribeAddTemplateURL, req, &res, "AddSubscribeTemplate")
+	if err != nil {
+		return
+	}
+	priTmplID = res.PriTmplID
+	return
+}
+
+//DeleteTemplate 删除私有模板
+func (sub *SubscribeMsg) DeleteTemplate(priTmplID string) error {
+	var res struct {
+		util.CommonError
+	}
+	return sub.post(subscribeDelTemplateURL, map[string]string{"priTmplId": priTmplID}, &res, "DeleteSubscribeTemplate")
+}
+
+//SubscribeTemplate 帐号下的私有模板
+type SubscribeTemplate struct {
+	PriTmplID string `json:"priTmplId"` //私有模板 id
+	Title     string `json:"title"`     //模板标题
+	Content   string `json:"content"`   //模板内容，格式同模板消息，如 {{thing1.DATA}}
+	Example   string `json:"example"`   //模板内容示例
+	Type      int    `json:"type"`      //模板类型，2 为一次性订阅，3 为长期订阅
+}
+
+//TemplateItem 转换为 TemplateItem，可用于解析占位符和校验消息内容
+func (tpl *SubscribeTemplate) TemplateItem() *TemplateItem {
+	return &TemplateItem{
+		TemplateID: tpl.PriTmplID,
+		Title:      tpl.Title,
+		Content:    tpl.Content,
+		Example:    tpl.Example,
+	}
+}
+
+type resSubscribeTemplateList struct {
+	util.CommonError
+
+	Data []*SubscribeTemplate `json:"data"`
+}
+
+//ListTemplate 获取帐号下的私有模板列表
+func (sub *SubscribeMsg) ListTemplate() (list []*SubscribeTemplate, err error) {
+	var res resSubscribeTemplateList
+	err = sub.get(subscribeGetTemplateURL, nil, &res, "ListSubscribeTemplate")
+	if err != nil {
+		return
+	}
+	list = res.Data
+	return
+}
+
+func (sub *SubscribeMsg) get(urlStr string, q url.Values, res interface{}, apiName string) error {
+	accessToken, err := sub.GetAccessToken()
+	if err != nil {
+		return err
+	}
+	if q == nil {
+		q = url.Values{}
+	}
+	q.Set("access_token", accessToken)
+	response, err := util.HTTPGet(urlStr + "?" + q.Encode())
+	if err != nil {
+		return err
+	}
+	return util.DecodeWithError(response, res, apiName)
+}
+
+func (sub *SubscribeMsg) post(urlStr string, req, res interface{}, apiName string) error {
+	accessToken, err := sub.GetAccessToken()
+	if err != nil {
+		return err
+	}
+	uri := fmt.Sprintf("%s?access_token=%s", urlStr, accessToken)
+	response, err := util.PostJSON(uri, req)
+	if err != nil {
+		return err
+	}
+	return util.DecodeWithError(response, res, apiName)
+}
@@ -1,17 +1,27 @@
 package message
 
 import (
-	"encoding/json"
 	"fmt"
+	"regexp"
+	"sort"
+	"strings"
 
 	"github.com/fintcloud/wechat/context"
 	"github.com/fintcloud/wechat/util"
 )
 
 const (
-	templateSendURL = "https://api.weixin.qq.com/cgi-bin/message/template/send"
+	templateSendURL        = "https://api.weixin.qq.com/cgi-bin/message/template/send"
+	templateSetIndustryURL = "https://api.weixin.qq.com/cgi-bin/template/api_set_industry"
+	templateGetIndustryURL = "https://api.weixin.qq.com/cgi-bin/template/get_industry"
+	templateAddURL         = "https://api.weixin.qq.com/cgi-bin/template/api_add_template"
+	templateListURL        = "https://api.weixin.qq.com/cgi-bin/template/get_all_private_template"
+	templateDelURL         = "https://api.weixin.qq.com/cgi-bin/template/del_private_template"
 )
 
+//placeholderRegexp 匹配模板内容中的 {{key.DATA}}
+var placeholderRegexp = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_]+)\.DATA\s*\}\}`)
+
 //Template 模板消息
 type Template struct {
 	*context.Context
@@ -50,25 +60,271 @@ type resTemplateSend struct {
 	MsgID int64 `json:"msgid"`
 }
 
-//Send 发送模板消息
+//Send 发送模板消息，微信返回错误时 err 为 *util.APIError
 func (tpl *Template) Send(msg *Message) (msgID int64, err error) {
 	var accessToken string
 	accessToken, err = tpl.GetAccessToken()
 	if err != nil {
 		return
 	}
+	return tpl.send(accessToken, msg)
+}
+
+//send 使用指定的 access_token 发送，供 BulkSender 在 access_token 失效时判断是否需要刷新
+func (tpl *Template) send(accessToken string, msg *Message) (msgID int64, err error) {
 	uri := fmt.Sprintf("%s?access_token=%s", templateSendURL, accessToken)
-	response, err := util.PostJSON(uri, msg)
+	var response []byte
+	response, err = util.PostJSON(uri, msg)
+	if err != nil {
+		return
+	}
 
 	var result resTemplateSend
-	err = json.Unmarshal(response, &result)
+	err = util.DecodeWithError(response, &result, "SendTemplate")
+	if err != nil {
+		return
+	}
+	msgID = result.MsgID
+	return
+}
+
+//Industry 模板消息所属行业
+type Industry struct {
+	FirstClass  string `json:"first_class"`
+	SecondClass string `json:"second_class"`
+}
+
+//ResIndustry 获取设置的行业信息返回结果
+type ResIndustry struct {
+	util.CommonError
+
+	PrimaryIndustry   Industry `json:"primary_industry"`
+	SecondaryIndustry Industry `json:"secondary_industry"`
+}
+
+type reqSetIndustry struct {
+	IndustryID1 string `json:"industry_id1"`
+	IndustryID2 string `json:"industry_id2"`
+}
+
+//SetIndustry 设置所属行业，行业代码参考微信文档，每月可修改行业1次
+func (tpl *Template) SetIndustry(industryID1, industryID2 string) (err error) {
+	var accessToken string
+	accessToken, err = tpl.GetAccessToken()
 	if err != nil {
 		return
 	}
-	if result.ErrCode != 0 {
-		err = fmt.Errorf("template msg send error : errcode=%v , errmsg=%v", result.ErrCode, result.ErrMsg)
+	uri := fmt.Sprintf("%s?access_token=%s", templateSetIndustryURL, accessToken)
+	var response []byte
+	response, err = util.PostJSON(uri, &reqSetIndustry{industryID1, industryID2})
+	if err != nil {
 		return
 	}
-	msgID = result.MsgID
+	return util.DecodeWithCommonError(response, "SetIndustry")
+}
+
+//GetIndustry 获取设置的行业信息
+func (tpl *Template) GetIndustry() (industry *ResIndustry, err error) {
+	var accessToken string
+	accessToken, err = tpl.GetAccessToken()
+	if err != nil {
+		return
+	}
+	uri := fmt.Sprintf("%s?access_token=%s", templateGetIndustryURL, accessToken)
+	var response []byte
+	response, err = util.HTTPGet(uri)
+	if err != nil {
+		return
+	}
+	industry = new(ResIndustry)
+	err = util.DecodeWithError(response, industry, "GetIndustry")
+	return
+}
+
+type reqAddTemplate struct {
+	TemplateIDShort string   `json:"template_id_short"`
+	KeywordNameList []string `json:"keyword_name_list,omitempty"`
+}
+
+type resAddTemplate struct {
+	util.CommonError
+
+	TemplateID string `json:"template_id"`
+}
+
+//AddTemplate 通过模板库中的编号获得模板ID，keywordNames 为选用的关键词名称，可选
+func (tpl *Template) AddTemplate(templateIDShort string, keywordNames ...string) (templateID string, err error) {
+	var accessToken string
+	accessToken, err = tpl.GetAccessToken()
+	if err != nil {
+		return
+	}
+	uri := fmt.Sprintf("%s?access_token=%s", templateAddURL, accessToken)
+	var response []byte
+	response, err = util.PostJSON(uri, &reqAddTemplate{templateIDShort, keywordNames})
+	if err != nil {
+		return
+	}
+	var result resAddTemplate
+	err = util.DecodeWithError(response, &result, "AddTemplate")
+	if err != nil {
+		return
+	}
+	templateID = result.TemplateID
 	return
 }
+
+//TemplateItem 已添加至帐号下的模板
+type TemplateItem struct {
+	TemplateID      string `json:"template_id"`
+	Title           string `json:"title"`
+	PrimaryIndustry string `json:"primary_industry"`
+	DeputyIndustry  string `json:"deputy_industry"`
+	Content         string `json:"content"`
+	Example         string `json:"example"`
+}
+
+//Placeholder 模板内容中的一个 {{key.DATA}} 占位符
+type Placeholder struct {
+	Key   string //占位符名称，即 Message.Data 的 key
+	Label string //占位符所在行中位于其前面的文字，例如 "商品名称："
+}
+
+//Placeholders 按出现顺序解析模板内容中的占位符
+func (item *TemplateItem) Placeholders() []Placeholder {
+	placeholders := make([]Placeholder, 0)
+	for _, line := range strings.Split(item.Content, "\n") {
+		last := 0
+		for _, loc := range placeholderRegexp.FindAllStringSubmatchIndex(line, -1) {
+			placeholders = append(placeholders, Placeholder{
+				Key:   line[loc[2]:loc[3]],
+				Label: strings.TrimSpace(line[last:loc[0]]),
+			})
+			last = loc[1]
+		}
+	}
+	return placeholders
+}
+
+//Keys 返回模板内容中所有占位符的名称
+func (item *TemplateItem) Keys() []string {
+	placeholders := item.Placeholders()
+	keys := make([]string, 0, len(placeholders))
+	for _, p := range placeholders {
+		keys = append(keys, p.Key)
+	}
+	return keys
+}
+
+//ExampleValues 将模板示例按行与内容对应，解析出每个占位符的示例值
+//
+//仅处理每行只包含一个占位符的情况，无法对应的占位符不会出现在返回结果中
+func (item *TemplateItem) ExampleValues() map[string]string {
+	values := make(map[string]string)
+	contentLines := strings.Split(strings.TrimSpace(item.Content), "\n")
+	exampleLines := strings.Split(strings.TrimSpace(item.Example), "\n")
+	if len(contentLines) != len(exampleLines) {
+		return values
+	}
+	for i, line := range contentLines {
+		matches := placeholderRegexp.FindAllStringSubmatchIndex(line, -1)
+		if len(matches) != 1 {
+			continue
+		}
+		prefix := line[:matches[0][0]]
+		suffix := line[matches[0][1]:]
+		example := exampleLines[i]
+		if !strings.HasPrefix(example, prefix) || !strings.HasSuffix(example, suffix) || len(example) < len(prefix)+len(suffix) {
+			continue
+		}
+		values[line[matches[0][2]:matches[0][3]]] = example[len(prefix) : len(example)-len(suffix)]
+	}
+	return values
+}
+
+//Validate 校验模板消息的 Data 是否与模板的占位符一致
+func (item *TemplateItem) Validate(msg *Message) error {
+	if msg.TemplateID != "" && msg.TemplateID != item.TemplateID {
+		return fmt.Errorf("template msg invalid : template_id mismatch, want %s got %s", item.TemplateID, msg.TemplateID)
+	}
+	keys := make(map[string]bool)
+	var missing, unknown []string
+	for _, key := range item.Keys() {
+		keys[key] = true
+		if data, ok := msg.Data[key]; !ok || data == nil {
+			missing = append(missing, key)
+		}
+	}
+	for key := range msg.Data {
+		if !keys[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(missing) == 0 && len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	return fmt.Errorf("template msg invalid : missing data %v , unknown data %v", missing, unknown)
+}
+
+type resTemplateList struct {
+	util.CommonError
+
+	TemplateList []*TemplateItem `json:"template_list"`
+}
+
+//List 获取已添加至帐号下所有模板列表
+func (tpl *Template) List() (list []*TemplateItem, err error) {
+	var accessToken string
+	accessToken, err = tpl.GetAccessToken()
+	if err != nil {
+		return
+	}
+	uri := fmt.Sprintf("%s?access_token=%s", templateListURL, accessToken)
+	var response []byte
+	response, err = util.HTTPGet(uri)
+	if err != nil {
+		return
+	}
+	var result resTemplateList
+	err = util.DecodeWithError(response, &result, "ListTemplate")
+	if err != nil {
+		return
+	}
+	list = result.TemplateList
+	return
+}
+
+//Get 根据模板ID从模板列表中获取模板
+func (tpl *Template) Get(templateID string) (*TemplateItem, error) {
+	list, err := tpl.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range list {
+		if item.TemplateID == templateID {
+			return item, nil
+		}
+	}
+	return nil, fmt.Errorf("template %s not found", templateID)
+}
+
+type reqDeleteTemplate struct {
+	TemplateID string `json:"template_id"`
+}
+
+//Delete 删除模板
+func (tpl *Template) Delete(templateID string) (err error) {
+	var accessToken string
+	accessToken, err = tpl.GetAccessToken()
+	if err != nil {
+		return
+	}
+	uri := fmt.Sprintf("%s?access_token=%s", templateDelURL, accessToken)
+	var response []byte
+	response, err = util.PostJSON(uri, &reqDeleteTemplate{templateID})
+	if err != nil {
+		return
+	}
+	return util.DecodeWithCommonError(response, "DeleteTemplate")
+}
@@ -0,0 +1,243 @@
+package message
+
+import (
+	icontext "context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fintcloud/wechat/util"
+)
+
+const (
+	//ErrCodeSystemBusy 系统繁忙，可重试
+	ErrCodeSystemBusy int64 = -1
+	//ErrCodeInvalidAccessToken access_token 无效
+	ErrCodeInvalidAccessToken int64 = 40001
+	//ErrCodeInvalidOpenID 不合法的 openid
+	ErrCodeInvalidOpenID int64 = 40003
+	//ErrCodeAccessTokenExpired access_token 超时
+	ErrCodeAccessTokenExpired int64 = 42001
+	//ErrCodeUserUnsubscribed 用户未关注公众号
+	ErrCodeUserUnsubscribed int64 = 43004
+	//ErrCodeAPIQuotaLimit 接口调用超过每日限额
+	ErrCodeAPIQuotaLimit int64 = 45009
+	//ErrCodeAPIFreqLimit 接口调用频率超过限制
+	ErrCodeAPIFreqLimit int64 = 45011
+)
+
+//ErrBulkAborted 接口每日调用额度用尽后，剩余的消息不再发送
+var ErrBulkAborted = errors.New("bulk send aborted: api daily quota exhausted")
+
+//BulkOpts 批量发送模板消息的配置
+type BulkOpts struct {
+	Workers       int           //并发数，默认10
+	QPS           int           //每秒最多发送的请求数，默认50，小于0时不限制
+	MaxRetries    int           //临时错误的最大重试次数，默认3，小于0时不重试
+	RetryInterval time.Duration //首次重试的等待时间，之后每次翻倍，默认1秒
+	TrackTTL      time.Duration //msgid 与接收者的对应关系在 Cache 中的保存时间，默认24小时
+}
+
+//BulkResult 单个接收者的发送结果
+type BulkResult struct {
+	Message  *Message
+	MsgID    int64 //发送成功时返回的msgid，用于关联 TEMPLATESENDJOBFINISH 事件
+	Attempts int   //实际请求次数
+	Err      error
+}
+
+//Delivery 模板消息的最终送达状态，由 TEMPLATESENDJOBFINISH 事件得到
+type Delivery struct {
+	MsgID   int64
+	ToUser  string
+	Status  string //success, failed:user block, failed: system failed
+	Tracked bool   //该msgid是否由 BulkSender 发送并记录
+}
+
+//Success 是否送达成功
+func (d *Delivery) Success() bool {
+	return d.Status == "success"
+}
+
+//BulkSender 模板消息批量发送，限制并发与频率，重试临时错误并跳过永久错误
+type BulkSender struct {
+	tpl  *Template
+	opts BulkOpts
+	send func(accessToken string, msg *Message) (int64, error)
+}
+
+//NewBulkSender 实例化批量发送，opts 为 nil 时使用默认配置
+func (tpl *Template) NewBulkSender(opts *BulkOpts) *BulkSender {
+	sender := &BulkSender{tpl: tpl, send: tpl.send}
+	if opts != nil {
+		sender.opts = *opts
+	}
+	if sender.opts.Workers <= 0 {
+		sender.opts.Workers = 10
+	}
+	if sender.opts.QPS == 0 {
+		sender.opts.QPS = 50
+	}
+	if sender.opts.MaxRetries == 0 {
+		sender.opts.MaxRetries = 3
+	}
+	if sender.opts.RetryInterval <= 0 {
+		sender.opts.RetryInterval = time.Second
+	}
+	if sender.opts.TrackTTL <= 0 {
+		sender.opts.TrackTTL = 24 * time.Hour
+	}
+	return sender
+}
+
+//Send 从 msgs 中读取消息并发送，每条消息对应一个结果，所有消息处理完成后关闭返回的 channel
+//
+//调用方需要持续读取结果，ctx 取消或额度用尽后，剩余消息会立即返回带错误的结果
+func (sender *BulkSender) Send(ctx icontext.Context, msgs <-chan *Message) <-chan *BulkResult {
+	results := make(chan *BulkResult, sender.opts.Workers)
+
+	var ticker *time.Ticker
+	var limiter <-chan time.Time
+	if sender.opts.QPS > 0 {
+		ticker = time.NewTicker(time.Second / time.Duration(sender.opts.QPS))
+		limiter = ticker.C
+	}
+	aborted := make(chan struct{})
+	var abortOnce sync.Once
+	abort := func() {
+		abortOnce.Do(func() {
+			close(aborted)
+		})
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < sender.opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for msg := range msgs {
+				results <- sender.sendOne(ctx, msg, limiter, aborted, abort)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		if ticker != nil {
+			ticker.Stop()
+		}
+		close(results)
+	}()
+	return results
+}
+
+func (sender *BulkSender) sendOne(ctx icontext.Context, msg *Message, limiter <-chan time.Time, aborted <-chan struct{}, abort func()) *BulkResult {
+	res := &BulkResult{Message: msg}
+	for {
+		select {
+		case <-ctx.Done():
+			res.Err = ctx.Err()
+			return res
+		case <-aborted:
+			res.Err = ErrBulkAborted
+			return res
+		default:
+		}
+		if limiter != nil {
+			select {
+			case <-limiter:
+			case <-ctx.Done():
+				res.Err = ctx.Err()
+				return res
+			case <-aborted:
+				res.Err = ErrBulkAborted
+				return res
+			}
+		}
+
+		accessToken, err := sender.tpl.GetAccessToken()
+		if err != nil {
+			res.Err = err
+			return res
+		}
+		res.Attempts++
+		res.MsgID, res.Err = sender.send(accessToken, msg)
+		if res.Err == nil {
+			sender.track(res.MsgID, msg.ToUser)
+			return res
+		}
+		if util.IsErrCode(res.Err, ErrCodeAPIQuotaLimit) {
+			abort()
+			return res
+		}
+		if !isTransientError(res.Err) || res.Attempts > sender.opts.MaxRetries {
+			return res
+		}
+		if util.IsErrCode(res.Err, ErrCodeInvalidAccessToken, ErrCodeAccessTokenExpired) {
+			//缓存中的 access_token 已失效，多个 worker 同时遇到时只刷新一次
+			if _, err := sender.tpl.RefreshAccessToken(accessToken); err != nil {
+				res.Err = fmt.Errorf("refresh access_token: %w", err)
+				return res
+			}
+		}
+
+		wait := sender.opts.RetryInterval << uint(res.Attempts-1)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			res.Err = ctx.Err()
+			return res
+		case <-aborted:
+			timer.Stop()
+			res.Err = ErrBulkAborted
+			return res
+		}
+	}
+}
+
+//isTransientError 网络错误和系统繁忙、频率限制、access_token 失效可以重试，其他错误（如 43004、40003）不再重试
+func isTransientError(err error) bool {
+	var apiErr *util.APIError
+	if !errors.As(err, &apiErr) {
+		return true
+	}
+	return util.IsErrCode(err, ErrCodeSystemBusy, ErrCodeAPIFreqLimit, ErrCodeInvalidAccessToken, ErrCodeAccessTokenExpired)
+}
+
+func templateMsgCacheKey(appID string, msgID int64) string {
+	return fmt.Sprintf("template_msg_%s_%d", appID, msgID)
+}
+
+func (sender *BulkSender) track(msgID int64, toUser string) {
+	if sender.tpl.Cache == nil {
+		return
+	}
+	sender.tpl.Cache.Set(templateMsgCacheKey(sender.tpl.AppID, msgID), toUser, sender.opts.TrackTTL)
+}
+
+//HandleJobFinish 处理 TEMPLATESENDJOBFINISH 事件，得到对应消息的最终送达状态
+//
+//在 server.SetMessageHandler 中调用，非该事件时 ok 为 false
+func (sender *BulkSender) HandleJobFinish(msg MixMessage) (delivery *Delivery, ok bool) {
+	if msg.MsgType != MsgTypeEvent || msg.Event != EventTemplateSendJobFinish {
+		return nil, false
+	}
+	delivery = &Delivery{
+		MsgID:  msg.EventMsgID,
+		ToUser: string(msg.FromUserName),
+		Status: msg.Status,
+	}
+	if sender.tpl.Cache != nil {
+		key := templateMsgCacheKey(sender.tpl.AppID, msg.EventMsgID)
+		if toUser, exists := sender.tpl.Cache.Get(key).(string); exists {
+			delivery.Tracked = true
+			if toUser != "" {
+				delivery.ToUser = toUser
+			}
+			sender.tpl.Cache.Delete(key)
+		}
+	}
+	return delivery, true
+}
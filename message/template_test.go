@@ -0,0 +1,219 @@
+package message
+
+import (
+	icontext "context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fintcloud/wechat/cache"
+	"github.com/fintcloud/wechat/context"
+	"github.com/fintcloud/wechat/util"
+)
+
+var testTemplate = &TemplateItem{
+	TemplateID: "iPk5sOIt5X_flOVKn5GrTFpncEYTojx6ddbt8WYoV5s",
+	Title:      "领取奖金提醒",
+	Content:    "{{result.DATA}}\n\n领奖金额:{{withdrawMoney.DATA}}\n领奖  时间:    {{withdrawTime.DATA}}\n银行信息:{{cardInfo.DATA}}\n到账时间:  {{arrivedTime.DATA}}\n{{remark.DATA}}",
+	Example:    "您已提交领奖申请\n\n领奖金额：xxxx元\n领奖时间：2013-10-10 12:22:22\n银行信息：xx银行(尾号xxxx)\n到账时间：预计xxxxxxx\n\n预计将于xxxx到达您的银行卡",
+}
+
+func TestTemplateItemKeys(t *testing.T) {
+	want := []string{"result", "withdrawMoney", "withdrawTime", "cardInfo", "arrivedTime", "remark"}
+	if keys := testTemplate.Keys(); !reflect.DeepEqual(keys, want) {
+		t.Errorf("Keys Error , got %v", keys)
+	}
+	placeholders := testTemplate.Placeholders()
+	if placeholders[1].Label != "领奖金额:" {
+		t.Errorf("Placeholders Error , got label %q", placeholders[1].Label)
+	}
+}
+
+func TestTemplateItemExampleValues(t *testing.T) {
+	item := &TemplateItem{
+		Content: "{{first.DATA}}\n商品名称：{{product.DATA}}\n{{remark.DATA}}",
+		Example: "您好，您已购买成功。\n商品名称：微信影城影票\n欢迎再次购买！",
+	}
+	want := map[string]string{
+		"first":   "您好，您已购买成功。",
+		"product": "微信影城影票",
+		"remark":  "欢迎再次购买！",
+	}
+	if values := item.ExampleValues(); !reflect.DeepEqual(values, want) {
+		t.Errorf("ExampleValues Error , got %v", values)
+	}
+}
+
+func TestTemplateItemValidate(t *testing.T) {
+	msg := &Message{
+		TemplateID: testTemplate.TemplateID,
+		Data: map[string]*DataItem{
+			"result":        {Value: "ok"},
+			"withdrawMoney": {Value: "1"},
+			"withdrawTime":  {Value: "now"},
+			"cardInfo":      {Value: "card"},
+			"arrivedTime":   {Value: "soon"},
+			"remark":        {Value: "thanks"},
+		},
+	}
+	if err := testTemplate.Validate(msg); err != nil {
+		t.Errorf("Validate Error , err=%v", err)
+	}
+
+	delete(msg.Data, "remark")
+	msg.Data["remakr"] = &DataItem{Value: "typo"}
+	if err := testTemplate.Validate(msg); err == nil {
+		t.Error("Validate should fail with missing and unknown data")
+	}
+}
+
+func newTestBulkSender(opts *BulkOpts) *BulkSender {
+	ctx := &context.Context{AppID: "wx_test", Cache: cache.NewMemory()}
+	ctx.SetAccessTokenLock(new(sync.RWMutex))
+	ctx.Cache.Set("access_token_wx_test", "token1", time.Hour)
+	return NewTemplate(ctx).NewBulkSender(opts)
+}
+
+func sendAll(sender *BulkSender, toUsers ...string) []*BulkResult {
+	msgs := make(chan *Message)
+	go func() {
+		for _, toUser := range toUsers {
+			msgs <- &Message{ToUser: toUser}
+		}
+		close(msgs)
+	}()
+	var results []*BulkResult
+	for res := range sender.Send(icontext.Background(), msgs) {
+		results = append(results, res)
+	}
+	return results
+}
+
+func TestBulkSenderRetryBackoff(t *testing.T) {
+	interval := 20 * time.Millisecond
+	sender := newTestBulkSender(&BulkOpts{Workers: 1, QPS: -1, MaxRetries: 2, RetryInterval: interval})
+	var calls []time.Time
+	sender.send = func(accessToken string, msg *Message) (int64, error) {
+		calls = append(calls, time.Now())
+		return 0, &util.APIError{APIName: "SendTemplate", ErrCode: ErrCodeSystemBusy}
+	}
+
+	results := sendAll(sender, "openid1")
+	if len(results) != 1 || results[0].Attempts != 3 || !util.IsErrCode(results[0].Err, ErrCodeSystemBusy) {
+		t.Fatalf("unexpected result %+v", results[0])
+	}
+	for i, want := range []time.Duration{interval, 2 * interval} {
+		if gap := calls[i+1].Sub(calls[i]); gap < want {
+			t.Errorf("retry %d waited %v, want at least %v", i+1, gap, want)
+		}
+	}
+}
+
+func TestBulkSenderPermanentError(t *testing.T) {
+	sender := newTestBulkSender(&BulkOpts{Workers: 1, QPS: -1, RetryInterval: time.Millisecond})
+	sender.send = func(accessToken string, msg *Message) (int64, error) {
+		return 0, &util.APIError{APIName: "SendTemplate", ErrCode: ErrCodeUserUnsubscribed}
+	}
+	results := sendAll(sender, "openid1")
+	if results[0].Attempts != 1 {
+		t.Errorf("permanent error should not be retried, attempts=%d", results[0].Attempts)
+	}
+}
+
+func TestBulkSenderQuotaAbort(t *testing.T) {
+	sender := newTestBulkSender(&BulkOpts{Workers: 1, QPS: -1})
+	calls := 0
+	sender.send = func(accessToken string, msg *Message) (int64, error) {
+		calls++
+		return 0, &util.APIError{APIName: "SendTemplate", ErrCode: ErrCodeAPIQuotaLimit}
+	}
+
+	results := sendAll(sender, "openid1", "openid2", "openid3")
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+	if !util.IsErrCode(results[0].Err, ErrCodeAPIQuotaLimit) {
+		t.Errorf("first result err=%v", results[0].Err)
+	}
+	for _, res := range results[1:] {
+		if res.Err != ErrBulkAborted || res.Attempts != 0 {
+			t.Errorf("%s: err=%v attempts=%d, want aborted", res.Message.ToUser, res.Err, res.Attempts)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("send called %d times after quota exhausted", calls)
+	}
+}
+
+func TestBulkSenderTokenRefresh(t *testing.T) {
+	sender := newTestBulkSender(&BulkOpts{Workers: 1, QPS: -1, RetryInterval: time.Millisecond})
+	var tokens []string
+	sender.send = func(accessToken string, msg *Message) (int64, error) {
+		tokens = append(tokens, accessToken)
+		if accessToken == "token1" {
+			//模拟其他 worker 已经刷新了 access_token
+			sender.tpl.Cache.Set("access_token_wx_test", "token2", time.Hour)
+			return 0, &util.APIError{APIName: "SendTemplate", ErrCode: ErrCodeInvalidAccessToken}
+		}
+		return 1, nil
+	}
+
+	results := sendAll(sender, "openid1")
+	if results[0].Err != nil || !reflect.DeepEqual(tokens, []string{"token1", "token2"}) {
+		t.Errorf("err=%v tokens=%v", results[0].Err, tokens)
+	}
+
+	//设置了自定义获取方式时，刷新交由 GetAccessTokenFunc 处理
+	refreshed := 0
+	sender.tpl.SetGetAccessTokenFunc(func(ctx *context.Context) (string, error) {
+		refreshed++
+		return fmt.Sprintf("custom%d", refreshed), nil
+	})
+	tokens = nil
+	sender.send = func(accessToken string, msg *Message) (int64, error) {
+		tokens = append(tokens, accessToken)
+		if len(tokens) == 1 {
+			return 0, &util.APIError{APIName: "SendTemplate", ErrCode: ErrCodeAccessTokenExpired}
+		}
+		return 1, nil
+	}
+	results = sendAll(sender, "openid1")
+	if results[0].Err != nil || refreshed != 3 || !reflect.DeepEqual(tokens, []string{"custom1", "custom3"}) {
+		t.Errorf("custom access token func: err=%v refreshed=%d tokens=%v", results[0].Err, refreshed, tokens)
+	}
+}
+
+func TestBulkSenderHandleJobFinish(t *testing.T) {
+	sender := newTestBulkSender(&BulkOpts{Workers: 1, QPS: -1})
+	sender.send = func(accessToken string, msg *Message) (int64, error) {
+		return 1001, nil
+	}
+	sendAll(sender, "openid1")
+
+	event := MixMessage{EventMsgID: 1001, Status: "success"}
+	event.MsgType = MsgTypeEvent
+	event.Event = EventTemplateSendJobFinish
+	event.FromUserName = "openid_from_event"
+	delivery, ok := sender.HandleJobFinish(event)
+	if !ok || !delivery.Tracked || delivery.ToUser != "openid1" || !delivery.Success() {
+		t.Fatalf("unexpected delivery %+v", delivery)
+	}
+	if delivery, _ = sender.HandleJobFinish(event); delivery.Tracked {
+		t.Error("tracked msgid should be removed after the event is handled")
+	}
+
+	other := newTestBulkSender(nil)
+	other.tpl.AppID = "wx_other"
+	other.tpl.Cache = sender.tpl.Cache
+	sender.track(2002, "openid2")
+	event.EventMsgID = 2002
+	if delivery, _ = other.HandleJobFinish(event); delivery.Tracked {
+		t.Error("msgid tracked by another appid should not match")
+	}
+
+	if _, ok = sender.HandleJobFinish(MixMessage{}); ok {
+		t.Error("non TEMPLATESENDJOBFINISH message should be ignored")
+	}
+}
@@ -0,0 +1,146 @@
+package pay
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/fintcloud/wechat/util"
+)
+
+const (
+	downloadBillPath     = "/pay/downloadbill"
+	downloadFundFlowPath = "/pay/downloadfundflow"
+)
+
+//账单类型 bill_type
+const (
+	BillTypeAll            = "ALL"
+	BillTypeSuccess        = "SUCCESS"
+	BillTypeRefund         = "REFUND"
+	BillTypeRechargeRefund = "RECHARGE_REFUND"
+)
+
+//资金账户类型 account_type
+const (
+	AccountTypeBasic     = "Basic"
+	AccountTypeOperation = "Operation"
+	AccountTypeFees      = "Fees"
+)
+
+//TarTypeGZIP 压缩账单
+const TarTypeGZIP = "GZIP"
+
+//ErrCodeNoBillExist 账单不存在时返回的 error_code
+const ErrCodeNoBillExist = "20002"
+
+//DownloadBillRequest 下载交易账单参数
+type DownloadBillRequest struct {
+	BillDate string //格式为 20140603
+	BillType string //为空时为 ALL
+	TarType  string //为 GZIP 时下载压缩账单，返回的内容已经解压
+	SignType string
+}
+
+//DownloadFundFlowRequest 下载资金账单参数，只支持 HMAC-SHA256 签名，需要证书
+type DownloadFundFlowRequest struct {
+	BillDate    string //格式为 20140603
+	AccountType string //为空时为 Basic
+	TarType     string //为 GZIP 时下载压缩账单，返回的内容已经解压
+	RootCa      string //ca证书路径，为空时使用 Pay 上设置的证书
+}
+
+//DownloadBill 下载交易账单，返回未解析的账单内容，可使用 NewTradeBillReader 逐行解析，调用方负责关闭
+func (pcf *Pay) DownloadBill(req *DownloadBillRequest) (io.ReadCloser, error) {
+	billType := req.BillType
+	if billType == "" {
+		billType = BillTypeAll
+	}
+	params := map[string]string{
+		"appid":     pcf.AppID,
+		"mch_id":    pcf.PayMchID,
+		"sign_type": req.SignType,
+		"bill_date": req.BillDate,
+		"bill_type": billType,
+		"tar_type":  req.TarType,
+	}
+	return pcf.download("DownloadBill", pcf.gateway(downloadBillPath), params, nil)
+}
+
+//DownloadFundFlow 下载资金账单，返回未解析的账单内容，可使用 NewFundFlowReader 逐行解析，调用方负责关闭
+func (pcf *Pay) DownloadFundFlow(req *DownloadFundFlowRequest) (io.ReadCloser, error) {
+	accountType := req.AccountType
+	if accountType == "" {
+		accountType = AccountTypeBasic
+	}
+	params := map[string]string{
+		"appid":        pcf.AppID,
+		"mch_id":       pcf.PayMchID,
+		"sign_type":    SignTypeHMACSHA256,
+		"bill_date":    req.BillDate,
+		"account_type": accountType,
+		"tar_type":     req.TarType,
+	}
+	client, err := pcf.tlsClient(req.RootCa)
+	if err != nil {
+		return nil, err
+	}
+	return pcf.download("DownloadFundFlow", pcf.gateway(downloadFundFlowPath), params, client)
+}
+
+//download 签名后发送请求，成功时返回账单内容，gzip 压缩的内容会自动解压，失败时返回 xml，解析为 *Error
+func (pcf *Pay) download(apiName, uri string, params map[string]string, client *http.Client) (io.ReadCloser, error) {
+	signer, err := pcf.signer(params["sign_type"])
+	if err != nil {
+		return nil, err
+	}
+	params["nonce_str"] = util.RandomStr(32)
+	params["sign"] = signer.Sign(params)
+	response, err := util.PostXMLForStream(client, uri, xmlParams(params))
+	if err != nil {
+		return nil, err
+	}
+
+	body := bufio.NewReader(response.Body)
+	head, _ := body.Peek(5)
+	switch {
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			response.Body.Close()
+			return nil, err
+		}
+		return billReadCloser{Reader: gz, Closer: response.Body}, nil
+	case bytes.Equal(head, []byte("<xml>")):
+		defer response.Body.Close()
+		data, err := ioutil.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		resParams, err := ParseXMLParams(data)
+		if err != nil {
+			return nil, err
+		}
+		errCode := resParams["error_code"]
+		if errCode == "" {
+			errCode = resParams["err_code"]
+		}
+		return nil, &Error{
+			APIName:    apiName,
+			ReturnCode: resParams["return_code"],
+			ReturnMsg:  resParams["return_msg"],
+			ErrCode:    errCode,
+			ErrCodeDes: resParams["return_msg"],
+		}
+	}
+	return billReadCloser{Reader: body, Closer: response.Body}, nil
+}
+
+//billReadCloser 读取解压后的内容，关闭时关闭响应
+type billReadCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,380 @@
+package pay
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+//TradeBillRow 交易账单中的一行，金额的单位为分，账单类型不同时没有的列为零值
+type TradeBillRow struct {
+	TradeTime          string //交易时间
+	AppID              string //公众账号ID
+	MchID              string //商户号
+	SubMchID           string //特约商户号
+	DeviceInfo         string //设备号
+	TransactionID      string //微信订单号
+	OutTradeNo         string //商户订单号
+	OpenID             string //用户标识
+	TradeType          string //交易类型
+	TradeState         string //交易状态
+	BankType           string //付款银行
+	FeeType            string //货币种类
+	SettlementTotalFee int64  //应结订单金额
+	CouponFee          int64  //代金券金额
+	RefundApplyTime    string //退款申请时间
+	RefundSuccessTime  string //退款成功时间
+	RefundID           string //微信退款单号
+	OutRefundNo        string //商户退款单号
+	RefundFee          int64  //退款金额
+	CouponRefundFee    int64  //充值券退款金额
+	RefundType         string //退款类型
+	RefundStatus       string //退款状态
+	Body               string //商品名称
+	Attach             string //商户数据包
+	ServiceFee         int64  //手续费
+	Rate               string //费率
+	TotalFee           int64  //订单金额
+	ApplyRefundFee     int64  //申请退款金额
+	RateNotes          string //费率备注
+}
+
+//TradeBillSummary 交易账单的汇总，金额的单位为分
+type TradeBillSummary struct {
+	TotalCount         int64 //总交易单数
+	SettlementTotalFee int64 //应结订单总金额
+	RefundFee          int64 //退款总金额
+	CouponRefundFee    int64 //充值券退款总金额
+	ServiceFee         int64 //手续费总金额
+	TotalFee           int64 //订单总金额
+	ApplyRefundFee     int64 //申请退款总金额
+}
+
+//FundFlowRow 资金账单中的一行，金额的单位为分
+type FundFlowRow struct {
+	BillingTime      string //记账时间
+	BizTransactionID string //微信支付业务单号
+	FundFlowID       string //资金流水单号
+	BizName          string //业务名称
+	BizType          string //业务类型
+	FinancialType    string //收支类型
+	Amount           int64  //收支金额
+	Balance          int64  //账户结余
+	ChangeApplicant  string //资金变更提交申请人
+	Memo             string //备注
+	BizVoucherID     string //业务凭证号
+}
+
+//FundFlowSummary 资金账单的汇总，金额的单位为分
+type FundFlowSummary struct {
+	TotalCount    int64 //资金流水总笔数
+	IncomeCount   int64 //收入笔数
+	IncomeAmount  int64 //收入金额
+	ExpenseCount  int64 //支出笔数
+	ExpenseAmount int64 //支出金额
+}
+
+//billReader 逐行读取账单：第一行为表头，之后每个字段以 ` 开头的行为明细，
+//明细之后是汇总的表头和汇总数据
+type billReader struct {
+	csv     *csv.Reader
+	columns map[string]int
+	summary map[string]string
+	line    int
+}
+
+func newBillReader(r io.Reader) *billReader {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	return &billReader{csv: reader}
+}
+
+//next 返回下一行明细，明细读完后解析汇总并返回 io.EOF
+func (b *billReader) next() (map[string]string, error) {
+	if b.summary != nil {
+		return nil, io.EOF
+	}
+	if b.columns == nil {
+		header, err := b.read()
+		if err != nil {
+			return nil, err
+		}
+		b.columns = billColumns(header)
+	}
+	record, err := b.read()
+	if err == io.EOF {
+		b.summary = make(map[string]string)
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(record[0], "`") {
+		return nil, b.readSummary(record)
+	}
+	row := make(map[string]string, len(b.columns))
+	for name, i := range b.columns {
+		if i < len(record) {
+			row[name] = strings.TrimPrefix(record[i], "`")
+		}
+	}
+	return row, nil
+}
+
+func (b *billReader) readSummary(header []string) error {
+	values, err := b.read()
+	if err != nil && err != io.EOF {
+		return err
+	}
+	b.summary = make(map[string]string)
+	for name, i := range billColumns(header) {
+		if i < len(values) {
+			b.summary[name] = strings.TrimPrefix(values[i], "`")
+		}
+	}
+	return io.EOF
+}
+
+func (b *billReader) read() ([]string, error) {
+	for {
+		record, err := b.csv.Read()
+		if err != nil {
+			if err != io.EOF {
+				err = fmt.Errorf("wechatpay : read bill line %d error : %v", b.line+1, err)
+			}
+			return nil, err
+		}
+		b.line++
+		if len(record) > 1 || strings.TrimSpace(record[0]) != "" {
+			return record, nil
+		}
+	}
+}
+
+//amount 将以元为单位的金额转换为分
+func (b *billReader) amount(values map[string]string, name string) (int64, error) {
+	value := values[name]
+	if value == "" {
+		return 0, nil
+	}
+	fen, err := yuanToFen(value)
+	if err != nil {
+		return 0, fmt.Errorf("wechatpay : bill line %d %s=%q is not a valid amount", b.line, name, value)
+	}
+	return fen, nil
+}
+
+func (b *billReader) count(values map[string]string, name string) (int64, error) {
+	value := values[name]
+	if value == "" {
+		return 0, nil
+	}
+	count, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("wechatpay : bill line %d %s=%q is not a valid count", b.line, name, value)
+	}
+	return count, nil
+}
+
+//billColumns 返回列名到下标的映射，去掉 BOM 和列名中的（元）
+func billColumns(header []string) map[string]int {
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		name = strings.TrimSuffix(strings.TrimSuffix(name, "（元）"), "(元)")
+		columns[name] = i
+	}
+	return columns
+}
+
+//yuanToFen 将 "5.76" 这样以元为单位的金额转换为分，超过两位的小数四舍五入
+func yuanToFen(value string) (int64, error) {
+	negative := strings.HasPrefix(value, "-")
+	value = strings.TrimLeft(value, "+-")
+	integer, fraction := value, ""
+	if i := strings.IndexByte(value, '.'); i >= 0 {
+		integer, fraction = value[:i], value[i+1:]
+	}
+	if integer == "" {
+		integer = "0"
+	}
+	yuan, err := strconv.ParseInt(integer, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	var fen, round int64
+	for i, c := range fraction {
+		if c < '0' || c > '9' {
+			return 0, strconv.ErrSyntax
+		}
+		switch {
+		case i < 2:
+			fen = fen*10 + int64(c-'0')
+		case i == 2 && c >= '5':
+			round = 1
+		}
+	}
+	for i := len(fraction); i < 2; i++ {
+		fen *= 10
+	}
+	fen += yuan*100 + round
+	if negative {
+		fen = -fen
+	}
+	return fen, nil
+}
+
+//TradeBillReader 逐行解析交易账单，不会将整个账单读入内存
+type TradeBillReader struct {
+	bill *billReader
+}
+
+//NewTradeBillReader 创建交易账单解析器，r 可以是 DownloadBill 的返回值或保存的账单文件
+func NewTradeBillReader(r io.Reader) *TradeBillReader {
+	return &TradeBillReader{bill: newBillReader(r)}
+}
+
+//Read 返回下一行明细，明细读完后返回 io.EOF，之后可以通过 Summary 获取汇总
+func (r *TradeBillReader) Read() (*TradeBillRow, error) {
+	values, err := r.bill.next()
+	if err != nil {
+		return nil, err
+	}
+	row := &TradeBillRow{
+		TradeTime:         values["交易时间"],
+		AppID:             values["公众账号ID"],
+		MchID:             values["商户号"],
+		SubMchID:          values["特约商户号"],
+		DeviceInfo:        values["设备号"],
+		TransactionID:     values["微信订单号"],
+		OutTradeNo:        values["商户订单号"],
+		OpenID:            values["用户标识"],
+		TradeType:         values["交易类型"],
+		TradeState:        values["交易状态"],
+		BankType:          values["付款银行"],
+		FeeType:           values["货币种类"],
+		RefundApplyTime:   values["退款申请时间"],
+		RefundSuccessTime: values["退款成功时间"],
+		RefundID:          values["微信退款单号"],
+		OutRefundNo:       values["商户退款单号"],
+		RefundType:        values["退款类型"],
+		RefundStatus:      values["退款状态"],
+		Body:              values["商品名称"],
+		Attach:            values["商户数据包"],
+		Rate:              values["费率"],
+		RateNotes:         values["费率备注"],
+	}
+	amounts := []struct {
+		name  string
+		value *int64
+	}{
+		{"应结订单金额", &row.SettlementTotalFee},
+		{"代金券金额", &row.CouponFee},
+		{"退款金额", &row.RefundFee},
+		{"充值券退款金额", &row.CouponRefundFee},
+		{"手续费", &row.ServiceFee},
+		{"订单金额", &row.TotalFee},
+		{"申请退款金额", &row.ApplyRefundFee},
+	}
+	for _, amount := range amounts {
+		if *amount.value, err = r.bill.amount(values, amount.name); err != nil {
+			return nil, err
+		}
+	}
+	return row, nil
+}
+
+//Summary 返回账单汇总，在 Read 返回 io.EOF 之前返回 nil
+func (r *TradeBillReader) Summary() (*TradeBillSummary, error) {
+	values := r.bill.summary
+	if values == nil {
+		return nil, nil
+	}
+	summary := new(TradeBillSummary)
+	var err error
+	if summary.TotalCount, err = r.bill.count(values, "总交易单数"); err != nil {
+		return nil, err
+	}
+	amounts := []struct {
+		name  string
+		value *int64
+	}{
+		{"应结订单总金额", &summary.SettlementTotalFee},
+		{"退款总金额", &summary.RefundFee},
+		{"充值券退款总金额", &summary.CouponRefundFee},
+		{"手续费总金额", &summary.ServiceFee},
+		{"订单总金额", &summary.TotalFee},
+		{"申请退款总金额", &summary.ApplyRefundFee},
+	}
+	for _, amount := range amounts {
+		if *amount.value, err = r.bill.amount(values, amount.name); err != nil {
+			return nil, err
+		}
+	}
+	return summary, nil
+}
+
+//FundFlowReader 逐行解析资金账单，不会将整个账单读入内存
+type FundFlowReader struct {
+	bill *billReader
+}
+
+//NewFundFlowReader 创建资金账单解析器，r 可以是 DownloadFundFlow 的返回值或保存的账单文件
+func NewFundFlowReader(r io.Reader) *FundFlowReader {
+	return &FundFlowReader{bill: newBillReader(r)}
+}
+
+//Read 返回下一行明细，明细读完后返回 io.EOF，之后可以通过 Summary 获取汇总
+func (r *FundFlowReader) Read() (*FundFlowRow, error) {
+	values, err := r.bill.next()
+	if err != nil {
+		return nil, err
+	}
+	row := &FundFlowRow{
+		BillingTime:      values["记账时间"],
+		BizTransactionID: values["微信支付业务单号"],
+		FundFlowID:       values["资金流水单号"],
+		BizName:          values["业务名称"],
+		BizType:          values["业务类型"],
+		FinancialType:    values["收支类型"],
+		ChangeApplicant:  values["资金变更提交申请人"],
+		Memo:             values["备注"],
+		BizVoucherID:     values["业务凭证号"],
+	}
+	if row.Amount, err = r.bill.amount(values, "收支金额"); err != nil {
+		return nil, err
+	}
+	if row.Balance, err = r.bill.amount(values, "账户结余"); err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+//Summary 返回账单汇总，在 Read 返回 io.EOF 之前返回 nil
+func (r *FundFlowReader) Summary() (*FundFlowSummary, error) {
+	values := r.bill.summary
+	if values == nil {
+		return nil, nil
+	}
+	summary := new(FundFlowSummary)
+	var err error
+	if summary.TotalCount, err = r.bill.count(values, "资金流水总笔数"); err != nil {
+		return nil, err
+	}
+	if summary.IncomeCount, err = r.bill.count(values, "收入笔数"); err != nil {
+		return nil, err
+	}
+	if summary.IncomeAmount, err = r.bill.amount(values, "收入金额"); err != nil {
+		return nil, err
+	}
+	if summary.ExpenseCount, err = r.bill.count(values, "支出笔数"); err != nil {
+		return nil, err
+	}
+	if summary.ExpenseAmount, err = r.bill.amount(values, "支出金额"); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
@@ -0,0 +1,111 @@
+package pay
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const testTradeBill = "交易时间,公众账号ID,商户号,特约商户号,设备号,微信订单号,商户订单号,用户标识,交易类型,交易状态,付款银行,货币种类,应结订单金额,代金券金额,微信退款单号,商户退款单号,退款金额,充值券退款金额,退款类型,退款状态,商品名称,商户数据包,手续费,费率,订单金额,申请退款金额,费率备注\r\n" +
+	"`2014-11-10 16:33:45,`wx2421b1c4370ec43b,`10000100,`0,`1000,`1001690740201411100005734289,`1415640626,`085e9858e3ba5186aafcbaed1,`MICROPAY,`SUCCESS,`OTHERS,`CNY,`0.01,`0.0,`0,`0,`0,`0,`,`,`被扫支付测试,`订单额外描述,`0.00000,`0.60%,`0.01,`0.00,`\r\n" +
+	"`2014-11-10 16:46:14,`wx2421b1c4370ec43b,`10000100,`0,`1000,`1002780740201411100005729794,`1415635270,`085e9858e90ca40c0b5aee463,`MICROPAY,`REFUND,`OTHERS,`CNY,`0.00,`0.0,`2008450740201411110000174436,`1415640626,`0.01,`0.00,`ORIGINAL,`SUCCESS,`被扫支付测试,`订单额外描述,`0.00000,`0.60%,`0.01,`0.01,`\r\n" +
+	"总交易单数,应结订单总金额,退款总金额,充值券退款总金额,手续费总金额,订单总金额,申请退款总金额\r\n" +
+	"`2,`0.01,`0.01,`0.00,`0,`0.02,`0.01\r\n"
+
+func TestTradeBillReader(t *testing.T) {
+	reader := NewTradeBillReader(strings.NewReader(testTradeBill))
+	var rows []*TradeBillRow
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(rows))
+	}
+	if rows[1].TransactionID != "1002780740201411100005729794" || rows[1].TradeState != TradeStateRefund ||
+		rows[1].RefundFee != 1 || rows[1].TotalFee != 1 || rows[1].Body != "被扫支付测试" {
+		t.Errorf("unexpected row %+v", rows[1])
+	}
+	summary, err := reader.Summary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary == nil || summary.TotalCount != 2 || summary.TotalFee != 2 || summary.RefundFee != 1 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+}
+
+func TestFundFlowReader(t *testing.T) {
+	bill := "记账时间,微信支付业务单号,资金流水单号,业务名称,业务类型,收支类型,收支金额（元）,账户结余（元）,资金变更提交申请人,备注,业务凭证号\n" +
+		"`2018-02-01 04:21:23,`50000305742018020103387128253,`1900009231201802015884652186,`退款,`退款,`支出,`-0.02,`0.17,`system,`缺货,`REF4200000068201801293084726067\n" +
+		"资金流水总笔数,收入笔数,收入金额,支出笔数,支出金额\n" +
+		"`1,`0,`0.00,`1,`0.02\n"
+	reader := NewFundFlowReader(strings.NewReader(bill))
+	row, err := reader.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row.Amount != -2 || row.Balance != 17 || row.Memo != "缺货" {
+		t.Errorf("unexpected row %+v", row)
+	}
+	if _, err = reader.Read(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+	summary, _ := reader.Summary()
+	if summary.TotalCount != 1 || summary.ExpenseAmount != 2 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+}
+
+func TestYuanToFen(t *testing.T) {
+	cases := map[string]int64{"0": 0, "0.01": 1, "5.76": 576, "1.5": 150, "-0.02": -2, "0.00600": 1, "12": 1200}
+	for value, expected := range cases {
+		if fen, err := yuanToFen(value); err != nil || fen != expected {
+			t.Errorf("yuanToFen(%q) = %d, %v, expected %d", value, fen, err, expected)
+		}
+	}
+	if _, err := yuanToFen("1.0a"); err == nil {
+		t.Error("expected error for invalid amount")
+	}
+}
+
+func TestDownloadBill(t *testing.T) {
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte(testTradeBill))
+	w.Close()
+
+	pay, done := newTestPayServer(t, map[string]testPayHandler{downloadBillPath: func(w http.ResponseWriter, params map[string]string) map[string]string {
+		if params["bill_date"] != "20141110" {
+			w.Write([]byte("<xml><return_code>FAIL</return_code><return_msg>No Bill Exist</return_msg><error_code>20002</error_code></xml>"))
+			return nil
+		}
+		w.Write(gz.Bytes())
+		return nil
+	}})
+	defer done()
+
+	body, err := pay.DownloadBill(&DownloadBillRequest{BillDate: "20141110", TarType: TarTypeGZIP})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(body)
+	body.Close()
+	if string(data) != testTradeBill {
+		t.Errorf("unexpected bill %q", data)
+	}
+
+	if _, err = pay.DownloadBill(&DownloadBillRequest{BillDate: "20141111"}); !IsErrCode(err, ErrCodeNoBillExist) {
+		t.Errorf("expected no bill error, got %v", err)
+	}
+}
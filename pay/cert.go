@@ -0,0 +1,94 @@
+package pay
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/fintcloud/wechat/util"
+)
+
+//ErrCertificateNotSet 调用需要商户 API 证书的接口前没有设置证书
+var ErrCertificateNotSet = errors.New("wechatpay : merchant certificate is not set, call Pay.LoadPKCS12File or another Load method first")
+
+//tlsClientLock 保护 Context 中 TLSClient 的初始化
+var tlsClientLock sync.Mutex
+
+//SetCertificate 设置商户 API 证书，退款、企业付款、撤销订单和下载资金账单等接口都会使用该证书，
+//证书保存在 Context 中，同一个 Context 创建的 Pay 共用，证书更新时再次调用即可，不影响正在进行的请求
+func (pcf *Pay) SetCertificate(cert tls.Certificate) {
+	pcf.payTLSClient().SetCertificate(cert)
+}
+
+//LoadPKCS12 从 apiclient_cert.p12 的内容加载商户 API 证书，密码为商户号，可用于从密钥管理服务读取的证书
+func (pcf *Pay) LoadPKCS12(data []byte) error {
+	cert, err := util.LoadPKCS12(data, pcf.PayMchID)
+	if err != nil {
+		return fmt.Errorf("wechatpay : load merchant certificate error : %v", err)
+	}
+	pcf.SetCertificate(cert)
+	return nil
+}
+
+//LoadPKCS12File 从 apiclient_cert.p12 文件加载商户 API 证书，密码为商户号
+func (pcf *Pay) LoadPKCS12File(path string) error {
+	cert, err := util.LoadPKCS12File(path, pcf.PayMchID)
+	if err != nil {
+		return fmt.Errorf("wechatpay : load merchant certificate error : %v", err)
+	}
+	pcf.SetCertificate(cert)
+	return nil
+}
+
+//LoadPEM 从 apiclient_cert.pem 和 apiclient_key.pem 的内容加载商户 API 证书
+func (pcf *Pay) LoadPEM(certPEM, keyPEM []byte) error {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("wechatpay : load merchant certificate error : %v", err)
+	}
+	pcf.SetCertificate(cert)
+	return nil
+}
+
+//LoadPEMFiles 从 apiclient_cert.pem 和 apiclient_key.pem 文件加载商户 API 证书
+func (pcf *Pay) LoadPEMFiles(certFile, keyFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return fmt.Errorf("wechatpay : load merchant certificate error : %v", err)
+	}
+	pcf.SetCertificate(cert)
+	return nil
+}
+
+//payTLSClient 返回 Context 中的 TLSClient，没有时创建
+func (pcf *Pay) payTLSClient() *util.TLSClient {
+	tlsClientLock.Lock()
+	defer tlsClientLock.Unlock()
+	client := pcf.GetPayTLSClient()
+	if client == nil {
+		client = util.NewTLSClient()
+		pcf.SetPayTLSClient(client)
+	}
+	return client
+}
+
+//tlsClient 返回使用商户 API 证书的 http.Client，
+//rootCa 为兼容以前按调用传入的证书路径，不为空时每次读取该证书，为空时使用 Pay 上设置的证书
+func (pcf *Pay) tlsClient(rootCa string) (*http.Client, error) {
+	if rootCa != "" {
+		cert, err := util.LoadPKCS12File(rootCa, pcf.PayMchID)
+		if err != nil {
+			return nil, fmt.Errorf("wechatpay : load merchant certificate error : %v", err)
+		}
+		client := util.NewTLSClient()
+		client.SetCertificate(cert)
+		return client.Client(), nil
+	}
+	client := pcf.payTLSClient()
+	if client.Certificate() == nil {
+		return nil, ErrCertificateNotSet
+	}
+	return client.Client(), nil
+}
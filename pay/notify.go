@@ -0,0 +1,199 @@
+package pay
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	//SignTypeMD5 MD5 签名
+	SignTypeMD5 = "MD5"
+	//SignTypeHMACSHA256 HMAC-SHA256 签名
+	SignTypeHMACSHA256 = "HMAC-SHA256"
+
+	//notifyDedupCacheKey 已处理的支付通知在 Cache 中的 key
+	notifyDedupCacheKey = "wechatpay_notify_%s_%s"
+	//notifyDedupTTL 支付通知去重的时间，微信支付在24小时内重复发送通知
+	notifyDedupTTL = 25 * time.Hour
+	//maxNotifyBodySize 通知请求体的最大长度
+	maxNotifyBodySize = 1 << 20
+)
+
+//ErrInvalidSign 签名验证失败
+var ErrInvalidSign = errors.New("wechatpay : invalid sign")
+
+//ParseXMLParams 将 <xml><key>value</key>...</xml> 格式的内容解析为 map，只处理第一层的元素
+func ParseXMLParams(data []byte) (map[string]string, error) {
+	params := make(map[string]string)
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var (
+		depth int
+		key   string
+		value bytes.Buffer
+	)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("wechatpay : parse xml error : %v", err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 2 {
+				key = t.Name.Local
+				value.Reset()
+			}
+		case xml.CharData:
+			if depth == 2 {
+				value.Write(t)
+			}
+		case xml.EndElement:
+			if depth == 2 {
+				params[key] = value.String()
+			}
+			depth--
+		}
+	}
+	return params, nil
+}
+
+//VerifyParams 使用原始的通知参数验证签名，签名方式取自 sign_type，为空时为 MD5
+func (pcf *Pay) VerifyParams(params map[string]string) bool {
+	signer, err := pcf.signer(params["sign_type"])
+	if err != nil {
+		return false
+	}
+	return verifySign(signer, params)
+}
+
+//ParseNotify 解析支付结果通知，验证签名后解析为 NotifyResult，同时返回原始参数以便读取 NotifyResult 中没有的字段
+func (pcf *Pay) ParseNotify(data []byte) (*NotifyResult, map[string]string, error) {
+	params, err := ParseXMLParams(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if params["return_code"] != "SUCCESS" {
+		return nil, params, fmt.Errorf("wechatpay : notify return_code=%s , return_msg=%s", params["return_code"], params["return_msg"])
+	}
+	if !pcf.VerifyParams(params) {
+		return nil, params, ErrInvalidSign
+	}
+	result := new(NotifyResult)
+	if err = xml.Unmarshal(data, result); err != nil {
+		return nil, params, fmt.Errorf("wechatpay : decode notify error : %v", err)
+	}
+	result.Coupons = parseCoupons(params)
+	return result, params, nil
+}
+
+//NotifyHandler 处理支付结果通知的 http.Handler
+//
+//验签通过后调用 Handle，返回 nil 时应答 SUCCESS，并按 transaction_id 记录在 Cache 中，
+//微信支付重复发送同一笔通知时不再调用 Handle 直接应答 SUCCESS；验签失败或 Handle 返回错误时应答 FAIL
+type NotifyHandler struct {
+	Pay    *Pay
+	Handle func(result *NotifyResult, params map[string]string) error
+
+	dedup notifyDedup
+}
+
+//NewNotifyHandler 创建支付结果通知处理器
+func (pcf *Pay) NewNotifyHandler(handle func(result *NotifyResult, params map[string]string) error) *NotifyHandler {
+	return &NotifyHandler{Pay: pcf, Handle: handle}
+}
+
+//ServeHTTP 实现 http.Handler
+func (h *NotifyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxNotifyBodySize))
+	if err != nil {
+		writeNotifyResp(w, err.Error())
+		return
+	}
+	result, params, err := h.Pay.ParseNotify(data)
+	if err != nil {
+		writeNotifyResp(w, err.Error())
+		return
+	}
+
+	err = h.dedup.do(h.Pay, params["transaction_id"], func() error {
+		return h.Handle(result, params)
+	})
+	if err != nil {
+		writeNotifyResp(w, err.Error())
+		return
+	}
+	writeNotifyResp(w, "")
+}
+
+//notifyDedup 按照 id 对通知去重，已处理的 id 记录在 Cache 中，正在处理的 id 记录在内存中
+type notifyDedup struct {
+	mu       sync.Mutex
+	inflight map[string]bool
+}
+
+//do 在 id 没有处理过时调用 handle，id 为空时不去重
+func (d *notifyDedup) do(pcf *Pay, id string, handle func() error) error {
+	if id == "" {
+		return handle()
+	}
+	cacheKey := fmt.Sprintf(notifyDedupCacheKey, pcf.PayMchID, id)
+	if pcf.Cache != nil && pcf.Cache.IsExist(cacheKey) {
+		return nil
+	}
+	//同一笔通知正在处理时应答失败，微信支付会稍后重试
+	if !d.acquire(id) {
+		return errors.New("notify is being processed")
+	}
+	defer d.release(id)
+
+	if err := handle(); err != nil {
+		return err
+	}
+	if pcf.Cache != nil {
+		return pcf.Cache.Set(cacheKey, true, notifyDedupTTL)
+	}
+	return nil
+}
+
+func (d *notifyDedup) acquire(id string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.inflight == nil {
+		d.inflight = make(map[string]bool)
+	}
+	if d.inflight[id] {
+		return false
+	}
+	d.inflight[id] = true
+	return true
+}
+
+func (d *notifyDedup) release(id string) {
+	d.mu.Lock()
+	delete(d.inflight, id)
+	d.mu.Unlock()
+}
+
+//writeNotifyResp 应答支付通知，msg 为空时应答 SUCCESS
+func writeNotifyResp(w http.ResponseWriter, msg string) {
+	resp := NotifyResp{ReturnCode: "SUCCESS", ReturnMsg: "OK"}
+	if msg != "" {
+		resp = NotifyResp{ReturnCode: "FAIL", ReturnMsg: CDATA(msg)}
+	}
+	data, _ := xml.Marshal(struct {
+		XMLName xml.Name `xml:"xml"`
+		NotifyResp
+	}{NotifyResp: resp})
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write(data)
+}
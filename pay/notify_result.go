@@ -1,13 +1,19 @@
 package pay
 
 import (
-	"fmt"
-	"github.com/fintcloud/wechat/util"
-	"sort"
+	"encoding/xml"
 )
 
+// CDATA 序列化为 xml 时使用 <![CDATA[]]> 包裹的字符串
 type CDATA string
 
+// MarshalXML 实现 xml.Marshaler
+func (c CDATA) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return e.EncodeElement(struct {
+		Text string `xml:",cdata"`
+	}{string(c)}, start)
+}
+
 // Base 公用参数
 type Base struct {
 	AppID    string `xml:"appid"`
@@ -61,6 +67,8 @@ type NotifyResult struct {
 	CouponID5     string `xml:"coupon_id_5"`
 	CouponFee5    int64  `xml:"coupon_fee_5"`
 	CouponType5    string   `xml:"coupon_type_5"`
+	// Coupons 按照 coupon_count 解析的全部优惠，不受上面 0~5 的限制
+	Coupons []Coupon `xml:"-"`
 }
 
 // NotifyResp 消息通知返回
@@ -70,6 +78,8 @@ type NotifyResp struct {
 }
 
 // VerifySign 验签
+//
+// Deprecated: 只能校验 NotifyResult 中已有的字段，且只支持 MD5，请使用 ParseNotify 根据原始参数验签
 func (pcf *Pay) VerifySign(notifyRes NotifyResult) bool {
 	// 封装map 请求过来的 map
 	resMap := make(map[string]interface{})
@@ -118,26 +128,13 @@ func (pcf *Pay) VerifySign(notifyRes NotifyResult) bool {
 	resMap["err_code"] = notifyRes.ErrCode
 	resMap["err_code_des"] = notifyRes.ErrCodeDes
 	resMap["settlement_total_fee"] = notifyRes.SettlementTotalFee
-	// 支付key
-	sortedKeys := make([]string, 0, len(resMap))
-	for k := range resMap {
-		sortedKeys = append(sortedKeys, k)
-	}
-	sort.Strings(sortedKeys)
-	// STEP2, 对key=value的键值对用&连接起来，略过空值
-	var signStrings string
-	for _, k := range sortedKeys {
-		value := fmt.Sprintf("%v", resMap[k])
-		if value != "" && value != "0"{
-			signStrings = signStrings + k + "=" + value + "&"
+	// 与以前的实现一致，值为 0 的字段不参与签名
+	params := ToSignParams(resMap)
+	for k, v := range params {
+		if v == "0" {
+			params[k] = ""
 		}
 	}
-	// STEP3, 在键值对的最后加上key=API_KEY
-	signStrings = signStrings + "key=" + pcf.PayKey
-	// STEP4, 进行MD5签名并且将所有字符转为大写.
-	sign := util.MD5Sum(signStrings)
-	if sign != notifyRes.Sign {
-		return false
-	}
-	return true
+	params["sign"] = notifyRes.Sign
+	return verifySign(&md5Signer{apiKey: pcf.PayKey}, params)
 }
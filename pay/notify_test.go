@@ -0,0 +1,97 @@
+package pay
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fintcloud/wechat/cache"
+	"github.com/fintcloud/wechat/context"
+)
+
+const testPayKey = "192006250b4c09247ec02edce69f6a2d"
+
+//testSign 使用 testPayKey 签名
+func testSign(params map[string]string, signType string) string {
+	signer, err := NewSigner(signType, testPayKey)
+	if err != nil {
+		panic(err)
+	}
+	return signer.Sign(params)
+}
+
+func newTestNotify(params map[string]string, signType string) string {
+	params["sign"] = testSign(params, signType)
+	var buf strings.Builder
+	buf.WriteString("<xml>")
+	for k, v := range params {
+		buf.WriteString("<" + k + "><![CDATA[" + v + "]]></" + k + ">")
+	}
+	buf.WriteString("</xml>")
+	return buf.String()
+}
+
+func TestParseNotify(t *testing.T) {
+	pay := NewPay(&context.Context{PayMchID: "1900000001", PayKey: testPayKey})
+	for _, signType := range []string{"", SignTypeMD5, SignTypeHMACSHA256} {
+		data := newTestNotify(map[string]string{
+			"return_code":    "SUCCESS",
+			"result_code":    "SUCCESS",
+			"appid":          "wx2421b1c4370ec43b",
+			"mch_id":         "1900000001",
+			"sign_type":      signType,
+			"out_trade_no":   "1409811653",
+			"transaction_id": "1004400740201409030005092168",
+			"total_fee":      "101",
+			"coupon_count":   "1",
+			"coupon_id_0":    "10000",
+			"coupon_id_6":    "10006",
+		}, signType)
+
+		result, params, err := pay.ParseNotify([]byte(data))
+		if err != nil {
+			t.Fatalf("sign_type %q : %v", signType, err)
+		}
+		if result.TotalFee != 101 || result.OutTradeNo != "1409811653" || params["coupon_id_6"] != "10006" {
+			t.Errorf("sign_type %q : unexpected result %+v %v", signType, result, params)
+		}
+
+		if _, _, err = pay.ParseNotify([]byte(strings.Replace(data, "101", "1", 1))); err != ErrInvalidSign {
+			t.Errorf("sign_type %q : expected ErrInvalidSign for tampered notify, got %v", signType, err)
+		}
+	}
+}
+
+func TestNotifyHandler(t *testing.T) {
+	pay := NewPay(&context.Context{PayMchID: "1900000001", PayKey: testPayKey, Cache: cache.NewMemory()})
+	data := newTestNotify(map[string]string{
+		"return_code":    "SUCCESS",
+		"result_code":    "SUCCESS",
+		"out_trade_no":   "1409811653",
+		"transaction_id": "1004400740201409030005092168",
+		"total_fee":      "101",
+	}, SignTypeMD5)
+
+	calls := 0
+	handler := pay.NewNotifyHandler(func(result *NotifyResult, params map[string]string) error {
+		calls++
+		return nil
+	})
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/notify", strings.NewReader(data)))
+		if !strings.Contains(w.Body.String(), "<return_code><![CDATA[SUCCESS]]></return_code>") {
+			t.Fatalf("unexpected response %s", w.Body.String())
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected handle to be called once, got %d", calls)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/notify", strings.NewReader(strings.Replace(data, "101", "1", 1))))
+	if !strings.Contains(w.Body.String(), "FAIL") {
+		t.Errorf("expected FAIL for invalid sign, got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,140 @@
+package pay
+
+import "errors"
+
+const (
+	orderQueryPath = "/pay/orderquery"
+	closeOrderPath = "/pay/closeorder"
+	reversePath    = "/secapi/pay/reverse"
+)
+
+//交易状态 trade_state
+const (
+	TradeStateSuccess    = "SUCCESS"
+	TradeStateRefund     = "REFUND"
+	TradeStateNotPay     = "NOTPAY"
+	TradeStateClosed     = "CLOSED"
+	TradeStateRevoked    = "REVOKED"
+	TradeStateUserPaying = "USERPAYING"
+	TradeStatePayError   = "PAYERROR"
+)
+
+//OrderQueryRequest 查询订单参数，TransactionID 和 OutTradeNo 二选一，同时存在时优先使用 TransactionID
+type OrderQueryRequest struct {
+	TransactionID string
+	OutTradeNo    string
+	SignType      string
+}
+
+//OrderQueryResponse 查询订单返回，字段与支付结果通知相同，另外包含交易状态
+type OrderQueryResponse struct {
+	NotifyResult
+	TradeState     string `xml:"trade_state"`
+	TradeStateDesc string `xml:"trade_state_desc"`
+}
+
+//CloseOrderRequest 关闭订单参数
+type CloseOrderRequest struct {
+	OutTradeNo string
+	SignType   string
+}
+
+//CloseOrderResponse 关闭订单返回
+type CloseOrderResponse struct {
+	Base
+	ReturnCode string `xml:"return_code"`
+	ReturnMsg  string `xml:"return_msg"`
+	ResultCode string `xml:"result_code"`
+	ResultMsg  string `xml:"result_msg"`
+	ErrCode    string `xml:"err_code"`
+	ErrCodeDes string `xml:"err_code_des"`
+}
+
+//ReverseRequest 撤销订单参数，只有付款码支付的订单可以撤销，TransactionID 和 OutTradeNo 二选一
+type ReverseRequest struct {
+	TransactionID string
+	OutTradeNo    string
+	SignType      string
+	RootCa        string //ca证书路径，为空时使用 Pay 上设置的证书
+}
+
+//ReverseResponse 撤销订单返回，Recall 为 Y 时需要重新调用撤销
+type ReverseResponse struct {
+	Base
+	ReturnCode string `xml:"return_code"`
+	ReturnMsg  string `xml:"return_msg"`
+	ResultCode string `xml:"result_code"`
+	ErrCode    string `xml:"err_code"`
+	ErrCodeDes string `xml:"err_code_des"`
+	Recall     string `xml:"recall"`
+}
+
+//OrderQuery 查询订单，订单不存在时返回 err_code 为 ORDERNOTEXIST 的 *Error
+func (pcf *Pay) OrderQuery(req *OrderQueryRequest) (*OrderQueryResponse, error) {
+	if req.TransactionID == "" && req.OutTradeNo == "" {
+		return nil, errors.New("wechatpay : OrderQuery requires transaction_id or out_trade_no")
+	}
+	params := map[string]string{
+		"appid":          pcf.AppID,
+		"mch_id":         pcf.PayMchID,
+		"transaction_id": req.TransactionID,
+		"sign_type":      req.SignType,
+	}
+	if req.TransactionID == "" {
+		params["out_trade_no"] = req.OutTradeNo
+	}
+	res := new(OrderQueryResponse)
+	resParams, err := pcf.request("OrderQuery", pcf.gateway(orderQueryPath), params, nil, res)
+	if err != nil {
+		return nil, err
+	}
+	res.Coupons = parseCoupons(resParams)
+	return res, nil
+}
+
+//CloseOrder 关闭订单，订单已支付时返回 err_code 为 ORDERPAID 的 *Error
+func (pcf *Pay) CloseOrder(req *CloseOrderRequest) (*CloseOrderResponse, error) {
+	params := map[string]string{
+		"appid":        pcf.AppID,
+		"mch_id":       pcf.PayMchID,
+		"out_trade_no": req.OutTradeNo,
+		"sign_type":    req.SignType,
+	}
+	res := new(CloseOrderResponse)
+	if _, err := pcf.request("CloseOrder", pcf.gateway(closeOrderPath), params, nil, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+//Reverse 撤销付款码支付的订单，返回错误时如果 ReverseResponse.Recall 为 Y 需要重新调用，
+//因此返回错误时 ReverseResponse 仍可能不为 nil
+func (pcf *Pay) Reverse(req *ReverseRequest) (*ReverseResponse, error) {
+	if req.TransactionID == "" && req.OutTradeNo == "" {
+		return nil, errors.New("wechatpay : Reverse requires transaction_id or out_trade_no")
+	}
+	params := map[string]string{
+		"appid":          pcf.AppID,
+		"mch_id":         pcf.PayMchID,
+		"transaction_id": req.TransactionID,
+		"sign_type":      req.SignType,
+	}
+	if req.TransactionID == "" {
+		params["out_trade_no"] = req.OutTradeNo
+	}
+	client, err := pcf.tlsClient(req.RootCa)
+	if err != nil {
+		return nil, err
+	}
+	res := new(ReverseResponse)
+	resParams, err := pcf.request("Reverse", pcf.gateway(reversePath), params, client, res)
+	if err != nil {
+		//只有通过验签并解析后的业务错误才返回 res，return_code 失败或验签失败时不能依据 recall 重试
+		var payErr *Error
+		if errors.As(err, &payErr) && resParams["return_code"] == "SUCCESS" {
+			return res, err
+		}
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,133 @@
+package pay
+
+import (
+	"crypto/tls"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fintcloud/wechat/context"
+)
+
+//testPayHandler 处理测试服务收到的请求，返回的应答参数没有 return_code 时补充为 SUCCESS 并签名，
+//返回 nil 时表示已直接写入 w，如账单文件
+type testPayHandler func(w http.ResponseWriter, params map[string]string) map[string]string
+
+//testPayResponse 返回固定应答的 testPayHandler
+func testPayResponse(response map[string]string) testPayHandler {
+	return func(w http.ResponseWriter, params map[string]string) map[string]string {
+		return response
+	}
+}
+
+//newTestPayServer 启动按接口路径分发的测试服务，校验请求签名后调用 handlers 中对应的处理函数，
+//返回的 Pay 的 BaseURL 指向该服务并设置了一个空的商户证书（测试服务使用 http）
+func newTestPayServer(t *testing.T, handlers map[string]testPayHandler) (*Pay, func()) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		params, err := ParseXMLParams(data)
+		if err != nil {
+			t.Error(err)
+		}
+		if testSign(params, params["sign_type"]) != params["sign"] {
+			t.Errorf("invalid request sign %v", params)
+		}
+		handler, ok := handlers[r.URL.Path]
+		if !ok {
+			t.Errorf("unexpected request %s", r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		response := handler(w, params)
+		if response == nil {
+			return
+		}
+		if response["return_code"] == "" {
+			response["return_code"] = "SUCCESS"
+		}
+		w.Write([]byte(newTestNotify(response, params["sign_type"])))
+	}))
+	pay := NewPay(&context.Context{AppID: "wx2421b1c4370ec43b", PayMchID: "1900000001", PayKey: testPayKey})
+	pay.BaseURL = server.URL
+	pay.SetCertificate(tls.Certificate{})
+	return pay, server.Close
+}
+
+func TestOrderQuery(t *testing.T) {
+	pay, done := newTestPayServer(t, map[string]testPayHandler{
+		orderQueryPath: testPayResponse(map[string]string{
+			"return_code":    "SUCCESS",
+			"result_code":    "SUCCESS",
+			"trade_state":    TradeStateSuccess,
+			"out_trade_no":   "1409811653",
+			"transaction_id": "1004400740201409030005092168",
+			"total_fee":      "101",
+			"coupon_count":   "2",
+			"coupon_id_0":    "10000",
+			"coupon_fee_0":   "1",
+			"coupon_id_1":    "10001",
+			"coupon_fee_1":   "2",
+		}),
+	})
+	defer done()
+	res, err := pay.OrderQuery(&OrderQueryRequest{OutTradeNo: "1409811653", SignType: SignTypeHMACSHA256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.TradeState != TradeStateSuccess || res.TotalFee != 101 || res.CouponFee1 != 2 {
+		t.Errorf("unexpected result %+v", res)
+	}
+	if len(res.Coupons) != 2 || res.Coupons[1] != (Coupon{ID: "10001", Fee: 2}) {
+		t.Errorf("unexpected coupons %+v", res.Coupons)
+	}
+}
+
+func TestCloseOrderError(t *testing.T) {
+	pay, done := newTestPayServer(t, map[string]testPayHandler{
+		closeOrderPath: testPayResponse(map[string]string{
+			"return_code":  "SUCCESS",
+			"result_code":  "FAIL",
+			"err_code":     ErrCodeOrderPaid,
+			"err_code_des": "订单已支付",
+		}),
+	})
+	defer done()
+	_, err := pay.CloseOrder(&CloseOrderRequest{OutTradeNo: "1409811653"})
+	if !IsErrCode(err, ErrCodeOrderPaid) {
+		t.Errorf("expected ORDERPAID error, got %v", err)
+	}
+}
+
+func TestReverseRecall(t *testing.T) {
+	forged := false
+	pay, done := newTestPayServer(t, map[string]testPayHandler{
+		reversePath: func(w http.ResponseWriter, params map[string]string) map[string]string {
+			response := map[string]string{"return_code": "SUCCESS", "result_code": "FAIL", "err_code": ErrCodeSystemError, "recall": "Y"}
+			if forged {
+				data := newTestNotify(response, params["sign_type"])
+				w.Write([]byte(strings.Replace(data, response["sign"], "FORGED", 1)))
+				return nil
+			}
+			return response
+		},
+	})
+	defer done()
+
+	res, err := pay.Reverse(&ReverseRequest{OutTradeNo: "1409811653"})
+	if !IsErrCode(err, ErrCodeSystemError) || res == nil || res.Recall != "Y" {
+		t.Errorf("expected recall with SYSTEMERROR, got %+v %v", res, err)
+	}
+	forged = true
+	if res, err = pay.Reverse(&ReverseRequest{OutTradeNo: "1409811653"}); !errors.Is(err, ErrInvalidSign) || res != nil {
+		t.Errorf("recall of a response with invalid sign should not be returned, got %+v %v", res, err)
+	}
+	if _, err = pay.Reverse(&ReverseRequest{}); err == nil {
+		t.Error("expected error without transaction_id or out_trade_no")
+	}
+	if _, err = pay.OrderQuery(&OrderQueryRequest{}); err == nil {
+		t.Error("expected error without transaction_id or out_trade_no")
+	}
+}
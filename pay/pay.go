@@ -1,33 +1,31 @@
 package pay
 
 import (
-	"bytes"
-	"crypto/hmac"
-	"crypto/md5"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/xml"
 	"errors"
-	"fmt"
-	"hash"
-	"sort"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/fintcloud/wechat/context"
-	"github.com/fintcloud/wechat/util"
 )
 
+//baseURL 商户平台接口的默认地址
+const baseURL = "https://api.mch.weixin.qq.com"
+
+const unifiedOrderPath = "/pay/unifiedorder"
+
 const (
-	payGateway = "https://api.mch.weixin.qq.com/pay/unifiedorder"
-	payToPersonal = "https://api.mch.weixin.qq.com/mmpaymkttransfers/promotion/transfers"
-	getPayToPersonalResult = "https://api.mch.weixin.qq.com/mmpaymkttransfers/gettransferinfo"
+	payToPersonalPath          = "/mmpaymkttransfers/promotion/transfers"
+	getPayToPersonalResultPath = "/mmpaymkttransfers/gettransferinfo"
 )
 
 // Pay struct extends context
 type Pay struct {
 	*context.Context
+
+	//BaseURL 商户平台接口地址，为空时使用 https://api.mch.weixin.qq.com，
+	//可设置为仿真测试系统 https://api.mch.weixin.qq.com/sandboxnew（PayKey 需使用 getsignkey 获取的沙箱密钥）或测试服务的地址
+	BaseURL string
 }
 
 // Params was NEEDED when request unifiedorder
@@ -44,6 +42,9 @@ type Params struct {
 	Attach     string
 	GoodsTag   string
 	NotifyURL  string
+	ProductID  string // trade_type=NATIVE 时必传
+	SceneInfo  string // trade_type=MWEB 时必传，可使用 MWebURL 生成
+	DeviceInfo string
 }
 
 // PayToPersonalParams 企业向个人付款传入参数
@@ -56,7 +57,7 @@ type PayToPersonalParams struct {
 	Amount         string   `xml:"amount"`
 	Desc           string   `xml:"desc"`
 	SpbillCreateIp string   `xml:"spbill_create_ip"`
-	RootCa         string //ca证书
+	RootCa         string //ca证书路径，为空时使用 Pay 上设置的证书
 }
 
 // Config 是传出用于 js sdk 用的参数
@@ -81,6 +82,7 @@ type PreOrder struct {
 	TradeType  string `xml:"trade_type,omitempty"`
 	PrePayID   string `xml:"prepay_id,omitempty"`
 	CodeURL    string `xml:"code_url,omitempty"`
+	MWebURL    string `xml:"mweb_url,omitempty"`
 	ErrCode    string `xml:"err_code,omitempty"`
 	ErrCodeDes string `xml:"err_code_des,omitempty"`
 }
@@ -102,32 +104,6 @@ type PayToPersonalResponse struct {
 }
 
 
-// payRequest 接口请求参数
-type payRequest struct {
-	AppID          string `xml:"appid"`
-	MchID          string `xml:"mch_id"`
-	DeviceInfo     string `xml:"device_info,omitempty"`
-	NonceStr       string `xml:"nonce_str"`
-	Sign           string `xml:"sign"`
-	SignType       string `xml:"sign_type,omitempty"`
-	Body           string `xml:"body"`
-	Detail         string `xml:"detail,omitempty"`
-	Attach         string `xml:"attach,omitempty"`      // 附加数据
-	OutTradeNo     string `xml:"out_trade_no"`          // 商户订单号
-	FeeType        string `xml:"fee_type,omitempty"`    // 标价币种
-	TotalFee       string `xml:"total_fee"`             // 标价金额
-	SpbillCreateIP string `xml:"spbill_create_ip"`      // 终端IP
-	TimeStart      string `xml:"time_start,omitempty"`  // 交易起始时间
-	TimeExpire     string `xml:"time_expire,omitempty"` // 交易结束时间
-	GoodsTag       string `xml:"goods_tag,omitempty"`   // 订单优惠标记
-	NotifyURL      string `xml:"notify_url"`            // 通知地址
-	TradeType      string `xml:"trade_type"`            // 交易类型
-	ProductID      string `xml:"product_id,omitempty"`  // 商品ID
-	LimitPay       string `xml:"limit_pay,omitempty"`   //
-	OpenID         string `xml:"openid,omitempty"`      // 用户标识
-	SceneInfo      string `xml:"scene_info,omitempty"`  // 场景信息
-}
-
 // PayToPersonalRequest 企业向个人付款请求参数
 type PayToPersonalRequest struct {
 	MchAppid       string   `xml:"mch_appid"`
@@ -150,51 +126,25 @@ func NewPay(ctx *context.Context) *Pay {
 	return &pay
 }
 
-func (pcf *Pay) PayToPersonal(p * PayToPersonalParams) (res PayToPersonalResponse, err error) {
-	nonceStr := util.RandomStr(32)
-	// 签名类型
-	param := make(map[string]interface{})
-	param["mch_appid"] = pcf.AppID
-	param["mchid"] = pcf.PayMchID
-	param["device_info"] = p.DeviceInfo
-	param["nonce_str"] = nonceStr
-	param["partner_trade_no"] = p.PartnerTradeNo
-	param["spbill_create_ip"] = p.SpbillCreateIp
-	param["openid"] = p.Openid
-	param["check_name"] = p.CheckName
-	param["re_user_name"] = p.ReUserName
-	param["amount"] = p.Amount
-	param["desc"] = p.Desc
-
-	bizKey := "&key=" + pcf.PayKey
-	str := orderParam(param, bizKey)
-	sign := util.MD5Sum(str)
-	request := PayToPersonalRequest{
-		MchAppid:	pcf.AppID,
-		Mchid:		pcf.PayMchID,
-		DeviceInfo:	p.DeviceInfo,
-		NonceStr:	nonceStr,
-		PartnerTradeNo:	p.PartnerTradeNo,
-		Openid:		p.Openid,
-		CheckName:	p.CheckName,
-		ReUserName:	p.ReUserName,
-		Amount:		p.Amount,
-		Desc:		p.Desc,
-		SpbillCreateIp:	p.SpbillCreateIp,
-		Sign:		sign,
-	}
-	rawRet, err := util.PostXMLWithTLS(payToPersonal, request, p.RootCa, pcf.PayMchID)
+// PayToPersonal 企业向个人付款，只支持 MD5 签名，result_code 不为 SUCCESS 时返回 *Error
+func (pcf *Pay) PayToPersonal(p *PayToPersonalParams) (res PayToPersonalResponse, err error) {
+	params := map[string]string{
+		"mch_appid":        pcf.AppID,
+		"mchid":            pcf.PayMchID,
+		"device_info":      p.DeviceInfo,
+		"partner_trade_no": p.PartnerTradeNo,
+		"spbill_create_ip": p.SpbillCreateIp,
+		"openid":           p.Openid,
+		"check_name":       p.CheckName,
+		"re_user_name":     p.ReUserName,
+		"amount":           p.Amount,
+		"desc":             p.Desc,
+	}
+	client, err := pcf.tlsClient(p.RootCa)
 	if err != nil {
 		return
 	}
-	err = xml.Unmarshal(rawRet, &res)
-	if err != nil {
-		return
-	}
-	if res.ReturnCode == "SUCCESS" {
-		return 
-	}
-	err = errors.New("[msg : xmlUnmarshalError] [rawReturn : " + string(rawRet) + "] [params : " + str + "] [sign : " + sign + "]")
+	_, err = pcf.request("PayToPersonal", pcf.gateway(payToPersonalPath), params, client, &res)
 	return
 }
 
@@ -228,73 +178,41 @@ type ResGetPayToPersonalResult struct {
 	Desc           string   `xml:"desc"`
 }
 
+// GetPayToPersonalResult 查询企业付款，rootCa 为空时使用 Pay 上设置的证书，result_code 不为 SUCCESS 时返回 *Error
 func (pcf *Pay) GetPayToPersonalResult(orderNo string, rootCa string) (res ResGetPayToPersonalResult, err error) {
-	nonceStr := util.RandomStr(32)
-	// 签名类型
-	param := make(map[string]interface{})
-	param["appid"] = pcf.AppID
-	param["mch_id"] = pcf.PayMchID
-	param["partner_trade_no"] = orderNo
-	param["nonce_str"] = nonceStr
-
-	bizKey := "&key=" + pcf.PayKey
-	str := orderParam(param, bizKey)
-	sign := util.MD5Sum(str)
-	request := ReqGetPayToPersonalResult{
-		PartnerTradeNo:		orderNo,
-		MchID:				pcf.PayMchID,
-		Appid:				pcf.AppID,
-		NonceStr:			nonceStr,
-		Sign: 				sign,
+	// 企业付款只支持 MD5 签名
+	params := map[string]string{
+		"appid":            pcf.AppID,
+		"mch_id":           pcf.PayMchID,
+		"partner_trade_no": orderNo,
 	}
-	rawRet, err := util.PostXMLWithTLS(getPayToPersonalResult, request, rootCa, pcf.PayMchID)
+	client, err := pcf.tlsClient(rootCa)
 	if err != nil {
 		return
 	}
-	err = xml.Unmarshal(rawRet, &res)
-	if err != nil {
-		return
-	}
-	if res.ReturnCode == "SUCCESS" {
-		return
-	}
-	err = errors.New("[msg : xmlUnmarshalError] [rawReturn : " + string(rawRet) + "] [params : " + str + "] [sign : " + sign + "]")
+	_, err = pcf.request("GetPayToPersonalResult", pcf.gateway(getPayToPersonalResultPath), params, client, &res)
 	return
 }
 
-
-
 // BridgeConfig get js bridge config
 func (pcf *Pay) BridgeConfig(p *Params) (cfg Config, err error) {
-	var (
-		buffer    strings.Builder
-		h         hash.Hash
-		timestamp = strconv.FormatInt(time.Now().Unix(), 10)
-	)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
 	order, err := pcf.PrePayOrder(p)
 	if err != nil {
 		return
 	}
-	buffer.WriteString("appId=")
-	buffer.WriteString(order.AppID)
-	buffer.WriteString("&nonceStr=")
-	buffer.WriteString(order.NonceStr)
-	buffer.WriteString("&package=")
-	buffer.WriteString("prepay_id=" + order.PrePayID)
-	buffer.WriteString("&signType=")
-	buffer.WriteString(p.SignType)
-	buffer.WriteString("&timeStamp=")
-	buffer.WriteString(timestamp)
-	buffer.WriteString("&key=")
-	buffer.WriteString(pcf.PayKey)
-	if p.SignType == "MD5" {
-		h = md5.New()
-	} else {
-		h = hmac.New(sha256.New, []byte(pcf.PayKey))
+	signer, err := pcf.signer(p.SignType)
+	if err != nil {
+		return
 	}
-	h.Write([]byte(buffer.String()))
 	// 签名
-	cfg.PaySign = strings.ToUpper(hex.EncodeToString(h.Sum(nil)))
+	cfg.PaySign = signer.Sign(map[string]string{
+		"appId":     order.AppID,
+		"nonceStr":  order.NonceStr,
+		"package":   "prepay_id=" + order.PrePayID,
+		"signType":  p.SignType,
+		"timeStamp": timestamp,
+	})
 	cfg.NonceStr = order.NonceStr
 	cfg.Timestamp = timestamp
 	cfg.PrePayID = order.PrePayID
@@ -304,71 +222,16 @@ func (pcf *Pay) BridgeConfig(p *Params) (cfg Config, err error) {
 }
 
 // PrePayOrder return data for invoke wechat payment
+// result_code 不为 SUCCESS 时返回 *Error，payOrder 中同时包含应答的 err_code 和 err_code_des
 func (pcf *Pay) PrePayOrder(p *Params) (payOrder PreOrder, err error) {
-	nonceStr := util.RandomStr(32)
-	notifyURL := pcf.PayNotifyURL
 	// 签名类型
 	if p.SignType == "" {
-		p.SignType = "MD5"
-	}
-	// 通知地址
-	if p.NotifyURL != "" {
-		notifyURL = p.NotifyURL
-	}
-	param := make(map[string]interface{})
-	param["appid"] = pcf.AppID
-	param["body"] = p.Body
-	param["mch_id"] = pcf.PayMchID
-	param["nonce_str"] = nonceStr
-	param["out_trade_no"] = p.OutTradeNo
-	param["spbill_create_ip"] = p.CreateIP
-	param["total_fee"] = p.TotalFee
-	param["trade_type"] = p.TradeType
-	param["openid"] = p.OpenID
-	param["sign_type"] = p.SignType
-	param["detail"] = p.Detail
-	param["attach"] = p.Attach
-	param["goods_tag"] = p.GoodsTag
-	param["notify_url"] = notifyURL
-
-	bizKey := "&key=" + pcf.PayKey
-	str := orderParam(param, bizKey)
-	sign := util.MD5Sum(str)
-	request := payRequest{
-		AppID:          pcf.AppID,
-		MchID:          pcf.PayMchID,
-		NonceStr:       nonceStr,
-		Sign:           sign,
-		Body:           p.Body,
-		OutTradeNo:     p.OutTradeNo,
-		TotalFee:       p.TotalFee,
-		SpbillCreateIP: p.CreateIP,
-		NotifyURL:      notifyURL,
-		TradeType:      p.TradeType,
-		OpenID:         p.OpenID,
-		SignType:       p.SignType,
-		Detail:         p.Detail,
-		Attach:         p.Attach,
-		GoodsTag:       p.GoodsTag,
-	}
-	rawRet, err := util.PostXML(payGateway, request)
-	if err != nil {
-		return
+		p.SignType = SignTypeMD5
 	}
-	err = xml.Unmarshal(rawRet, &payOrder)
-	if err != nil {
-		return
-	}
-	if payOrder.ReturnCode == "SUCCESS" {
-		// pay success
-		if payOrder.ResultCode == "SUCCESS" {
-			err = nil
-			return
-		}
-		err = errors.New(payOrder.ErrCode + payOrder.ErrCodeDes)
-		return
+	order, err := pcf.unifiedOrder(p)
+	if order != nil {
+		payOrder = *order
 	}
-	err = errors.New("[msg : xmlUnmarshalError] [rawReturn : " + string(rawRet) + "] [params : " + str + "] [sign : " + sign + "]")
 	return
 }
 
@@ -384,64 +247,3 @@ func (pcf *Pay) PrePayID(p *Params) (prePayID string, err error) {
 	prePayID = order.PrePayID
 	return
 }
-
-// order params
-func orderParam(source interface{}, bizKey string) (returnStr string) {
-	switch v := source.(type) {
-	case map[string]string:
-		keys := make([]string, 0, len(v))
-		for k := range v {
-			if k == "sign" {
-				continue
-			}
-			keys = append(keys, k)
-		}
-		sort.Strings(keys)
-		var buf bytes.Buffer
-		for _, k := range keys {
-			if v[k] == "" {
-				continue
-			}
-			if buf.Len() > 0 {
-				buf.WriteByte('&')
-			}
-			buf.WriteString(k)
-			buf.WriteByte('=')
-			buf.WriteString(v[k])
-		}
-		buf.WriteString(bizKey)
-		returnStr = buf.String()
-	case map[string]interface{}:
-		keys := make([]string, 0, len(v))
-		for k := range v {
-			if k == "sign" {
-				continue
-			}
-			keys = append(keys, k)
-		}
-		sort.Strings(keys)
-		var buf bytes.Buffer
-		for _, k := range keys {
-			if v[k] == "" {
-				continue
-			}
-			if buf.Len() > 0 {
-				buf.WriteByte('&')
-			}
-			buf.WriteString(k)
-			buf.WriteByte('=')
-			switch vv := v[k].(type) {
-			case string:
-				buf.WriteString(vv)
-			case int:
-				buf.WriteString(strconv.FormatInt(int64(vv), 10))
-			default:
-				panic("params type not supported")
-			}
-		}
-		buf.WriteString(bizKey)
-		returnStr = buf.String()
-		fmt.Println(returnStr)
-	}
-	return
-}
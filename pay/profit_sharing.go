@@ -1,26 +1,20 @@
 package pay
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
 	"encoding/xml"
-	"errors"
-	"github.com/fintcloud/wechat/util"
-	"strings"
 	"time"
 )
 
 const (
-	profitSharingUrl = "https://api.mch.weixin.qq.com/secapi/pay/profitsharing"
-	multiProfitSharingUrl = "https://api.mch.weixin.qq.com/secapi/pay/multiprofitsharing"
-	profitSharingQueryUrl = "https://api.mch.weixin.qq.com/pay/profitsharingquery"
-	profitSharingAddReceiverUrl = "https://api.mch.weixin.qq.com/pay/profitsharingaddreceiver"
-	profitSharingRemoveReceiverUrl = "https://api.mch.weixin.qq.com/pay/profitsharingremovereceiver"
-	profitSharingFinishUrl = "https://api.mch.weixin.qq.com/secapi/pay/profitsharingfinish"
-	profitSharingReturnUrl = "https://api.mch.weixin.qq.com/secapi/pay/profitsharingreturn"
-	profitSharingReturnQueryUrl = "https://api.mch.weixin.qq.com/pay/profitsharingreturnquery"
+	profitSharingPath               = "/secapi/pay/profitsharing"
+	multiProfitSharingPath          = "/secapi/pay/multiprofitsharing"
+	profitSharingQueryPath          = "/pay/profitsharingquery"
+	profitSharingAddReceiverPath    = "/pay/profitsharingaddreceiver"
+	profitSharingRemoveReceiverPath = "/pay/profitsharingremovereceiver"
+	profitSharingFinishPath         = "/secapi/pay/profitsharingfinish"
+	profitSharingReturnPath         = "/secapi/pay/profitsharingreturn"
+	profitSharingReturnQueryPath    = "/pay/profitsharingreturnquery"
 )
 
 type ReceiverType string
@@ -112,6 +106,7 @@ type ProfitSharingResponse struct {
 	Sign          string   `xml:"sign"`
 }
 
+//NotifyProfitSharing v3 回调通知，支付、退款和分账通知使用相同的结构，resource 使用 V3Client.Decrypt 解密
 type NotifyProfitSharing struct {
 	Id           string `json:"id"`
 	CreateTime   string `json:"create_time"`
@@ -127,6 +122,7 @@ type NotifyProfitSharing struct {
 	}`json:"resource"`
 }
 
+//ProfitSharingResult 分账动账通知解密后的内容
 type ProfitSharingResult struct {
 	Mchid         string `json:"mchid"`
 	SpMchid       string `json:"sp_mchid"`
@@ -143,128 +139,55 @@ type ProfitSharingResult struct {
 	SuccessTime time.Time `json:"success_time"`
 }
 
+//NotifyProfitSharingResponse v3 回调通知的应答
 type NotifyProfitSharingResponse struct {
 	Code    string `json:"code"`
 	Message string `json:"message"`
 }
 
+//AddProfitSharingReveiver 添加分账接收方，使用 HMAC-SHA256 签名，result_code 不为 SUCCESS 时返回 *Error
 func (pcf *Pay) AddProfitSharingReveiver(receiver *ProfitSharingReceiver) (resAddReceiver *ProfitSharingAddReceiverResponse, err error) {
-	nonceStr := util.RandomStr(32)
 	receiverJson, err := json.Marshal(receiver)
 	if err != nil {
 		return
 	}
-	params := make(map[string]string)
-	params["mch_id"] = pcf.PayMchID
-	params["appid"] = pcf.AppID
-	params["nonce_str"] = nonceStr
-	params["sign_type"] = "HMAC-SHA256"
-	params["receiver"] = string(receiverJson)
-
-	str := orderParam(params, pcf.AppSecret)
-	//strMd5 := util.MD5Sum(str)
-	h := hmac.New(sha256.New, []byte(pcf.PayKey))
-	h.Write([]byte(str))
-	// 签名
-	sign := strings.ToUpper(hex.EncodeToString(h.Sum(nil)))
-
-	var request = ProfitSharingAddReceiverRequest{
-		MchId:		pcf.PayMchID,
-		Appid:		pcf.AppID,
-		NonceStr:	nonceStr,
-		Sign:		sign,
-		SignType: 	"HMAC-SHA256",
-		Receiver: 	string(receiverJson),
-	}
-
-	rawRet, err := util.PostXML(profitSharingAddReceiverUrl, request)
-	if err != nil {
-		return
+	params := map[string]string{
+		"mch_id":    pcf.PayMchID,
+		"appid":     pcf.AppID,
+		"sign_type": SignTypeHMACSHA256,
+		"receiver":  string(receiverJson),
 	}
-	var response = new(ProfitSharingAddReceiverResponse)
-	err = xml.Unmarshal(rawRet, &response)
-	if err != nil {
+	res := new(ProfitSharingAddReceiverResponse)
+	if _, err = pcf.request("AddProfitSharingReceiver", pcf.gateway(profitSharingAddReceiverPath), params, nil, res); err != nil {
 		return
 	}
-
-	if response.ReturnCode == "SUCCESS" {
-		// pay success
-		if response.ResultCode == "SUCCESS" {
-			err = nil
-			return
-		}
-		err = errors.New(response.ErrCode + response.ErrCodeDes)
-		return
-	}
-	err = errors.New("[msg : xmlUnmarshalError] [rawReturn : " + string(rawRet) + "] [params : " + str + "] [sign : " + sign + "]")
+	resAddReceiver = res
 	return
-
 }
 
+//ProfitSharing 请求单次分账，使用 HMAC-SHA256 签名，result_code 不为 SUCCESS 时返回 *Error
 func (pcf *Pay) ProfitSharing(orderNo string, wechatOrderNo string, receivers []ReceiverAmount) (resProfitSharing *ProfitSharingResponse, err error) {
-	nonceStr := util.RandomStr(32)
 	receiverJson, err := json.Marshal(receivers)
 	if err != nil {
 		return
 	}
-	params := make(map[string]string)
-	params["mch_id"] = pcf.PayMchID
-	params["appid"] = pcf.AppID
-	params["nonce_str"] = nonceStr
-	params["sign_type"] = "HMAC-SHA256"
-	params["transaction_id"] = wechatOrderNo
-	params["out_order_no"] = orderNo
-	params["receiver"] = string(receiverJson)
-
-	str := orderParam(params, pcf.AppSecret)
-	strMd5 := util.MD5Sum(str)
-	h := hmac.New(sha256.New, []byte(pcf.PayKey))
-	h.Write([]byte(strMd5))
-	// 签名
-	sign := strings.ToUpper(hex.EncodeToString(h.Sum(nil)))
-
-	var request = ProfitSharingRequest{
-		Appid:			pcf.AppID,
-		MchId:			pcf.PayMchID,
-		NonceStr:		nonceStr,
-		OutOrderNo: 	orderNo,
-		TransactionID:	wechatOrderNo,
-		Sign:			sign,
-		SignType: 		"HMAC-SHA256",
-		Receivers: 		string(receiverJson),
-	}
-
-	rawRet, err := util.PostXML(profitSharingUrl, request)
-	if err != nil {
-		return
+	params := map[string]string{
+		"mch_id":         pcf.PayMchID,
+		"appid":          pcf.AppID,
+		"sign_type":      SignTypeHMACSHA256,
+		"transaction_id": wechatOrderNo,
+		"out_order_no":   orderNo,
+		"receivers":      string(receiverJson),
 	}
-	var response = new(ProfitSharingResponse)
-	err = xml.Unmarshal(rawRet, &response)
+	//请求单次分账需要商户证书
+	client, err := pcf.tlsClient("")
 	if err != nil {
 		return
 	}
-
-	if response.ReturnCode == "SUCCESS" {
-		// pay success
-		if response.ResultCode == "SUCCESS" {
-			err = nil
-			return
-		}
-		err = errors.New(response.ErrCode + response.ErrCodeDes)
+	res := new(ProfitSharingResponse)
+	if _, err = pcf.request("ProfitSharing", pcf.gateway(profitSharingPath), params, client, res); err != nil {
 		return
 	}
-	err = errors.New("[msg : xmlUnmarshalError] [rawReturn : " + string(rawRet) + "] [params : " + str + "] [sign : " + sign + "]")
+	resProfitSharing = res
 	return
-
 }
-
-
-
-
-
-
-
-
-
-
-
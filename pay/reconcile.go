@@ -0,0 +1,397 @@
+package pay
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+//ReconcileStatus 对账结果
+type ReconcileStatus string
+
+//对账结果
+const (
+	ReconcileMatched         ReconcileStatus = "MATCHED"          //金额一致
+	ReconcileAmountMismatch  ReconcileStatus = "AMOUNT_MISMATCH"  //金额不一致
+	ReconcileMissingLocally  ReconcileStatus = "MISSING_LOCALLY"  //微信账单中有，商户系统中没有
+	ReconcileMissingRemotely ReconcileStatus = "MISSING_REMOTELY" //商户系统中有，微信账单中没有
+	ReconcileRefunded        ReconcileStatus = "REFUNDED"         //退款金额一致
+)
+
+//ReconcileKind 对账记录的类型
+type ReconcileKind string
+
+//对账记录的类型
+const (
+	ReconcileKindPayment  ReconcileKind = "PAYMENT"
+	ReconcileKindRefund   ReconcileKind = "REFUND"
+	ReconcileKindTransfer ReconcileKind = "TRANSFER"
+)
+
+//MerchantOrder 商户系统中已支付的订单，金额的单位为分
+type MerchantOrder struct {
+	OutTradeNo    string
+	TransactionID string //可以为空，为空时只按 OutTradeNo 匹配
+	TotalFee      int64
+}
+
+//MerchantRefund 商户系统中的退款，通常由 Pay.Refund 发起，可以使用 NewMerchantRefund 创建
+type MerchantRefund struct {
+	OutTradeNo    string
+	TransactionID string
+	OutRefundNo   string
+	RefundID      string
+	RefundFee     int64
+}
+
+//MerchantTransfer 商户系统中的企业付款，通常由 Pay.PayToPersonal 发起，可以使用 NewMerchantTransfer 创建
+type MerchantTransfer struct {
+	PartnerTradeNo string
+	PaymentNo      string
+	Amount         int64
+}
+
+//NewMerchantRefund 根据退款申请的参数和返回创建 MerchantRefund
+func NewMerchantRefund(p *RefundParams, res *RefundResponse) *MerchantRefund {
+	refundFee, _ := strconv.ParseInt(res.RefundFee, 10, 64)
+	if refundFee == 0 {
+		refundFee, _ = strconv.ParseInt(p.RefundFee, 10, 64)
+	}
+	return &MerchantRefund{
+		OutTradeNo:    res.OutTradeNo,
+		TransactionID: res.TransactionID,
+		OutRefundNo:   p.OutRefundNo,
+		RefundID:      res.RefundID,
+		RefundFee:     refundFee,
+	}
+}
+
+//NewMerchantTransfer 根据企业付款的参数和返回创建 MerchantTransfer
+func NewMerchantTransfer(p *PayToPersonalParams, res *PayToPersonalResponse) *MerchantTransfer {
+	amount, _ := strconv.ParseInt(p.Amount, 10, 64)
+	return &MerchantTransfer{
+		PartnerTradeNo: p.PartnerTradeNo,
+		PaymentNo:      res.PaymentNo,
+		Amount:         amount,
+	}
+}
+
+//OrderSource 提供商户系统中的订单和退款，billDate 的格式与账单相同，如 20140603
+type OrderSource interface {
+	//PaidOrders 返回 billDate 当天支付成功的订单，账单中没有的订单记为 MISSING_REMOTELY
+	PaidOrders(billDate string) ([]*MerchantOrder, error)
+	//Refunds 返回 billDate 当天发起的退款，账单中没有的退款记为 MISSING_REMOTELY
+	Refunds(billDate string) ([]*MerchantRefund, error)
+	//FindOrder 查找不在 PaidOrders 中的订单，例如跨天支付的订单，不存在时返回 nil
+	FindOrder(outTradeNo, transactionID string) (*MerchantOrder, error)
+	//FindRefund 查找不在 Refunds 中的退款，不存在时返回 nil
+	FindRefund(outRefundNo, refundID string) (*MerchantRefund, error)
+}
+
+//TransferSource 提供商户系统中的企业付款
+type TransferSource interface {
+	//Transfers 返回 billDate 当天的企业付款，资金账单中没有的记为 MISSING_REMOTELY
+	Transfers(billDate string) ([]*MerchantTransfer, error)
+	//FindTransfer 查找不在 Transfers 中的企业付款，不存在时返回 nil
+	FindTransfer(partnerTradeNo, paymentNo string) (*MerchantTransfer, error)
+}
+
+//ReconcileItem 一条对账记录，RemoteFee 为账单中的金额，LocalFee 为商户系统中的金额，单位为分
+type ReconcileItem struct {
+	Kind      ReconcileKind
+	Status    ReconcileStatus
+	OutNo     string //商户订单号、商户退款单号或商户付款单号
+	WechatNo  string //微信订单号、微信退款单号或微信付款单号
+	RemoteFee int64
+	LocalFee  int64
+
+	BillRow     *TradeBillRow //交易账单中的记录，MISSING_REMOTELY 时为 nil
+	FundFlowRow *FundFlowRow  //资金账单中的记录，只有企业付款有
+}
+
+//ReconcileReport 对账报告，Items 只包含不一致的记录，Counts 包含所有记录的数量
+type ReconcileReport struct {
+	BillDate    string
+	Counts      map[ReconcileStatus]int
+	Items       []*ReconcileItem
+	BillSummary *TradeBillSummary //交易账单的汇总，对账资金账单时为 nil
+}
+
+//OK 是否所有记录都一致
+func (report *ReconcileReport) OK() bool {
+	return len(report.Items) == 0
+}
+
+func (report *ReconcileReport) add(item *ReconcileItem) {
+	report.Counts[item.Status]++
+	if item.Status != ReconcileMatched && item.Status != ReconcileRefunded {
+		report.Items = append(report.Items, item)
+	}
+}
+
+//WriteText 以文本格式输出对账报告，每条不一致的记录一行
+func (report *ReconcileReport) WriteText(w io.Writer) error {
+	statuses := []ReconcileStatus{ReconcileMatched, ReconcileRefunded, ReconcileAmountMismatch, ReconcileMissingLocally, ReconcileMissingRemotely}
+	counts := make([]string, 0, len(statuses))
+	for _, status := range statuses {
+		counts = append(counts, fmt.Sprintf("%s=%d", status, report.Counts[status]))
+	}
+	if _, err := fmt.Fprintf(w, "bill_date=%s %s\n", report.BillDate, strings.Join(counts, " ")); err != nil {
+		return err
+	}
+	for _, item := range report.Items {
+		_, err := fmt.Fprintf(w, "%s %s out_no=%s wechat_no=%s remote_fee=%d local_fee=%d\n",
+			item.Status, item.Kind, item.OutNo, item.WechatNo, item.RemoteFee, item.LocalFee)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Reconciler 将微信账单与商户系统中的订单、退款和企业付款进行对账
+type Reconciler struct {
+	Orders    OrderSource
+	Transfers TransferSource //只有对账资金账单时需要
+}
+
+//NewReconciler 创建对账器
+func NewReconciler(orders OrderSource) *Reconciler {
+	return &Reconciler{Orders: orders}
+}
+
+//ReconcileTradeBill 逐行核对交易账单：支付成功的记录按 out_trade_no 或 transaction_id 匹配订单，
+//退款记录按 out_refund_no 或 refund_id 匹配退款，最后将账单中没有的订单和退款记为 MISSING_REMOTELY
+func (r *Reconciler) ReconcileTradeBill(billDate string, bill *TradeBillReader) (*ReconcileReport, error) {
+	orders, err := r.Orders.PaidOrders(billDate)
+	if err != nil {
+		return nil, err
+	}
+	refunds, err := r.Orders.Refunds(billDate)
+	if err != nil {
+		return nil, err
+	}
+	orderIndex := newReconcileIndex()
+	for i, order := range orders {
+		orderIndex.add(i, order.OutTradeNo, order.TransactionID)
+	}
+	refundIndex := newReconcileIndex()
+	for i, refund := range refunds {
+		refundIndex.add(i, refund.OutRefundNo, refund.RefundID)
+	}
+
+	report := &ReconcileReport{BillDate: billDate, Counts: make(map[ReconcileStatus]int)}
+	for {
+		row, err := bill.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var item *ReconcileItem
+		switch row.TradeState {
+		case TradeStateSuccess:
+			item, err = r.reconcilePayment(row, orders, orderIndex)
+		case TradeStateRefund:
+			item, err = r.reconcileRefund(row, refunds, refundIndex)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		report.add(item)
+	}
+	if report.BillSummary, err = bill.Summary(); err != nil {
+		return nil, err
+	}
+
+	for i, order := range orders {
+		if !orderIndex.seen[i] {
+			report.add(&ReconcileItem{Kind: ReconcileKindPayment, Status: ReconcileMissingRemotely,
+				OutNo: order.OutTradeNo, WechatNo: order.TransactionID, LocalFee: order.TotalFee})
+		}
+	}
+	for i, refund := range refunds {
+		if !refundIndex.seen[i] {
+			report.add(&ReconcileItem{Kind: ReconcileKindRefund, Status: ReconcileMissingRemotely,
+				OutNo: refund.OutRefundNo, WechatNo: refund.RefundID, LocalFee: refund.RefundFee})
+		}
+	}
+	return report, nil
+}
+
+func (r *Reconciler) reconcilePayment(row *TradeBillRow, orders []*MerchantOrder, index *reconcileIndex) (*ReconcileItem, error) {
+	item := &ReconcileItem{Kind: ReconcileKindPayment, OutNo: row.OutTradeNo, WechatNo: row.TransactionID, BillRow: row}
+	item.RemoteFee = row.TotalFee
+	if item.RemoteFee == 0 {
+		item.RemoteFee = row.SettlementTotalFee + row.CouponFee
+	}
+
+	var order *MerchantOrder
+	if i, ok := index.find(row.OutTradeNo, row.TransactionID); ok {
+		order = orders[i]
+	} else {
+		var err error
+		if order, err = r.Orders.FindOrder(row.OutTradeNo, row.TransactionID); err != nil {
+			return nil, err
+		}
+	}
+	if order == nil {
+		item.Status = ReconcileMissingLocally
+		return item, nil
+	}
+	item.LocalFee = order.TotalFee
+	item.Status = ReconcileMatched
+	if item.RemoteFee != item.LocalFee {
+		item.Status = ReconcileAmountMismatch
+	}
+	return item, nil
+}
+
+func (r *Reconciler) reconcileRefund(row *TradeBillRow, refunds []*MerchantRefund, index *reconcileIndex) (*ReconcileItem, error) {
+	item := &ReconcileItem{Kind: ReconcileKindRefund, OutNo: row.OutRefundNo, WechatNo: row.RefundID, BillRow: row}
+	item.RemoteFee = row.ApplyRefundFee
+	if item.RemoteFee == 0 {
+		item.RemoteFee = row.RefundFee + row.CouponRefundFee
+	}
+
+	var refund *MerchantRefund
+	if i, ok := index.find(row.OutRefundNo, row.RefundID); ok {
+		refund = refunds[i]
+	} else {
+		var err error
+		if refund, err = r.Orders.FindRefund(row.OutRefundNo, row.RefundID); err != nil {
+			return nil, err
+		}
+	}
+	if refund == nil {
+		item.Status = ReconcileMissingLocally
+		return item, nil
+	}
+	item.LocalFee = refund.RefundFee
+	item.Status = ReconcileRefunded
+	if item.RemoteFee != item.LocalFee {
+		item.Status = ReconcileAmountMismatch
+	}
+	return item, nil
+}
+
+//ReconcileFundFlow 核对资金账单中的企业付款，按业务凭证号匹配商户付款单号，按微信支付业务单号匹配微信付款单号
+func (r *Reconciler) ReconcileFundFlow(billDate string, flow *FundFlowReader) (*ReconcileReport, error) {
+	if r.Transfers == nil {
+		return nil, fmt.Errorf("wechatpay : reconcile fund flow without TransferSource")
+	}
+	transfers, err := r.Transfers.Transfers(billDate)
+	if err != nil {
+		return nil, err
+	}
+	index := newReconcileIndex()
+	for i, transfer := range transfers {
+		index.add(i, transfer.PartnerTradeNo, transfer.PaymentNo)
+	}
+
+	report := &ReconcileReport{BillDate: billDate, Counts: make(map[ReconcileStatus]int)}
+	for {
+		row, err := flow.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !isTransferFundFlow(row) {
+			continue
+		}
+		item := &ReconcileItem{Kind: ReconcileKindTransfer, OutNo: row.BizVoucherID, WechatNo: row.BizTransactionID, FundFlowRow: row}
+		item.RemoteFee = row.Amount
+		if item.RemoteFee < 0 {
+			item.RemoteFee = -item.RemoteFee
+		}
+
+		var transfer *MerchantTransfer
+		if i, ok := index.find(row.BizVoucherID, row.BizTransactionID); ok {
+			transfer = transfers[i]
+		} else if transfer, err = r.Transfers.FindTransfer(row.BizVoucherID, row.BizTransactionID); err != nil {
+			return nil, err
+		}
+		switch {
+		case transfer == nil:
+			item.Status = ReconcileMissingLocally
+		case transfer.Amount != item.RemoteFee:
+			item.LocalFee = transfer.Amount
+			item.Status = ReconcileAmountMismatch
+		default:
+			item.LocalFee = transfer.Amount
+			item.Status = ReconcileMatched
+		}
+		report.add(item)
+	}
+
+	for i, transfer := range transfers {
+		if !index.seen[i] {
+			report.add(&ReconcileItem{Kind: ReconcileKindTransfer, Status: ReconcileMissingRemotely,
+				OutNo: transfer.PartnerTradeNo, WechatNo: transfer.PaymentNo, LocalFee: transfer.Amount})
+		}
+	}
+	return report, nil
+}
+
+//isTransferFundFlow 是否为企业付款的支出记录，企业付款退回等其他记录不参与对账
+func isTransferFundFlow(row *FundFlowRow) bool {
+	return row.BizType == "企业付款" && row.FinancialType == "支出"
+}
+
+//Reconcile 下载 billDate 的全部交易账单并对账
+func (pcf *Pay) Reconcile(billDate string, r *Reconciler) (*ReconcileReport, error) {
+	body, err := pcf.DownloadBill(&DownloadBillRequest{BillDate: billDate, BillType: BillTypeAll, TarType: TarTypeGZIP})
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return r.ReconcileTradeBill(billDate, NewTradeBillReader(body))
+}
+
+//ReconcileTransfers 下载 billDate 的基本账户资金账单并核对企业付款，需要先在 Pay 上设置商户 API 证书
+func (pcf *Pay) ReconcileTransfers(billDate string, r *Reconciler) (*ReconcileReport, error) {
+	body, err := pcf.DownloadFundFlow(&DownloadFundFlowRequest{BillDate: billDate, AccountType: AccountTypeBasic, TarType: TarTypeGZIP})
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return r.ReconcileFundFlow(billDate, NewFundFlowReader(body))
+}
+
+//reconcileIndex 按商户单号和微信单号查找商户记录的下标，并记录已经出现在账单中的记录
+type reconcileIndex struct {
+	byOutNo    map[string]int
+	byWechatNo map[string]int
+	seen       map[int]bool
+}
+
+func newReconcileIndex() *reconcileIndex {
+	return &reconcileIndex{byOutNo: make(map[string]int), byWechatNo: make(map[string]int), seen: make(map[int]bool)}
+}
+
+func (index *reconcileIndex) add(i int, outNo, wechatNo string) {
+	if outNo != "" {
+		index.byOutNo[outNo] = i
+	}
+	if wechatNo != "" {
+		index.byWechatNo[wechatNo] = i
+	}
+}
+
+func (index *reconcileIndex) find(outNo, wechatNo string) (int, bool) {
+	i, ok := index.byOutNo[outNo]
+	if !ok {
+		i, ok = index.byWechatNo[wechatNo]
+	}
+	if !ok {
+		return 0, false
+	}
+	index.seen[i] = true
+	return i, true
+}
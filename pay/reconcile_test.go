@@ -0,0 +1,89 @@
+package pay
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+type testOrderSource struct {
+	orders    []*MerchantOrder
+	refunds   []*MerchantRefund
+	transfers []*MerchantTransfer
+}
+
+func (s *testOrderSource) PaidOrders(billDate string) ([]*MerchantOrder, error) {
+	return s.orders, nil
+}
+
+func (s *testOrderSource) Refunds(billDate string) ([]*MerchantRefund, error) {
+	return s.refunds, nil
+}
+
+func (s *testOrderSource) FindOrder(outTradeNo, transactionID string) (*MerchantOrder, error) {
+	return nil, nil
+}
+
+func (s *testOrderSource) FindRefund(outRefundNo, refundID string) (*MerchantRefund, error) {
+	return nil, nil
+}
+
+func (s *testOrderSource) Transfers(billDate string) ([]*MerchantTransfer, error) {
+	return s.transfers, nil
+}
+
+func (s *testOrderSource) FindTransfer(partnerTradeNo, paymentNo string) (*MerchantTransfer, error) {
+	return nil, nil
+}
+
+func TestReconcileTradeBill(t *testing.T) {
+	source := &testOrderSource{
+		orders: []*MerchantOrder{
+			{OutTradeNo: "1415640626", TotalFee: 1},
+			{OutTradeNo: "1415640999", TotalFee: 5},
+		},
+		refunds: []*MerchantRefund{
+			{OutTradeNo: "1415635270", OutRefundNo: "1415640626", RefundFee: 2},
+		},
+	}
+	report, err := NewReconciler(source).ReconcileTradeBill("20141110", NewTradeBillReader(strings.NewReader(testTradeBill)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Counts[ReconcileMatched] != 1 || report.Counts[ReconcileAmountMismatch] != 1 || report.Counts[ReconcileMissingRemotely] != 1 {
+		t.Errorf("unexpected counts %v", report.Counts)
+	}
+	if len(report.Items) != 2 || report.Items[0].Kind != ReconcileKindRefund || report.Items[0].RemoteFee != 1 || report.Items[0].LocalFee != 2 {
+		t.Errorf("unexpected items %+v", report.Items)
+	}
+	if report.BillSummary == nil || report.BillSummary.TotalCount != 2 {
+		t.Errorf("unexpected summary %+v", report.BillSummary)
+	}
+
+	var buf bytes.Buffer
+	if err = report.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "MISSING_REMOTELY PAYMENT out_no=1415640999") {
+		t.Errorf("unexpected report\n%s", buf.String())
+	}
+}
+
+func TestReconcileFundFlow(t *testing.T) {
+	bill := "记账时间,微信支付业务单号,资金流水单号,业务名称,业务类型,收支类型,收支金额（元）,账户结余（元）,资金变更提交申请人,备注,业务凭证号\n" +
+		"`2018-02-01 04:21:23,`1000018301201505190181489473,`1900009231201802015884652186,`企业付款,`企业付款,`支出,`1.00,`0.17,`system,`,`10000098201411111234567890\n" +
+		"`2018-02-01 05:21:23,`1000018301201505190181489474,`1900009231201802015884652187,`企业付款,`企业付款,`支出,`2.00,`0.17,`system,`,`10000098201411111234567891\n" +
+		"资金流水总笔数,收入笔数,收入金额,支出笔数,支出金额\n" +
+		"`2,`0,`0.00,`2,`3.00\n"
+	source := &testOrderSource{transfers: []*MerchantTransfer{
+		NewMerchantTransfer(&PayToPersonalParams{PartnerTradeNo: "10000098201411111234567890", Amount: "100"}, &PayToPersonalResponse{PaymentNo: "1000018301201505190181489473"}),
+	}}
+	reconciler := &Reconciler{Orders: source, Transfers: source}
+	report, err := reconciler.ReconcileFundFlow("20180201", NewFundFlowReader(strings.NewReader(bill)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Counts[ReconcileMatched] != 1 || report.Counts[ReconcileMissingLocally] != 1 || report.OK() {
+		t.Errorf("unexpected counts %v", report.Counts)
+	}
+}
@@ -1,37 +1,34 @@
 package pay
 
 import (
-	"encoding/xml"
-	"fmt"
+	"errors"
+	"strconv"
+)
 
-	"github.com/fintcloud/wechat/util"
+const (
+	refundPath      = "/secapi/pay/refund"
+	refundQueryPath = "/pay/refundquery"
 )
 
-var refundGateway = "https://api.mch.weixin.qq.com/secapi/pay/refund"
+//退款状态 refund_status
+const (
+	RefundStatusSuccess     = "SUCCESS"
+	RefundStatusRefundClose = "REFUNDCLOSE"
+	RefundStatusProcessing  = "PROCESSING"
+	RefundStatusChange      = "CHANGE"
+)
 
 //RefundParams 调用参数
 type RefundParams struct {
 	TransactionID string
+	OutTradeNo    string //与 TransactionID 二选一
 	OutRefundNo   string
 	TotalFee      string
 	RefundFee     string
 	RefundDesc    string
-	RootCa        string //ca证书
-}
-
-//refundRequest 接口请求参数
-type refundRequest struct {
-	AppID         string `xml:"appid"`
-	MchID         string `xml:"mch_id"`
-	NonceStr      string `xml:"nonce_str"`
-	Sign          string `xml:"sign"`
-	SignType      string `xml:"sign_type,omitempty"`
-	TransactionID string `xml:"transaction_id"`
-	OutRefundNo   string `xml:"out_refund_no"`
-	TotalFee      string `xml:"total_fee"`
-	RefundFee     string `xml:"refund_fee"`
-	RefundDesc    string `xml:"refund_desc,omitempty"`
-	//NotifyUrl     string `xml:"notify_url,omitempty"`
+	NotifyURL     string //退款结果通知地址，为空时使用商户平台上配置的地址
+	SignType      string
+	RootCa        string //ca证书路径，为空时使用 Pay 上设置的证书
 }
 
 //RefundResponse 接口返回
@@ -58,52 +55,152 @@ type RefundResponse struct {
 	CashFeeType         string `xml:"cash_fee_type,omitempty"`
 }
 
-//Refund 退款申请
+//Refund 退款申请，签名方式取自 p.SignType，为空时为 MD5
 func (pcf *Pay) Refund(p *RefundParams) (rsp RefundResponse, err error) {
-	nonceStr := util.RandomStr(32)
-	param := make(map[string]interface{})
-	param["appid"] = pcf.AppID
-	param["mch_id"] = pcf.PayMchID
-	param["nonce_str"] = nonceStr
-	param["out_refund_no"] = p.OutRefundNo
-	param["refund_desc"] = p.RefundDesc
-	param["refund_fee"] = p.RefundFee
-	param["total_fee"] = p.TotalFee
-	param["sign_type"] = "MD5"
-	param["transaction_id"] = p.TransactionID
-
-	bizKey := "&key=" + pcf.PayKey
-	str := orderParam(param, bizKey)
-	sign := util.MD5Sum(str)
-	request := refundRequest{
-		AppID:         pcf.AppID,
-		MchID:         pcf.PayMchID,
-		NonceStr:      nonceStr,
-		Sign:          sign,
-		SignType:      "MD5",
-		TransactionID: p.TransactionID,
-		OutRefundNo:   p.OutRefundNo,
-		TotalFee:      p.TotalFee,
-		RefundFee:     p.RefundFee,
-		RefundDesc:    p.RefundDesc,
-	}
-	rawRet, err := util.PostXMLWithTLS(refundGateway, request, p.RootCa, pcf.PayMchID)
+	client, err := pcf.tlsClient(p.RootCa)
 	if err != nil {
 		return
 	}
-	err = xml.Unmarshal(rawRet, &rsp)
+	params := map[string]string{
+		"appid":          pcf.AppID,
+		"mch_id":         pcf.PayMchID,
+		"sign_type":      p.SignType,
+		"transaction_id": p.TransactionID,
+		"out_trade_no":   p.OutTradeNo,
+		"out_refund_no":  p.OutRefundNo,
+		"total_fee":      p.TotalFee,
+		"refund_fee":     p.RefundFee,
+		"refund_desc":    p.RefundDesc,
+		"notify_url":     p.NotifyURL,
+	}
+	_, err = pcf.request("Refund", pcf.gateway(refundPath), params, client, &rsp)
+	return
+}
+
+//RefundQueryRequest 查询退款参数，RefundID、OutRefundNo、TransactionID、OutTradeNo 四选一，
+//按订单查询时通过 Offset 分页，每页最多返回 10 笔退款
+type RefundQueryRequest struct {
+	TransactionID string
+	OutTradeNo    string
+	OutRefundNo   string
+	RefundID      string
+	Offset        int
+	SignType      string
+}
+
+//RefundQueryResponse 查询退款返回
+type RefundQueryResponse struct {
+	Base
+	ReturnCode         string `xml:"return_code"`
+	ReturnMsg          string `xml:"return_msg"`
+	ResultCode         string `xml:"result_code"`
+	ErrCode            string `xml:"err_code"`
+	ErrCodeDes         string `xml:"err_code_des"`
+	TransactionID      string `xml:"transaction_id"`
+	OutTradeNo         string `xml:"out_trade_no"`
+	TotalFee           int64  `xml:"total_fee"`
+	SettlementTotalFee int64  `xml:"settlement_total_fee"`
+	FeeType            string `xml:"fee_type"`
+	CashFee            int64  `xml:"cash_fee"`
+	TotalRefundCount   int    `xml:"total_refund_count"` //订单总共已发生的退款次数，按订单查询时返回
+	RefundCount        int    `xml:"refund_count"`       //本次返回的退款笔数
+
+	Refunds []RefundItem `xml:"-"`
+}
+
+//RefundItem 查询退款返回的单笔退款，对应 out_refund_no_$n 等字段
+type RefundItem struct {
+	OutRefundNo         string
+	RefundID            string
+	RefundChannel       string
+	RefundFee           int64
+	SettlementRefundFee int64
+	RefundStatus        string
+	RefundAccount       string
+	RefundRecvAccout    string
+	RefundSuccessTime   string
+	Coupons             []Coupon
+}
+
+//RefundQuery 查询退款，按订单查询时总是带上 offset 以便返回 TotalRefundCount
+func (pcf *Pay) RefundQuery(req *RefundQueryRequest) (*RefundQueryResponse, error) {
+	params := map[string]string{
+		"appid":          pcf.AppID,
+		"mch_id":         pcf.PayMchID,
+		"sign_type":      req.SignType,
+		"transaction_id": req.TransactionID,
+		"out_trade_no":   req.OutTradeNo,
+		"out_refund_no":  req.OutRefundNo,
+		"refund_id":      req.RefundID,
+	}
+	if req.RefundID == "" && req.OutRefundNo == "" {
+		params["offset"] = strconv.Itoa(req.Offset)
+	}
+	res := new(RefundQueryResponse)
+	resParams, err := pcf.request("RefundQuery", pcf.gateway(refundQueryPath), params, nil, res)
 	if err != nil {
-		return
+		return nil, err
 	}
-	if rsp.ReturnCode == "SUCCESS" {
-		if rsp.ResultCode == "SUCCESS" {
-			err = nil
-			return
+	res.Refunds = parseRefundItems(resParams, res.RefundCount)
+	return res, nil
+}
+
+//RefundQueryAll 按订单查询全部退款，自动翻页，返回的 RefundQueryResponse.Refunds 包含所有页的退款
+//
+//只支持按 TransactionID 或 OutTradeNo 查询，按退款单号查询请使用 RefundQuery
+func (pcf *Pay) RefundQueryAll(req *RefundQueryRequest) (*RefundQueryResponse, error) {
+	if req.TransactionID == "" && req.OutTradeNo == "" {
+		return nil, errors.New("wechatpay : RefundQueryAll requires transaction_id or out_trade_no")
+	}
+	page := *req
+	page.OutRefundNo, page.RefundID, page.Offset = "", "", 0
+	var res *RefundQueryResponse
+	for {
+		pageRes, err := pcf.RefundQuery(&page)
+		if err != nil {
+			return nil, err
+		}
+		if res == nil {
+			res = pageRes
+		} else {
+			res.Refunds = append(res.Refunds, pageRes.Refunds...)
+		}
+		page.Offset += len(pageRes.Refunds)
+		if len(pageRes.Refunds) == 0 || page.Offset >= pageRes.TotalRefundCount {
+			break
 		}
-		err = fmt.Errorf("refund error, errcode=%s,errmsg=%s", rsp.ErrCode, rsp.ErrCodeDes)
-		return
 	}
-	err = fmt.Errorf("[msg : xmlUnmarshalError] [rawReturn : %s] [params : %s] [sign : %s]",
-		string(rawRet), str, sign)
-	return
+	res.RefundCount = len(res.Refunds)
+	return res, nil
+}
+
+//parseRefundItems 读取 out_refund_no_$n 等字段，每笔退款的优惠为 coupon_refund_id_$n_$m 等字段
+func parseRefundItems(params map[string]string, count int) []RefundItem {
+	var items []RefundItem
+	for i := 0; i < count; i++ {
+		n := "_" + strconv.Itoa(i)
+		if _, ok := params["out_refund_no"+n]; !ok {
+			break
+		}
+		item := RefundItem{
+			OutRefundNo:       params["out_refund_no"+n],
+			RefundID:          params["refund_id"+n],
+			RefundChannel:     params["refund_channel"+n],
+			RefundStatus:      params["refund_status"+n],
+			RefundAccount:     params["refund_account"+n],
+			RefundRecvAccout:  params["refund_recv_accout"+n],
+			RefundSuccessTime: params["refund_success_time"+n],
+		}
+		item.RefundFee, _ = strconv.ParseInt(params["refund_fee"+n], 10, 64)
+		item.SettlementRefundFee, _ = strconv.ParseInt(params["settlement_refund_fee"+n], 10, 64)
+
+		couponCount, _ := strconv.Atoi(params["coupon_refund_count"+n])
+		for j := 0; j < couponCount; j++ {
+			m := n + "_" + strconv.Itoa(j)
+			fee, _ := strconv.ParseInt(params["coupon_refund_fee"+m], 10, 64)
+			item.Coupons = append(item.Coupons, Coupon{ID: params["coupon_refund_id"+m], Type: params["coupon_type"+m], Fee: fee})
+		}
+		items = append(items, item)
+	}
+	return items
 }
@@ -0,0 +1,134 @@
+package pay
+
+import (
+	"crypto/aes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+//RefundNotify 退款结果通知，退款信息在 req_info 中加密，通知本身没有签名
+type RefundNotify struct {
+	ReturnCode string `xml:"return_code"`
+	ReturnMsg  string `xml:"return_msg"`
+	AppID      string `xml:"appid"`
+	MchID      string `xml:"mch_id"`
+	NonceStr   string `xml:"nonce_str"`
+	ReqInfo    string `xml:"req_info"`
+}
+
+//RefundNotifyResult 退款结果通知中 req_info 解密后的内容
+type RefundNotifyResult struct {
+	TransactionID       string `xml:"transaction_id"`
+	OutTradeNo          string `xml:"out_trade_no"`
+	RefundID            string `xml:"refund_id"`
+	OutRefundNo         string `xml:"out_refund_no"`
+	TotalFee            int64  `xml:"total_fee"`
+	SettlementTotalFee  int64  `xml:"settlement_total_fee"`
+	RefundFee           int64  `xml:"refund_fee"`
+	SettlementRefundFee int64  `xml:"settlement_refund_fee"`
+	RefundStatus        string `xml:"refund_status"`
+	SuccessTime         string `xml:"success_time"`
+	RefundRecvAccout    string `xml:"refund_recv_accout"`
+	RefundAccount       string `xml:"refund_account"`
+	RefundRequestSource string `xml:"refund_request_source"`
+}
+
+//DecryptRefundReqInfo 解密退款结果通知中的 req_info：
+//base64 解码后使用 AES-256-ECB 解密，密钥为商户 key 的 MD5 小写十六进制，去掉 PKCS#7 填充
+func DecryptRefundReqInfo(reqInfo, apiKey string) ([]byte, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(reqInfo)
+	if err != nil {
+		return nil, fmt.Errorf("wechatpay : decode req_info error : %v", err)
+	}
+	sum := md5.Sum([]byte(apiKey))
+	block, err := aes.NewCipher([]byte(hex.EncodeToString(sum[:])))
+	if err != nil {
+		return nil, err
+	}
+	size := block.BlockSize()
+	if len(ciphertext) == 0 || len(ciphertext)%size != 0 {
+		return nil, errors.New("wechatpay : req_info is not a multiple of the block size")
+	}
+	plain := make([]byte, len(ciphertext))
+	for i := 0; i < len(ciphertext); i += size {
+		block.Decrypt(plain[i:i+size], ciphertext[i:i+size])
+	}
+
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > size {
+		return nil, errors.New("wechatpay : invalid req_info padding")
+	}
+	for _, b := range plain[len(plain)-padding:] {
+		if int(b) != padding {
+			return nil, errors.New("wechatpay : invalid req_info padding")
+		}
+	}
+	return plain[:len(plain)-padding], nil
+}
+
+//ParseRefundNotify 解析退款结果通知并解密 req_info
+func (pcf *Pay) ParseRefundNotify(data []byte) (*RefundNotify, *RefundNotifyResult, error) {
+	notify := new(RefundNotify)
+	if err := xml.Unmarshal(data, notify); err != nil {
+		return nil, nil, fmt.Errorf("wechatpay : decode refund notify error : %v", err)
+	}
+	if notify.ReturnCode != "SUCCESS" {
+		return notify, nil, fmt.Errorf("wechatpay : refund notify return_code=%s , return_msg=%s", notify.ReturnCode, notify.ReturnMsg)
+	}
+	plain, err := DecryptRefundReqInfo(notify.ReqInfo, pcf.PayKey)
+	if err != nil {
+		return notify, nil, err
+	}
+	result := new(RefundNotifyResult)
+	if err = xml.Unmarshal(plain, result); err != nil {
+		return notify, nil, fmt.Errorf("wechatpay : decode req_info error : %v", err)
+	}
+	return notify, result, nil
+}
+
+//RefundNotifyHandler 处理退款结果通知的 http.Handler，
+//与 NotifyHandler 相同，按 refund_id 和 refund_status 去重，Handle 返回错误时应答 FAIL
+type RefundNotifyHandler struct {
+	Pay    *Pay
+	Handle func(notify *RefundNotify, result *RefundNotifyResult) error
+
+	dedup notifyDedup
+}
+
+//NewRefundNotifyHandler 创建退款结果通知处理器
+func (pcf *Pay) NewRefundNotifyHandler(handle func(notify *RefundNotify, result *RefundNotifyResult) error) *RefundNotifyHandler {
+	return &RefundNotifyHandler{Pay: pcf, Handle: handle}
+}
+
+//ServeHTTP 实现 http.Handler
+func (h *RefundNotifyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxNotifyBodySize))
+	if err != nil {
+		writeNotifyResp(w, err.Error())
+		return
+	}
+	notify, result, err := h.Pay.ParseRefundNotify(data)
+	if err != nil {
+		writeNotifyResp(w, err.Error())
+		return
+	}
+
+	var id string
+	if result.RefundID != "" {
+		id = "refund_" + result.RefundID + "_" + result.RefundStatus
+	}
+	err = h.dedup.do(h.Pay, id, func() error {
+		return h.Handle(notify, result)
+	})
+	if err != nil {
+		writeNotifyResp(w, err.Error())
+		return
+	}
+	writeNotifyResp(w, "")
+}
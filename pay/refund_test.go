@@ -0,0 +1,98 @@
+package pay
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/fintcloud/wechat/cache"
+	"github.com/fintcloud/wechat/context"
+)
+
+func encryptTestReqInfo(plain string) string {
+	sum := md5.Sum([]byte(testPayKey))
+	block, _ := aes.NewCipher([]byte(hex.EncodeToString(sum[:])))
+	padding := aes.BlockSize - len(plain)%aes.BlockSize
+	data := append([]byte(plain), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	for i := 0; i < len(data); i += aes.BlockSize {
+		block.Encrypt(data[i:i+aes.BlockSize], data[i:i+aes.BlockSize])
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func TestRefundNotifyHandler(t *testing.T) {
+	pay := NewPay(&context.Context{PayMchID: "1900000001", PayKey: testPayKey, Cache: cache.NewMemory()})
+	reqInfo := encryptTestReqInfo("<root><out_refund_no><![CDATA[131811191610442717309]]></out_refund_no>" +
+		"<refund_id><![CDATA[50000408942018111907145868882]]></refund_id><refund_fee><![CDATA[3960]]></refund_fee>" +
+		"<refund_status><![CDATA[SUCCESS]]></refund_status></root>")
+	data := "<xml><return_code>SUCCESS</return_code><mch_id>1900000001</mch_id><req_info>" + reqInfo + "</req_info></xml>"
+
+	var got []*RefundNotifyResult
+	handler := pay.NewRefundNotifyHandler(func(notify *RefundNotify, result *RefundNotifyResult) error {
+		got = append(got, result)
+		return nil
+	})
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/refund", strings.NewReader(data)))
+		if !strings.Contains(w.Body.String(), "SUCCESS") {
+			t.Fatalf("unexpected response %s", w.Body.String())
+		}
+	}
+	if len(got) != 1 || got[0].RefundFee != 3960 || got[0].RefundStatus != RefundStatusSuccess {
+		t.Errorf("unexpected results %+v", got)
+	}
+
+	if _, err := DecryptRefundReqInfo(reqInfo, "other"); err == nil {
+		t.Error("expected error for wrong key")
+	}
+}
+
+func TestRefundQueryAll(t *testing.T) {
+	pay, done := newTestPayServer(t, map[string]testPayHandler{refundQueryPath: func(w http.ResponseWriter, params map[string]string) map[string]string {
+		offset, _ := strconv.Atoi(params["offset"])
+		response := map[string]string{
+			"return_code":        "SUCCESS",
+			"result_code":        "SUCCESS",
+			"out_trade_no":       params["out_trade_no"],
+			"total_refund_count": "12",
+		}
+		count := 0
+		for i := offset; i < 12 && count < 10; i++ {
+			n := "_" + strconv.Itoa(count)
+			response["out_refund_no"+n] = "R" + strconv.Itoa(i)
+			response["refund_fee"+n] = "1"
+			response["coupon_refund_count"+n] = "1"
+			response["coupon_refund_id"+n+"_0"] = "C" + strconv.Itoa(i)
+			count++
+		}
+		response["refund_count"] = strconv.Itoa(count)
+		return response
+	}})
+	defer done()
+
+	res, err := pay.RefundQueryAll(&RefundQueryRequest{OutTradeNo: "1409811653"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Refunds) != 12 || res.Refunds[11].OutRefundNo != "R11" || res.Refunds[11].Coupons[0].ID != "C11" {
+		t.Errorf("unexpected refunds %+v", res.Refunds)
+	}
+	if _, err = pay.RefundQueryAll(&RefundQueryRequest{OutRefundNo: "R1"}); err == nil {
+		t.Error("expected error when querying all refunds without an order")
+	}
+}
+
+func TestRefundWithoutCertificate(t *testing.T) {
+	pay := NewPay(&context.Context{AppID: "wx2421b1c4370ec43b", PayMchID: "1900000001", PayKey: testPayKey})
+	if _, err := pay.Refund(&RefundParams{OutTradeNo: "1409811653", OutRefundNo: "R1", TotalFee: "1", RefundFee: "1"}); err != ErrCertificateNotSet {
+		t.Errorf("expected ErrCertificateNotSet, got %v", err)
+	}
+}
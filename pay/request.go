@@ -0,0 +1,162 @@
+package pay
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fintcloud/wechat/util"
+)
+
+//常见的 err_code
+const (
+	ErrCodeSystemError   = "SYSTEMERROR"
+	ErrCodeOrderNotExist = "ORDERNOTEXIST"
+	ErrCodeOrderPaid     = "ORDERPAID"
+	ErrCodeOrderClosed   = "ORDERCLOSED"
+	ErrCodeOrderReversed = "ORDERREVERSED"
+	ErrCodeUserPaying    = "USERPAYING"
+	ErrCodeBankError     = "BANKERROR"
+)
+
+//Error 微信支付 v2 接口返回的错误，return_code 不为 SUCCESS 时通常只有 ReturnCode 和 ReturnMsg
+type Error struct {
+	APIName    string
+	ReturnCode string
+	ReturnMsg  string
+	ErrCode    string
+	ErrCodeDes string
+}
+
+//Error 实现 error 接口
+func (e *Error) Error() string {
+	if e.ErrCode == "" {
+		return fmt.Sprintf("%s Error , return_code=%s , return_msg=%s", e.APIName, e.ReturnCode, e.ReturnMsg)
+	}
+	return fmt.Sprintf("%s Error , err_code=%s , err_code_des=%s", e.APIName, e.ErrCode, e.ErrCodeDes)
+}
+
+//IsErrCode 判断 err 是否为指定 err_code 的 Error，支持被 fmt.Errorf("%w") 包装的错误
+func IsErrCode(err error, codes ...string) bool {
+	var payErr *Error
+	if !errors.As(err, &payErr) {
+		return false
+	}
+	for _, code := range codes {
+		if payErr.ErrCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+//Coupon 订单使用的代金券或立减优惠
+type Coupon struct {
+	ID   string
+	Type string
+	Fee  int64
+}
+
+//parseCoupons 按照 coupon_count 读取 coupon_id_$n、coupon_type_$n 和 coupon_fee_$n
+func parseCoupons(params map[string]string) []Coupon {
+	count, _ := strconv.Atoi(params["coupon_count"])
+	var coupons []Coupon
+	for i := 0; i < count; i++ {
+		n := strconv.Itoa(i)
+		id, ok := params["coupon_id_"+n]
+		if !ok {
+			break
+		}
+		fee, _ := strconv.ParseInt(params["coupon_fee_"+n], 10, 64)
+		coupons = append(coupons, Coupon{ID: id, Type: params["coupon_type_"+n], Fee: fee})
+	}
+	return coupons
+}
+
+//xmlParams 按 key 排序序列化为 <xml><key>value</key>...</xml>，忽略空值
+type xmlParams map[string]string
+
+//MarshalXML 实现 xml.Marshaler
+func (p xmlParams) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	keys := make([]string, 0, len(p))
+	for k, v := range p {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	start = xml.StartElement{Name: xml.Name{Local: "xml"}}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := e.EncodeElement(p[k], xml.StartElement{Name: xml.Name{Local: k}}); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+//unsignedResponseAPIs 应答中没有 sign 的接口，应答带有 sign 时仍然验签
+var unsignedResponseAPIs = map[string]bool{
+	"PayToPersonal":          true,
+	"GetPayToPersonalResult": true,
+}
+
+//gateway 返回接口 path 在 BaseURL 下的完整地址
+func (pcf *Pay) gateway(path string) string {
+	if pcf.BaseURL == "" {
+		return baseURL + path
+	}
+	return strings.TrimSuffix(pcf.BaseURL, "/") + path
+}
+
+//request 补充 nonce_str 并使用 sign_type 对应的 Signer 签名后发送请求，需要证书的接口 client 使用 tlsClient 的返回值，
+//校验 return_code 和返回的签名后将结果解析到 result，result_code 不为 SUCCESS 时返回 *Error，
+//同时返回原始参数以便读取 result 中没有的字段
+func (pcf *Pay) request(apiName, uri string, params map[string]string, client *http.Client, result interface{}) (map[string]string, error) {
+	if params["nonce_str"] == "" {
+		params["nonce_str"] = util.RandomStr(32)
+	}
+	signer, err := pcf.signer(params["sign_type"])
+	if err != nil {
+		return nil, err
+	}
+	params["sign"] = signer.Sign(params)
+
+	rawRet, err := util.PostXMLWithClient(client, uri, xmlParams(params))
+	if err != nil {
+		return nil, err
+	}
+	resParams, err := ParseXMLParams(rawRet)
+	if err != nil {
+		return nil, err
+	}
+	if resParams["return_code"] != "SUCCESS" {
+		return resParams, &Error{APIName: apiName, ReturnCode: resParams["return_code"], ReturnMsg: resParams["return_msg"]}
+	}
+	//返回的签名使用与请求相同的签名方式
+	if (resParams["sign"] != "" || !unsignedResponseAPIs[apiName]) && !verifySign(signer, resParams) {
+		return resParams, fmt.Errorf("%s Error , %w", apiName, ErrInvalidSign)
+	}
+	if result != nil {
+		if err = xml.Unmarshal(rawRet, result); err != nil {
+			return resParams, fmt.Errorf("%s Error , decode response error : %v", apiName, err)
+		}
+	}
+	if resParams["result_code"] != "SUCCESS" {
+		return resParams, &Error{
+			APIName:    apiName,
+			ReturnCode: resParams["return_code"],
+			ReturnMsg:  resParams["return_msg"],
+			ErrCode:    resParams["err_code"],
+			ErrCodeDes: resParams["err_code_des"],
+		}
+	}
+	return resParams, nil
+}
@@ -0,0 +1,136 @@
+package pay
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//Signer 微信支付 v2 的签名方式，请求签名和返回、通知的验签都通过 Signer 完成
+type Signer interface {
+	//SignType 返回对应的 sign_type
+	SignType() string
+	//Sign 对参数签名，忽略 sign 和空值，结果为大写
+	Sign(params map[string]string) string
+}
+
+//NewSigner 根据 sign_type 创建使用 apiKey 的 Signer，signType 为空时为 MD5
+func NewSigner(signType, apiKey string) (Signer, error) {
+	switch signType {
+	case "", SignTypeMD5:
+		return &md5Signer{apiKey: apiKey}, nil
+	case SignTypeHMACSHA256:
+		return &hmacSHA256Signer{apiKey: apiKey}, nil
+	}
+	return nil, fmt.Errorf("wechatpay : unsupported sign_type %q", signType)
+}
+
+//signer 返回使用商户 key 的 Signer
+func (pcf *Pay) signer(signType string) (Signer, error) {
+	return NewSigner(signType, pcf.PayKey)
+}
+
+type md5Signer struct {
+	apiKey string
+}
+
+func (s *md5Signer) SignType() string {
+	return SignTypeMD5
+}
+
+func (s *md5Signer) Sign(params map[string]string) string {
+	return signWithHash(md5.New(), params, s.apiKey)
+}
+
+type hmacSHA256Signer struct {
+	apiKey string
+}
+
+func (s *hmacSHA256Signer) SignType() string {
+	return SignTypeHMACSHA256
+}
+
+func (s *hmacSHA256Signer) Sign(params map[string]string) string {
+	return signWithHash(hmac.New(sha256.New, []byte(s.apiKey)), params, s.apiKey)
+}
+
+//signWithHash 去掉 sign 和空值后按 key 排序拼接，末尾加上 key=apiKey 后计算摘要，
+//拼接的字符串包含商户 key，不能输出到日志或错误中
+func signWithHash(h hash.Hash, params map[string]string, apiKey string) string {
+	keys := make([]string, 0, len(params))
+	for k, v := range params {
+		if k == "sign" || v == "" {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		h.Write([]byte(k))
+		h.Write([]byte{'='})
+		h.Write([]byte(params[k]))
+		h.Write([]byte{'&'})
+	}
+	h.Write([]byte("key="))
+	h.Write([]byte(apiKey))
+	return strings.ToUpper(hex.EncodeToString(h.Sum(nil)))
+}
+
+//verifySign 验证 params 中的 sign，sign 为空时返回 false
+func verifySign(signer Signer, params map[string]string) bool {
+	return hmacEqual(signer.Sign(params), params["sign"])
+}
+
+//hmacEqual 以固定时间比较签名，sign 为空时返回 false
+func hmacEqual(expected, sign string) bool {
+	return sign != "" && hmac.Equal([]byte(expected), []byte(sign))
+}
+
+//ToSignParams 将任意类型的参数值转换为字符串，nil 转换为空字符串，不会 panic
+func ToSignParams(params map[string]interface{}) map[string]string {
+	result := make(map[string]string, len(params))
+	for k, v := range params {
+		result[k] = formatSignValue(v)
+	}
+	return result
+}
+
+func formatSignValue(v interface{}) string {
+	switch vv := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return vv
+	case CDATA:
+		return string(vv)
+	case []byte:
+		return string(vv)
+	case int:
+		return strconv.FormatInt(int64(vv), 10)
+	case int64:
+		return strconv.FormatInt(vv, 10)
+	case int32:
+		return strconv.FormatInt(int64(vv), 10)
+	case uint:
+		return strconv.FormatUint(uint64(vv), 10)
+	case uint64:
+		return strconv.FormatUint(vv, 10)
+	case uint32:
+		return strconv.FormatUint(uint64(vv), 10)
+	case float64:
+		return strconv.FormatFloat(vv, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(vv), 'f', -1, 32)
+	case bool:
+		return strconv.FormatBool(vv)
+	case fmt.Stringer:
+		return vv.String()
+	}
+	return fmt.Sprint(v)
+}
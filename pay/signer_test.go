@@ -0,0 +1,107 @@
+package pay
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestSigner(t *testing.T) {
+	//微信支付文档中的签名示例
+	params := map[string]string{
+		"appid":       "wxd930ea5d5a258f4f",
+		"mch_id":      "10000100",
+		"device_info": "1000",
+		"body":        "test",
+		"nonce_str":   "ibuaiVcKdpRxkhJA",
+		"sign":        "ignored",
+		"attach":      "",
+	}
+	expected := map[string]string{
+		SignTypeMD5:        "9A0A8659F005D6984697E2CA0A9CF3B7",
+		SignTypeHMACSHA256: "6A9AE1657590FD6257D693A078E1C3E4BB6BA4DC30B23E0EE2496E54170DACD6",
+	}
+	for signType, sign := range expected {
+		signer, err := NewSigner(signType, testPayKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if signer.SignType() != signType || signer.Sign(params) != sign {
+			t.Errorf("%s : expected %s, got %s", signType, sign, signer.Sign(params))
+		}
+	}
+	if _, err := NewSigner("SHA1", testPayKey); err == nil {
+		t.Error("expected error for unsupported sign type")
+	}
+}
+
+func TestToSignParams(t *testing.T) {
+	params := ToSignParams(map[string]interface{}{
+		"total_fee": int64(101),
+		"count":     uint32(2),
+		"rate":      0.6,
+		"flag":      true,
+		"empty":     nil,
+		"body":      CDATA("test"),
+		"other":     struct{ A int }{1},
+	})
+	expected := map[string]string{"total_fee": "101", "count": "2", "rate": "0.6", "flag": "true", "empty": "", "body": "test", "other": "{1}"}
+	for k, v := range expected {
+		if params[k] != v {
+			t.Errorf("%s : expected %q, got %q", k, v, params[k])
+		}
+	}
+}
+
+func TestPrePayOrderHMACSHA256(t *testing.T) {
+	pay, done := newTestPayServer(t, map[string]testPayHandler{
+		unifiedOrderPath: testPayResponse(map[string]string{
+			"return_code": "SUCCESS",
+			"result_code": "SUCCESS",
+			"prepay_id":   "wx201410272009395522657a690389285100",
+		}),
+	})
+	defer done()
+
+	cfg, err := pay.BridgeConfig(&Params{OutTradeNo: "1409811653", TotalFee: "1", TradeType: TradeTypeJSAPI, SignType: SignTypeHMACSHA256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.PrePayID != "wx201410272009395522657a690389285100" || len(cfg.PaySign) != 64 {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+}
+
+func TestPayRequestsVerifySign(t *testing.T) {
+	pay, done := newTestPayServer(t, map[string]testPayHandler{
+		unifiedOrderPath: testPayResponse(map[string]string{"result_code": "FAIL", "err_code": ErrCodeOrderPaid, "err_code_des": "商户订单已支付"}),
+		//企业付款的应答不带签名
+		payToPersonalPath: func(w http.ResponseWriter, params map[string]string) map[string]string {
+			w.Write([]byte("<xml><return_code>SUCCESS</return_code><result_code>FAIL</result_code><err_code>NOTENOUGH</err_code></xml>"))
+			return nil
+		},
+		profitSharingAddReceiverPath: testPayResponse(map[string]string{"result_code": "SUCCESS", "receiver": "{}"}),
+		profitSharingPath: func(w http.ResponseWriter, params map[string]string) map[string]string {
+			data := newTestNotify(map[string]string{"return_code": "SUCCESS", "result_code": "SUCCESS"}, SignTypeMD5)
+			w.Write([]byte(data))
+			return nil
+		},
+	})
+	defer done()
+
+	order, err := pay.PrePayOrder(&Params{OutTradeNo: "1409811653", TotalFee: "1", TradeType: TradeTypeJSAPI})
+	if !IsErrCode(err, ErrCodeOrderPaid) || order.ErrCode != ErrCodeOrderPaid || order.ErrCodeDes != "商户订单已支付" {
+		t.Errorf("PrePayOrder = %+v %v", order, err)
+	}
+	res, err := pay.PayToPersonal(&PayToPersonalParams{PartnerTradeNo: "10000098201411111234567890", Amount: "100"})
+	if !IsErrCode(err, "NOTENOUGH") || res.ErrCode != "NOTENOUGH" {
+		t.Errorf("PayToPersonal = %+v %v", res, err)
+	}
+	if receiver, err := pay.AddProfitSharingReveiver(&ProfitSharingReceiver{Type: PersonalOpenId}); err != nil || receiver == nil || receiver.Receiver != "{}" {
+		t.Errorf("AddProfitSharingReveiver = %+v %v", receiver, err)
+	}
+	//分账使用 HMAC-SHA256 签名，MD5 签名的应答不能通过验签
+	if _, err = pay.ProfitSharing("P20150806125346", "4208450740201411110007820472", nil); !errors.Is(err, ErrInvalidSign) {
+		t.Errorf("ProfitSharing should reject the response sign, got %v", err)
+	}
+}
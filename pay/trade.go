@@ -0,0 +1,283 @@
+package pay
+
+import (
+	icontext "context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fintcloud/wechat/util"
+)
+
+const micropayPath = "/pay/micropay"
+
+//交易类型 trade_type
+const (
+	TradeTypeJSAPI    = "JSAPI"
+	TradeTypeNative   = "NATIVE"
+	TradeTypeApp      = "APP"
+	TradeTypeMWeb     = "MWEB"
+	TradeTypeMicropay = "MICROPAY"
+)
+
+const (
+	//maxReverseRecall 撤销订单返回 recall=Y 时的最大重试次数
+	maxReverseRecall = 5
+	//defaultMicropayWait ctx 没有设置截止时间时，付款码支付最多等待的时间
+	defaultMicropayWait = 30 * time.Second
+)
+
+//ErrOrderReversed 付款码支付没有成功，订单已撤销
+var ErrOrderReversed = errors.New("wechatpay : order reversed")
+
+//unifiedOrder 统一下单，签名方式取自 p.SignType，result_code 不为 SUCCESS 时同时返回解析后的应答
+func (pcf *Pay) unifiedOrder(p *Params) (*PreOrder, error) {
+	notifyURL := pcf.PayNotifyURL
+	if p.NotifyURL != "" {
+		notifyURL = p.NotifyURL
+	}
+	params := map[string]string{
+		"appid":            pcf.AppID,
+		"mch_id":           pcf.PayMchID,
+		"device_info":      p.DeviceInfo,
+		"sign_type":        p.SignType,
+		"body":             p.Body,
+		"detail":           p.Detail,
+		"attach":           p.Attach,
+		"out_trade_no":     p.OutTradeNo,
+		"total_fee":        p.TotalFee,
+		"spbill_create_ip": p.CreateIP,
+		"goods_tag":        p.GoodsTag,
+		"notify_url":       notifyURL,
+		"trade_type":       p.TradeType,
+		"product_id":       p.ProductID,
+		"openid":           p.OpenID,
+		"scene_info":       p.SceneInfo,
+	}
+	order := new(PreOrder)
+	resParams, err := pcf.request("UnifiedOrder", pcf.gateway(unifiedOrderPath), params, nil, order)
+	if err != nil {
+		var payErr *Error
+		if errors.As(err, &payErr) && resParams["return_code"] == "SUCCESS" {
+			return order, err
+		}
+		return nil, err
+	}
+	return order, nil
+}
+
+//NativeCodeURL Native 支付（模式二）下单，返回用于生成二维码的 code_url，有效期为2小时
+func (pcf *Pay) NativeCodeURL(p *Params) (string, error) {
+	if p.ProductID == "" {
+		return "", errors.New("wechatpay : product_id is required for NATIVE")
+	}
+	order := *p
+	order.TradeType = TradeTypeNative
+	res, err := pcf.unifiedOrder(&order)
+	if err != nil {
+		return "", err
+	}
+	return res.CodeURL, nil
+}
+
+//H5SceneInfo H5 支付的场景信息，Type 为 Wap 时需要 WapURL 和 WapName，
+//为 IOS 时需要 AppName 和 BundleID，为 Android 时需要 AppName 和 PackageName
+type H5SceneInfo struct {
+	Type        string `json:"type"`
+	WapURL      string `json:"wap_url,omitempty"`
+	WapName     string `json:"wap_name,omitempty"`
+	AppName     string `json:"app_name,omitempty"`
+	BundleID    string `json:"bundle_id,omitempty"`
+	PackageName string `json:"package_name,omitempty"`
+}
+
+//MWebURL H5 支付下单，返回在手机浏览器中打开的 mweb_url，有效期为5分钟，
+//redirectURL 不为空时作为支付完成后的跳转地址拼接到 mweb_url 上
+func (pcf *Pay) MWebURL(p *Params, scene *H5SceneInfo, redirectURL string) (string, error) {
+	sceneInfo, err := json.Marshal(struct {
+		H5Info *H5SceneInfo `json:"h5_info"`
+	}{scene})
+	if err != nil {
+		return "", err
+	}
+	order := *p
+	order.TradeType = TradeTypeMWeb
+	order.SceneInfo = string(sceneInfo)
+	res, err := pcf.unifiedOrder(&order)
+	if err != nil {
+		return "", err
+	}
+	if redirectURL == "" {
+		return res.MWebURL, nil
+	}
+	return res.MWebURL + "&redirect_url=" + url.QueryEscape(redirectURL), nil
+}
+
+//AppConfig 是传给 APP 调起支付的参数
+type AppConfig struct {
+	AppID     string `json:"appid"`
+	PartnerID string `json:"partnerid"`
+	PrepayID  string `json:"prepayid"`
+	Package   string `json:"package"`
+	NonceStr  string `json:"noncestr"`
+	Timestamp string `json:"timestamp"`
+	Sign      string `json:"sign"`
+}
+
+//AppConfig APP 支付下单，返回 APP 调起支付需要的参数，签名方式与下单相同，AppID 需要是开放平台的应用 appid
+func (pcf *Pay) AppConfig(p *Params) (*AppConfig, error) {
+	order := *p
+	order.TradeType = TradeTypeApp
+	res, err := pcf.unifiedOrder(&order)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &AppConfig{
+		AppID:     pcf.AppID,
+		PartnerID: pcf.PayMchID,
+		PrepayID:  res.PrePayID,
+		Package:   "Sign=WXPay",
+		NonceStr:  util.RandomStr(32),
+		Timestamp: strconv.FormatInt(time.Now().Unix(), 10),
+	}
+	signer, err := pcf.signer(p.SignType)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Sign = signer.Sign(cfg.params())
+	return cfg, nil
+}
+
+//params 返回参与签名的参数
+func (cfg *AppConfig) params() map[string]string {
+	return map[string]string{
+		"appid":     cfg.AppID,
+		"partnerid": cfg.PartnerID,
+		"prepayid":  cfg.PrepayID,
+		"package":   cfg.Package,
+		"noncestr":  cfg.NonceStr,
+		"timestamp": cfg.Timestamp,
+	}
+}
+
+//MicropayParams 付款码支付参数
+type MicropayParams struct {
+	AuthCode   string //扫码枪读取的付款码
+	Body       string
+	Detail     string
+	Attach     string
+	OutTradeNo string
+	TotalFee   string
+	CreateIP   string
+	GoodsTag   string
+	DeviceInfo string
+	SceneInfo  string
+	SignType   string
+	RootCa     string //ca证书路径，撤销订单时使用，为空时使用 Pay 上设置的证书
+}
+
+//MicropayResponse 付款码支付返回，字段与支付结果通知相同
+type MicropayResponse struct {
+	NotifyResult
+}
+
+//Micropay 付款码支付，只调用一次接口，用户需要输入密码时返回 err_code 为 USERPAYING 的 *Error，
+//需要等待支付结果时使用 MicropayAndWait
+func (pcf *Pay) Micropay(p *MicropayParams) (*MicropayResponse, error) {
+	params := map[string]string{
+		"appid":            pcf.AppID,
+		"mch_id":           pcf.PayMchID,
+		"device_info":      p.DeviceInfo,
+		"sign_type":        p.SignType,
+		"body":             p.Body,
+		"detail":           p.Detail,
+		"attach":           p.Attach,
+		"out_trade_no":     p.OutTradeNo,
+		"total_fee":        p.TotalFee,
+		"spbill_create_ip": p.CreateIP,
+		"goods_tag":        p.GoodsTag,
+		"auth_code":        p.AuthCode,
+		"scene_info":       p.SceneInfo,
+	}
+	res := new(MicropayResponse)
+	resParams, err := pcf.request("Micropay", pcf.gateway(micropayPath), params, nil, res)
+	if err != nil {
+		return nil, err
+	}
+	res.Coupons = parseCoupons(resParams)
+	return res, nil
+}
+
+//MicropayAndWait 付款码支付并等待支付结果：
+//返回 USERPAYING 或者支付结果未知时每隔 interval 查询一次订单，interval 小于等于0时为5秒，
+//支付失败、订单不存在或 ctx 结束时撤销订单并返回包装了 ErrOrderReversed 的错误，明确失败的错误直接返回；
+//ctx 没有设置截止时间时最多等待30秒
+func (pcf *Pay) MicropayAndWait(ctx icontext.Context, p *MicropayParams, interval time.Duration) (*MicropayResponse, error) {
+	res, err := pcf.Micropay(p)
+	if err == nil {
+		return res, nil
+	}
+	var payErr *Error
+	if errors.As(err, &payErr) && !IsErrCode(err, ErrCodeUserPaying, ErrCodeSystemError, ErrCodeBankError) {
+		return nil, err
+	}
+
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel icontext.CancelFunc
+		ctx, cancel = icontext.WithTimeout(ctx, defaultMicropayWait)
+		defer cancel()
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	query := &OrderQueryRequest{OutTradeNo: p.OutTradeNo, SignType: p.SignType}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, pcf.reverseMicropay(p, ctx.Err())
+		case <-ticker.C:
+		}
+		order, queryErr := pcf.OrderQuery(query)
+		switch {
+		case IsErrCode(queryErr, ErrCodeOrderNotExist):
+			//支付结果未知时订单不存在，同样需要撤销，避免用户稍后支付成功
+			return nil, pcf.reverseMicropay(p, err)
+		case queryErr != nil:
+			continue
+		}
+		switch order.TradeState {
+		case TradeStateSuccess:
+			return &MicropayResponse{NotifyResult: order.NotifyResult}, nil
+		case TradeStateUserPaying:
+			continue
+		case TradeStateClosed, TradeStateRevoked:
+			return nil, fmt.Errorf("wechatpay : micropay trade_state=%s", order.TradeState)
+		default:
+			return nil, pcf.reverseMicropay(p, fmt.Errorf("trade_state=%s , trade_state_desc=%s", order.TradeState, order.TradeStateDesc))
+		}
+	}
+}
+
+//reverseMicropay 撤销订单，recall 为 Y 时重试，cause 为撤销的原因
+func (pcf *Pay) reverseMicropay(p *MicropayParams, cause error) error {
+	req := &ReverseRequest{OutTradeNo: p.OutTradeNo, SignType: p.SignType, RootCa: p.RootCa}
+	var errs []string
+	for i := 0; i < maxReverseRecall; i++ {
+		res, err := pcf.Reverse(req)
+		if err == nil {
+			return fmt.Errorf("%w : %v", ErrOrderReversed, cause)
+		}
+		errs = append(errs, err.Error())
+		if res == nil || res.Recall != "Y" {
+			break
+		}
+		time.Sleep(time.Second)
+	}
+	return fmt.Errorf("wechatpay : reverse order %s error : %s , cause : %v", p.OutTradeNo, strings.Join(errs, " ; "), cause)
+}
@@ -0,0 +1,89 @@
+package pay
+
+import (
+	icontext "context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAppConfig(t *testing.T) {
+	pay, done := newTestPayServer(t, map[string]testPayHandler{
+		unifiedOrderPath: testPayResponse(map[string]string{"result_code": "SUCCESS", "trade_type": TradeTypeApp, "prepay_id": "wx201410272009395522657a690389285100"}),
+	})
+	defer done()
+
+	cfg, err := pay.AppConfig(&Params{OutTradeNo: "1409811653", TotalFee: "1", SignType: SignTypeHMACSHA256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.PrepayID != "wx201410272009395522657a690389285100" || cfg.Package != "Sign=WXPay" || cfg.PartnerID != "1900000001" {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+	if cfg.Sign != testSign(cfg.params(), SignTypeHMACSHA256) {
+		t.Errorf("config is not signed with HMAC-SHA256")
+	}
+}
+
+func TestMicropayAndWait(t *testing.T) {
+	states := []string{TradeStateUserPaying, TradeStateSuccess}
+	pay, done := newTestPayServer(t, map[string]testPayHandler{
+		micropayPath: testPayResponse(map[string]string{"result_code": "FAIL", "err_code": ErrCodeUserPaying}),
+		orderQueryPath: func(w http.ResponseWriter, params map[string]string) map[string]string {
+			state := states[0]
+			states = states[1:]
+			return map[string]string{"result_code": "SUCCESS", "trade_state": state, "transaction_id": "1004400740201409030005092168"}
+		},
+	})
+	defer done()
+
+	res, err := pay.MicropayAndWait(icontext.Background(), &MicropayParams{AuthCode: "120061098828009406", OutTradeNo: "1409811653"}, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.TransactionID != "1004400740201409030005092168" {
+		t.Errorf("unexpected result %+v", res)
+	}
+}
+
+func TestMicropayAndWaitReverse(t *testing.T) {
+	reversed := 0
+	pay, done := newTestPayServer(t, map[string]testPayHandler{
+		micropayPath:   testPayResponse(map[string]string{"result_code": "FAIL", "err_code": ErrCodeUserPaying}),
+		orderQueryPath: testPayResponse(map[string]string{"result_code": "SUCCESS", "trade_state": TradeStateUserPaying}),
+		reversePath: func(w http.ResponseWriter, params map[string]string) map[string]string {
+			reversed++
+			if reversed == 1 {
+				return map[string]string{"result_code": "FAIL", "err_code": ErrCodeSystemError, "recall": "Y"}
+			}
+			return map[string]string{"result_code": "SUCCESS", "recall": "N"}
+		},
+	})
+	defer done()
+
+	ctx, cancel := icontext.WithTimeout(icontext.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := pay.MicropayAndWait(ctx, &MicropayParams{AuthCode: "120061098828009406", OutTradeNo: "1409811653"}, time.Millisecond)
+	if !errors.Is(err, ErrOrderReversed) || reversed != 2 {
+		t.Errorf("expected order to be reversed after recall, got %v (reversed %d times)", err, reversed)
+	}
+}
+
+func TestMicropayAndWaitOrderNotExist(t *testing.T) {
+	reversed := false
+	pay, done := newTestPayServer(t, map[string]testPayHandler{
+		micropayPath:   testPayResponse(map[string]string{"result_code": "FAIL", "err_code": ErrCodeSystemError}),
+		orderQueryPath: testPayResponse(map[string]string{"result_code": "FAIL", "err_code": ErrCodeOrderNotExist}),
+		reversePath: func(w http.ResponseWriter, params map[string]string) map[string]string {
+			reversed = params["out_trade_no"] == "1409811653"
+			return map[string]string{"result_code": "SUCCESS", "recall": "N"}
+		},
+	})
+	defer done()
+
+	_, err := pay.MicropayAndWait(icontext.Background(), &MicropayParams{AuthCode: "120061098828009406", OutTradeNo: "1409811653"}, time.Millisecond)
+	if !errors.Is(err, ErrOrderReversed) || !reversed {
+		t.Errorf("expected order to be reversed when it does not exist, got %v", err)
+	}
+}
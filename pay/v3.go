@@ -0,0 +1,484 @@
+package pay
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fintcloud/wechat/cache"
+	"github.com/fintcloud/wechat/context"
+	"github.com/fintcloud/wechat/util"
+)
+
+const (
+	v3BaseURL          = "https://api.mch.weixin.qq.com"
+	v3CertificatesPath = "/v3/certificates"
+	v3AuthSchema       = "WECHATPAY2-SHA256-RSA2048"
+	v3UserAgent        = "fintcloud-wechat"
+
+	//v3CertCacheKey 平台证书在 Cache 中的 key，同一个商户号共用
+	v3CertCacheKey = "wechatpay_v3_certificates_%s"
+	//v3CertRefreshInterval 平台证书的刷新间隔，微信支付会在旧证书过期前提前发布新证书
+	v3CertRefreshInterval = 12 * time.Hour
+	//v3CertForceRefreshInterval 下载证书的最小间隔，避免伪造的通知或全部过期的证书频繁触发下载
+	v3CertForceRefreshInterval = time.Minute
+	//v3MaxTimestampSkew 应答和通知中的时间戳与本地时间允许的最大偏差
+	v3MaxTimestampSkew = 5 * time.Minute
+)
+
+//v3 应答和通知中的签名相关 header
+const (
+	HeaderWechatpaySerial    = "Wechatpay-Serial"
+	HeaderWechatpaySignature = "Wechatpay-Signature"
+	HeaderWechatpayTimestamp = "Wechatpay-Timestamp"
+	HeaderWechatpayNonce     = "Wechatpay-Nonce"
+)
+
+//V3Error v3 接口返回的错误
+type V3Error struct {
+	StatusCode int             `json:"-"`
+	Code       string          `json:"code"`
+	Message    string          `json:"message"`
+	Detail     json.RawMessage `json:"detail,omitempty"`
+}
+
+func (e *V3Error) Error() string {
+	return fmt.Sprintf("wechatpay v3 error , status=%d , code=%s , message=%s", e.StatusCode, e.Code, e.Message)
+}
+
+//V3Client 微信支付 API v3 客户端，负责请求签名、应答验签以及平台证书的下载和更新
+type V3Client struct {
+	mchID      string
+	serialNo   string
+	privateKey *rsa.PrivateKey
+	apiV3Key   []byte
+	cache      cache.Cache
+
+	//HTTPClient 发送请求使用的 http.Client，可替换以设置代理等
+	HTTPClient *http.Client
+
+	mu              sync.RWMutex
+	certs           map[string]*x509.Certificate
+	certsLoadedAt   time.Time
+	certsDownloadAt time.Time
+	loading         chan struct{} //正在下载证书时不为空，下载完成后关闭
+}
+
+//NewV3Client 使用 Context 中的商户号、商户证书序列号、私钥和 APIv3 密钥创建客户端
+func NewV3Client(ctx *context.Context) (*V3Client, error) {
+	if ctx.PayMchID == "" || ctx.PayCertSerialNo == "" {
+		return nil, errors.New("wechatpay v3 : PayMchID and PayCertSerialNo are required")
+	}
+	if len(ctx.PayAPIv3Key) != 32 {
+		return nil, fmt.Errorf("wechatpay v3 : PayAPIv3Key must be 32 bytes, got %d", len(ctx.PayAPIv3Key))
+	}
+	privateKey, err := ParsePrivateKey([]byte(ctx.PayPrivateKey))
+	if err != nil {
+		return nil, err
+	}
+	return &V3Client{
+		mchID:      ctx.PayMchID,
+		serialNo:   ctx.PayCertSerialNo,
+		privateKey: privateKey,
+		apiV3Key:   []byte(ctx.PayAPIv3Key),
+		cache:      ctx.Cache,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+		certs:      make(map[string]*x509.Certificate),
+	}, nil
+}
+
+//v3ClientLock 保护 Context 中 V3Client 的初始化
+var v3ClientLock sync.Mutex
+
+//GetV3Client 返回 v3 客户端，配置不完整时返回错误，第一次调用时创建并保存在 Context 中，同一个 Context 创建的 Pay 共用
+func (pcf *Pay) GetV3Client() (*V3Client, error) {
+	v3ClientLock.Lock()
+	defer v3ClientLock.Unlock()
+	if client, ok := pcf.GetPayV3Client().(*V3Client); ok {
+		return client, nil
+	}
+	client, err := NewV3Client(pcf.Context)
+	if err != nil {
+		return nil, err
+	}
+	pcf.SetPayV3Client(client)
+	return client, nil
+}
+
+//ParsePrivateKey 解析 PEM 格式的商户私钥，支持 PKCS#8 和 PKCS#1
+func ParsePrivateKey(pemData []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, errors.New("wechatpay v3 : invalid private key, PEM block not found")
+	}
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("wechatpay v3 : parse private key error : %v", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("wechatpay v3 : private key is not a RSA key")
+	}
+	return rsaKey, nil
+}
+
+//Authorization 生成请求的 Authorization header，urlPath 包含查询参数，body 为请求体，GET 请求为空
+func (c *V3Client) Authorization(method, urlPath string, body []byte) (string, error) {
+	nonce := util.RandomStr(32)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	message := method + "\n" + urlPath + "\n" + timestamp + "\n" + nonce + "\n" + string(body) + "\n"
+	signature, err := c.Sign([]byte(message))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`%s mchid="%s",nonce_str="%s",signature="%s",timestamp="%s",serial_no="%s"`,
+		v3AuthSchema, c.mchID, nonce, signature, timestamp, c.serialNo), nil
+}
+
+//Sign 使用商户私钥对 message 进行 SHA256-RSA 签名，返回 base64 编码的结果，也用于调起支付的 paySign
+func (c *V3Client) Sign(message []byte) (string, error) {
+	hashed := sha256.Sum256(message)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, c.privateKey, crypto.SHA256, hashed[:])
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+//Do 发送 v3 请求，path 以 /v3/ 开头，body 不为 nil 时以 json 发送，
+//应答验签通过后将结果解析到 result，result 为 nil 时忽略应答内容，非 2xx 的应答返回 *V3Error
+func (c *V3Client) Do(method, path string, body, result interface{}) error {
+	var reqBody []byte
+	if body != nil {
+		var err error
+		if reqBody, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	header, respBody, err := c.send(method, path, reqBody)
+	if err != nil {
+		return err
+	}
+	if err = c.VerifyHeader(header, respBody); err != nil {
+		return err
+	}
+	if result == nil || len(respBody) == 0 {
+		return nil
+	}
+	return json.Unmarshal(respBody, result)
+}
+
+//send 发送签名后的请求，非 2xx 的应答返回 *V3Error，不验证应答签名
+func (c *V3Client) send(method, path string, reqBody []byte) (http.Header, []byte, error) {
+	authorization, err := c.Authorization(method, path, reqBody)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := http.NewRequest(method, v3BaseURL+path, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", v3UserAgent)
+	if reqBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		v3Err := &V3Error{StatusCode: resp.StatusCode}
+		if e := json.Unmarshal(respBody, v3Err); e != nil {
+			v3Err.Message = string(respBody)
+		}
+		return nil, nil, v3Err
+	}
+	return resp.Header, respBody, nil
+}
+
+//VerifyHeader 使用 Wechatpay-* header 验证应答或回调通知的签名，并检查时间戳是否在5分钟以内
+func (c *V3Client) VerifyHeader(header http.Header, body []byte) error {
+	timestamp := header.Get(HeaderWechatpayTimestamp)
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("wechatpay v3 : invalid %s %q", HeaderWechatpayTimestamp, timestamp)
+	}
+	skew := time.Since(time.Unix(ts, 0))
+	if skew > v3MaxTimestampSkew || skew < -v3MaxTimestampSkew {
+		return fmt.Errorf("wechatpay v3 : timestamp %s expired", timestamp)
+	}
+	return c.VerifySignature(header.Get(HeaderWechatpaySerial), timestamp, header.Get(HeaderWechatpayNonce), header.Get(HeaderWechatpaySignature), body)
+}
+
+//VerifySignature 使用序列号为 serialNo 的平台证书验证签名，本地没有该证书时会重新下载一次平台证书
+func (c *V3Client) VerifySignature(serialNo, timestamp, nonce, signature string, body []byte) error {
+	cert, err := c.Certificate(serialNo)
+	if err != nil {
+		return err
+	}
+	return verifyWithCert(cert, timestamp, nonce, signature, body)
+}
+
+func verifyWithCert(cert *x509.Certificate, timestamp, nonce, signature string, body []byte) error {
+	publicKey, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return errors.New("wechatpay v3 : platform certificate is not a RSA certificate")
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("wechatpay v3 : invalid signature encoding : %v", err)
+	}
+	message := timestamp + "\n" + nonce + "\n" + string(body) + "\n"
+	hashed := sha256.Sum256([]byte(message))
+	if err = rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hashed[:], sig); err != nil {
+		return fmt.Errorf("wechatpay v3 : signature verification failed : %v", err)
+	}
+	return nil
+}
+
+//Certificate 返回序列号为 serialNo 的平台证书
+func (c *V3Client) Certificate(serialNo string) (*x509.Certificate, error) {
+	if err := c.loadCertificates(false); err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	cert, ok := c.certs[serialNo]
+	c.mu.RUnlock()
+	if ok {
+		return cert, nil
+	}
+
+	//证书轮换后出现新的序列号，强制重新下载
+	if err := c.loadCertificates(true); err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	cert, ok = c.certs[serialNo]
+	c.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("wechatpay v3 : platform certificate %s not found", serialNo)
+	}
+	return cert, nil
+}
+
+//Certificates 返回当前有效的平台证书，key 为证书序列号，可用于加密敏感信息时选择证书
+func (c *V3Client) Certificates() (map[string]*x509.Certificate, error) {
+	if err := c.loadCertificates(false); err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	certs := make(map[string]*x509.Certificate, len(c.certs))
+	for serialNo, cert := range c.certs {
+		certs[serialNo] = cert
+	}
+	return certs, nil
+}
+
+//cachedCertificate 保存在 Cache 中的平台证书
+type cachedCertificate struct {
+	SerialNo string `json:"serial_no"`
+	PEM      string `json:"pem"`
+}
+
+//loadCertificates 依次从内存、Cache 和平台证书接口加载证书，force 为 true 时直接从接口下载
+//
+//下载时不持有 c.mu，同一时间只有一个请求下载，其余请求在已有证书时直接返回，没有证书时等待下载完成
+func (c *V3Client) loadCertificates(force bool) error {
+	c.mu.Lock()
+	if !force && len(c.certs) > 0 && time.Since(c.certsLoadedAt) < v3CertRefreshInterval {
+		c.mu.Unlock()
+		return nil
+	}
+	if loading := c.loading; loading != nil {
+		hasCerts := len(c.certs) > 0
+		c.mu.Unlock()
+		if !hasCerts {
+			<-loading
+		}
+		return nil
+	}
+	loading := make(chan struct{})
+	c.loading = loading
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.loading = nil
+		c.mu.Unlock()
+		close(loading)
+	}()
+
+	cacheKey := fmt.Sprintf(v3CertCacheKey, c.mchID)
+	if !force && c.cache != nil {
+		if val, ok := c.cache.Get(cacheKey).(string); ok {
+			var cached []cachedCertificate
+			if err := json.Unmarshal([]byte(val), &cached); err == nil {
+				if certs, err := parseCachedCertificates(cached); err == nil && len(certs) > 0 {
+					c.setCertificates(certs)
+					return nil
+				}
+			}
+		}
+	}
+
+	//证书全部过期或下载失败时同样限制下载频率，避免每次调用都请求接口
+	c.mu.Lock()
+	if time.Since(c.certsDownloadAt) < v3CertForceRefreshInterval {
+		c.mu.Unlock()
+		return nil
+	}
+	c.certsDownloadAt = time.Now()
+	c.mu.Unlock()
+
+	cached, err := c.downloadCertificates()
+	if err != nil {
+		return err
+	}
+	certs, err := parseCachedCertificates(cached)
+	if err != nil {
+		return err
+	}
+	c.setCertificates(certs)
+	if c.cache != nil {
+		if data, err := json.Marshal(cached); err == nil {
+			return c.cache.Set(cacheKey, string(data), v3CertRefreshInterval)
+		}
+	}
+	return nil
+}
+
+func (c *V3Client) setCertificates(certs map[string]*x509.Certificate) {
+	c.mu.Lock()
+	c.certs = certs
+	c.certsLoadedAt = time.Now()
+	c.mu.Unlock()
+}
+
+func parseCachedCertificates(cached []cachedCertificate) (map[string]*x509.Certificate, error) {
+	now := time.Now()
+	certs := make(map[string]*x509.Certificate, len(cached))
+	for _, item := range cached {
+		cert, err := ParseCertificate([]byte(item.PEM))
+		if err != nil {
+			return nil, err
+		}
+		if now.After(cert.NotAfter) {
+			continue
+		}
+		certs[item.SerialNo] = cert
+	}
+	return certs, nil
+}
+
+//ParseCertificate 解析 PEM 格式的证书
+func ParseCertificate(pemData []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, errors.New("wechatpay v3 : invalid certificate, PEM block not found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+//EncryptedResource 使用 AEAD_AES_256_GCM 加密的数据，用于平台证书和回调通知
+type EncryptedResource struct {
+	Algorithm      string `json:"algorithm"`
+	OriginalType   string `json:"original_type,omitempty"`
+	CipherText     string `json:"ciphertext"`
+	AssociatedData string `json:"associated_data"`
+	Nonce          string `json:"nonce"`
+}
+
+type resCertificates struct {
+	Data []struct {
+		SerialNo           string            `json:"serial_no"`
+		EffectiveTime      string            `json:"effective_time"`
+		ExpireTime         string            `json:"expire_time"`
+		EncryptCertificate EncryptedResource `json:"encrypt_certificate"`
+	} `json:"data"`
+}
+
+//downloadCertificates 下载并解密平台证书，下载的应答使用解密得到的证书验签
+func (c *V3Client) downloadCertificates() ([]cachedCertificate, error) {
+	header, respBody, err := c.send(http.MethodGet, v3CertificatesPath, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var res resCertificates
+	if err = json.Unmarshal(respBody, &res); err != nil {
+		return nil, err
+	}
+	cached := make([]cachedCertificate, 0, len(res.Data))
+	downloaded := make(map[string]*x509.Certificate, len(res.Data))
+	for _, item := range res.Data {
+		enc := item.EncryptCertificate
+		plain, err := c.Decrypt(enc.AssociatedData, enc.Nonce, enc.CipherText)
+		if err != nil {
+			return nil, fmt.Errorf("wechatpay v3 : decrypt platform certificate %s error : %v", item.SerialNo, err)
+		}
+		cert, err := ParseCertificate(plain)
+		if err != nil {
+			return nil, err
+		}
+		downloaded[item.SerialNo] = cert
+		cached = append(cached, cachedCertificate{SerialNo: item.SerialNo, PEM: string(plain)})
+	}
+
+	cert, ok := downloaded[header.Get(HeaderWechatpaySerial)]
+	if !ok {
+		return nil, fmt.Errorf("wechatpay v3 : platform certificate %s not found in certificate list", header.Get(HeaderWechatpaySerial))
+	}
+	err = verifyWithCert(cert, header.Get(HeaderWechatpayTimestamp), header.Get(HeaderWechatpayNonce), header.Get(HeaderWechatpaySignature), respBody)
+	if err != nil {
+		return nil, err
+	}
+	return cached, nil
+}
+
+//Decrypt 使用 APIv3 密钥解密 AEAD_AES_256_GCM 加密的数据
+func (c *V3Client) Decrypt(associatedData, nonce, ciphertext string) ([]byte, error) {
+	return DecryptAES256GCM(c.apiV3Key, associatedData, nonce, ciphertext)
+}
+
+//DecryptAES256GCM 解密 AEAD_AES_256_GCM 加密的数据，ciphertext 为 base64 编码
+func DecryptAES256GCM(key []byte, associatedData, nonce, ciphertext string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(nonce))
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Open(nil, []byte(nonce), data, []byte(associatedData))
+}
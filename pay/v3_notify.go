@@ -0,0 +1,164 @@
+package pay
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+//maxV3NotifyBodySize 回调通知请求体的最大长度
+const maxV3NotifyBodySize = 1 << 20
+
+//ErrV3NotifyUnhandled 通知的 event_type 没有设置对应的回调
+var ErrV3NotifyUnhandled = errors.New("wechatpay v3 : notify event type is not handled")
+
+//V3TransactionResult 支付成功通知（TRANSACTION.SUCCESS）解密后的内容
+type V3TransactionResult struct {
+	AppID          string `json:"appid"`
+	MchID          string `json:"mchid"`
+	OutTradeNo     string `json:"out_trade_no"`
+	TransactionID  string `json:"transaction_id"`
+	TradeType      string `json:"trade_type"`
+	TradeState     string `json:"trade_state"`
+	TradeStateDesc string `json:"trade_state_desc"`
+	BankType       string `json:"bank_type"`
+	Attach         string `json:"attach"`
+	SuccessTime    string `json:"success_time"`
+	Payer          struct {
+		OpenID string `json:"openid"`
+	} `json:"payer"`
+	Amount struct {
+		Total         int    `json:"total"`
+		PayerTotal    int    `json:"payer_total"`
+		Currency      string `json:"currency"`
+		PayerCurrency string `json:"payer_currency"`
+	} `json:"amount"`
+	SceneInfo struct {
+		DeviceID string `json:"device_id"`
+	} `json:"scene_info"`
+}
+
+//V3RefundResult 退款结果通知（REFUND.SUCCESS、REFUND.ABNORMAL、REFUND.CLOSED）解密后的内容
+type V3RefundResult struct {
+	MchID               string `json:"mchid"`
+	OutTradeNo          string `json:"out_trade_no"`
+	TransactionID       string `json:"transaction_id"`
+	OutRefundNo         string `json:"out_refund_no"`
+	RefundID            string `json:"refund_id"`
+	RefundStatus        string `json:"refund_status"`
+	SuccessTime         string `json:"success_time"`
+	UserReceivedAccount string `json:"user_received_account"`
+	Amount              struct {
+		Total       int `json:"total"`
+		Refund      int `json:"refund"`
+		PayerTotal  int `json:"payer_total"`
+		PayerRefund int `json:"payer_refund"`
+	} `json:"amount"`
+}
+
+//ParseNotify 验证 v3 回调通知的签名和时间戳，返回通知内容和解密后的 resource 明文
+func (c *V3Client) ParseNotify(r *http.Request) (*NotifyProfitSharing, []byte, error) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(nil, r.Body, maxV3NotifyBodySize))
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = c.VerifyHeader(r.Header, body); err != nil {
+		return nil, nil, err
+	}
+	notify := new(NotifyProfitSharing)
+	if err = json.Unmarshal(body, notify); err != nil {
+		return nil, nil, fmt.Errorf("wechatpay v3 : parse notify error : %v", err)
+	}
+	resource := notify.Resource
+	plain, err := c.Decrypt(resource.AssociatedData, resource.Nonce, resource.CipherText)
+	if err != nil {
+		return nil, nil, fmt.Errorf("wechatpay v3 : decrypt notify resource error : %v", err)
+	}
+	return notify, plain, nil
+}
+
+//V3NotifyHandler 处理 v3 支付、退款和分账回调通知的 http.Handler
+//
+//验签并解密后根据 event_type 调用对应的回调，回调返回 nil 时应答成功，返回错误或验签失败时应答失败，
+//微信支付会稍后重试；没有设置回调或未知的通知类型默认应答 404，避免通知在没有处理的情况下被确认
+type V3NotifyHandler struct {
+	Client *V3Client
+
+	//AckUnhandled 为 true 时没有对应回调的通知也应答成功，适用于只关心部分通知类型的场景
+	AckUnhandled bool
+
+	OnTransaction   func(notify *NotifyProfitSharing, result *V3TransactionResult) error
+	OnRefund        func(notify *NotifyProfitSharing, result *V3RefundResult) error
+	OnProfitSharing func(notify *NotifyProfitSharing, result *ProfitSharingResult) error
+}
+
+//NotifyHandler 创建回调通知处理器，回调通过字段设置
+func (c *V3Client) NotifyHandler() *V3NotifyHandler {
+	return &V3NotifyHandler{Client: c}
+}
+
+//ServeHTTP 实现 http.Handler
+func (h *V3NotifyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeV3NotifyResponse(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	notify, plain, err := h.Client.ParseNotify(r)
+	if err != nil {
+		writeV3NotifyResponse(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	err = h.dispatch(notify, plain)
+	if errors.Is(err, ErrV3NotifyUnhandled) {
+		if h.AckUnhandled {
+			err = nil
+		} else {
+			writeV3NotifyResponse(w, http.StatusNotFound, err.Error())
+			return
+		}
+	}
+	if err != nil {
+		writeV3NotifyResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeV3NotifyResponse(w, http.StatusOK, "")
+}
+
+func (h *V3NotifyHandler) dispatch(notify *NotifyProfitSharing, plain []byte) error {
+	switch {
+	case strings.HasPrefix(notify.EventType, "TRANSACTION.") && h.OnTransaction != nil:
+		result := new(V3TransactionResult)
+		if err := json.Unmarshal(plain, result); err != nil {
+			return err
+		}
+		return h.OnTransaction(notify, result)
+	case strings.HasPrefix(notify.EventType, "REFUND.") && h.OnRefund != nil:
+		result := new(V3RefundResult)
+		if err := json.Unmarshal(plain, result); err != nil {
+			return err
+		}
+		return h.OnRefund(notify, result)
+	case strings.HasPrefix(notify.EventType, "PROFITSHARING.") && h.OnProfitSharing != nil:
+		result := new(ProfitSharingResult)
+		if err := json.Unmarshal(plain, result); err != nil {
+			return err
+		}
+		return h.OnProfitSharing(notify, result)
+	}
+	return fmt.Errorf("%w, event_type=%s", ErrV3NotifyUnhandled, notify.EventType)
+}
+
+//writeV3NotifyResponse 应答回调通知，message 为空时应答成功
+func writeV3NotifyResponse(w http.ResponseWriter, status int, message string) {
+	resp := NotifyProfitSharingResponse{Code: "SUCCESS"}
+	if message != "" {
+		resp = NotifyProfitSharingResponse{Code: "FAIL", Message: message}
+	}
+	data, _ := json.Marshal(resp)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
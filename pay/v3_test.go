@@ -0,0 +1,231 @@
+package pay
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fintcloud/wechat/context"
+)
+
+const testAPIv3Key = "0123456789abcdef0123456789abcdef"
+
+//newTestV3Client 创建一个使用同一对密钥作为商户密钥和平台证书的客户端
+func newTestV3Client(t *testing.T) (*V3Client, *x509.Certificate) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	client, err := NewV3Client(&context.Context{
+		PayMchID:        "1900000001",
+		PayCertSerialNo: "MCHSERIAL",
+		PayAPIv3Key:     testAPIv3Key,
+		PayPrivateKey:   string(keyPEM),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.certs["PLATFORM"] = cert
+	client.certsLoadedAt = time.Now()
+	return client, cert
+}
+
+func TestGetV3Client(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := &context.Context{
+		PayMchID:        "1900000001",
+		PayCertSerialNo: "MCHSERIAL",
+		PayAPIv3Key:     testAPIv3Key,
+		PayPrivateKey:   string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+	}
+	client, err := NewPay(ctx).GetV3Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other, _ := NewPay(ctx).GetV3Client(); other != client {
+		t.Error("Pay created from the same Context should share the v3 client")
+	}
+	if _, err = NewPay(&context.Context{PayMchID: "1900000001"}).GetV3Client(); err == nil {
+		t.Error("incomplete config should fail")
+	}
+}
+
+func TestV3VerifyHeader(t *testing.T) {
+	client, _ := newTestV3Client(t)
+	body := []byte(`{"code_url":"weixin://wxpay/bizpayurl?pr=p4lpSuKzz"}`)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	signature, err := client.Sign([]byte(timestamp + "\nnonce\n" + string(body) + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := http.Header{}
+	header.Set(HeaderWechatpaySerial, "PLATFORM")
+	header.Set(HeaderWechatpayTimestamp, timestamp)
+	header.Set(HeaderWechatpayNonce, "nonce")
+	header.Set(HeaderWechatpaySignature, signature)
+	if err = client.VerifyHeader(header, body); err != nil {
+		t.Fatalf("verify error : %v", err)
+	}
+
+	if err = client.VerifyHeader(header, []byte(`{}`)); err == nil {
+		t.Error("expected verification failure for tampered body")
+	}
+
+	header.Set(HeaderWechatpayTimestamp, strconv.FormatInt(time.Now().Add(-10*time.Minute).Unix(), 10))
+	if err = client.VerifyHeader(header, body); err == nil {
+		t.Error("expected error for expired timestamp")
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestV3LoadCertificatesBackoff(t *testing.T) {
+	client, _ := newTestV3Client(t)
+	client.certs = make(map[string]*x509.Certificate)
+	var downloads int32
+	client.HTTPClient = &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&downloads, 1)
+		rec := httptest.NewRecorder()
+		rec.WriteHeader(http.StatusInternalServerError)
+		return rec.Result(), nil
+	})}
+
+	if _, err := client.Certificate("PLATFORM"); err == nil {
+		t.Error("expected download error")
+	}
+	for i := 0; i < 3; i++ {
+		client.Certificate("PLATFORM")
+		client.Certificates()
+	}
+	if downloads != 1 {
+		t.Errorf("downloaded certificates %d times, want 1", downloads)
+	}
+}
+
+func TestV3Authorization(t *testing.T) {
+	client, _ := newTestV3Client(t)
+	auth, err := client.Authorization(http.MethodPost, "/v3/pay/transactions/native", []byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(auth, v3AuthSchema+` mchid="1900000001",`) || !strings.Contains(auth, `serial_no="MCHSERIAL"`) {
+		t.Errorf("unexpected authorization %s", auth)
+	}
+}
+
+func TestDecryptAES256GCM(t *testing.T) {
+	block, _ := aes.NewCipher([]byte(testAPIv3Key))
+	gcm, _ := cipher.NewGCM(block)
+	nonce := "abcdefghijkl"
+	ciphertext := gcm.Seal(nil, []byte(nonce), []byte("plain text"), []byte("certificate"))
+
+	plain, err := DecryptAES256GCM([]byte(testAPIv3Key), "certificate", nonce, base64.StdEncoding.EncodeToString(ciphertext))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plain) != "plain text" {
+		t.Errorf("unexpected plain text %q", plain)
+	}
+	if _, err = DecryptAES256GCM([]byte(testAPIv3Key), "other", nonce, base64.StdEncoding.EncodeToString(ciphertext)); err == nil {
+		t.Error("expected error for wrong associated data")
+	}
+}
+
+func TestV3NotifyHandler(t *testing.T) {
+	client, _ := newTestV3Client(t)
+
+	block, _ := aes.NewCipher([]byte(testAPIv3Key))
+	gcm, _ := cipher.NewGCM(block)
+	nonce := "fdasflkja484"
+	plain := `{"mchid":"1900000001","out_trade_no":"1217752501201407033233368018","transaction_id":"4200000000000000","trade_state":"SUCCESS","amount":{"total":100}}`
+	ciphertext := base64.StdEncoding.EncodeToString(gcm.Seal(nil, []byte(nonce), []byte(plain), []byte("transaction")))
+	body := `{"id":"EV-2018022511223320873","create_time":"2015-05-20T13:29:35+08:00","resource_type":"encrypt-resource","event_type":"TRANSACTION.SUCCESS",` +
+		`"resource":{"algorithm":"AEAD_AES_256_GCM","ciphertext":"` + ciphertext + `","associated_data":"transaction","nonce":"` + nonce + `"}}`
+
+	newRequest := func(body string) *http.Request {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		signature, err := client.Sign([]byte(timestamp + "\nnonce\n" + body + "\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/notify", strings.NewReader(body))
+		req.Header.Set(HeaderWechatpaySerial, "PLATFORM")
+		req.Header.Set(HeaderWechatpayTimestamp, timestamp)
+		req.Header.Set(HeaderWechatpayNonce, "nonce")
+		req.Header.Set(HeaderWechatpaySignature, signature)
+		return req
+	}
+
+	var got *V3TransactionResult
+	handler := client.NotifyHandler()
+	handler.OnTransaction = func(notify *NotifyProfitSharing, result *V3TransactionResult) error {
+		got = result
+		return nil
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, newRequest(body))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"SUCCESS"`) {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Body.String())
+	}
+	if got == nil || got.TransactionID != "4200000000000000" || got.Amount.Total != 100 {
+		t.Fatalf("unexpected result %+v", got)
+	}
+
+	//没有设置回调的通知不应答成功，除非设置了 AckUnhandled
+	handler.OnTransaction = nil
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, newRequest(body))
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), `"FAIL"`) {
+		t.Errorf("expected 404 for unhandled event, got %d %s", w.Code, w.Body.String())
+	}
+	handler.AckUnhandled = true
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, newRequest(body))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected ack for unhandled event, got %d %s", w.Code, w.Body.String())
+	}
+
+	req := newRequest(body)
+	req.Header.Set(HeaderWechatpayNonce, "other")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code == http.StatusOK || !strings.Contains(w.Body.String(), `"FAIL"`) {
+		t.Errorf("expected failure for invalid signature, got %d %s", w.Code, w.Body.String())
+	}
+}
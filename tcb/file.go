@@ -2,6 +2,7 @@ package tcb
 
 import (
 	"fmt"
+	"io"
 
 	"github.com/fintcloud/wechat/util"
 )
@@ -70,7 +71,7 @@ type BatchDeleteFileRes struct {
 	} `json:"delete_list"`
 }
 
-//UploadFile 上传文件
+//UploadFile 获取文件上传链接，使用 UploadFileFromReader 可直接上传文件内容
 //reference:https://developers.weixin.qq.com/miniprogram/dev/wxcloud/reference-http-api/storage/uploadFile.html
 func (tcb *Tcb) UploadFile(env, path string) (*UploadFileRes, error) {
 	accessToken, err := tcb.GetAccessToken()
@@ -91,6 +92,35 @@ func (tcb *Tcb) UploadFile(env, path string) (*UploadFileRes, error) {
 	return uploadFileRes, err
 }
 
+//UploadFileFromReader 获取上传链接并将 reader 中的内容上传到云存储的 path，size 小于0表示长度未知
+func (tcb *Tcb) UploadFileFromReader(env, path string, reader io.Reader, size int64) (*UploadFileRes, error) {
+	uploadFileRes, err := tcb.UploadFile(env, path)
+	if err != nil {
+		return nil, err
+	}
+	fields := []util.MultipartFormField{
+		{Fieldname: "key", Value: []byte(path)},
+		{Fieldname: "Signature", Value: []byte(uploadFileRes.Authorization)},
+		{Fieldname: "x-cos-security-token", Value: []byte(uploadFileRes.Token)},
+		{Fieldname: "x-cos-meta-fileid", Value: []byte(uploadFileRes.CosFileID)},
+		{IsFile: true, Fieldname: "file", Filename: path, Reader: reader, Size: size},
+	}
+	if _, err = util.PostMultipartForm(fields, uploadFileRes.URL); err != nil {
+		return nil, fmt.Errorf("UploadFile error : upload to %s failed, err=%v", uploadFileRes.URL, err)
+	}
+	return uploadFileRes, nil
+}
+
+//UploadFileFromURL 下载 fileURL 的内容并上传到云存储的 path
+func (tcb *Tcb) UploadFileFromURL(env, path, fileURL string) (*UploadFileRes, error) {
+	body, _, size, err := util.OpenURL(fileURL)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return tcb.UploadFileFromReader(env, path, body, size)
+}
+
 //BatchDownloadFile 获取文件下载链接
 //reference:https://developers.weixin.qq.com/miniprogram/dev/wxcloud/reference-http-api/storage/batchDownloadFile.html
 func (tcb *Tcb) BatchDownloadFile(env string, fileList []*DownloadFile) (*BatchDownloadFileRes, error) {
@@ -0,0 +1,96 @@
+package user
+
+const (
+	blacklistGetURL     = "https://api.weixin.qq.com/cgi-bin/tags/members/getblacklist?access_token=%s"
+	blacklistBatchURL   = "https://api.weixin.qq.com/cgi-bin/tags/members/batchblacklist?access_token=%s"
+	blacklistUnbatchURL = "https://api.weixin.qq.com/cgi-bin/tags/members/batchunblacklist?access_token=%s"
+
+	//batchBlacklistLimit 每次拉黑或取消拉黑的openid数量上限
+	batchBlacklistLimit = 20
+)
+
+//BatchFailure 分批请求中失败的一批
+type BatchFailure struct {
+	OpenIDs []string
+	Err     error
+}
+
+//BatchReport 分批请求的结果
+type BatchReport struct {
+	Total     int            //openid 总数
+	Succeeded []string       //处理成功的openid
+	Failed    []BatchFailure //处理失败的批次
+}
+
+//HasFailure 是否存在失败的批次
+func (report *BatchReport) HasFailure() bool {
+	return len(report.Failed) > 0
+}
+
+type reqBlacklist struct {
+	BeginOpenID string `json:"begin_openid"`
+}
+
+type reqBatchBlacklist struct {
+	OpenIDList []string `json:"openid_list"`
+}
+
+//ListBlacklist 获取公众号的黑名单列表，每次最多10000个，beginOpenid 为空时从头开始拉取
+func (user *User) ListBlacklist(beginOpenid ...string) (*OpenidList, error) {
+	req := &reqBlacklist{}
+	if len(beginOpenid) > 0 {
+		req.BeginOpenID = beginOpenid[0]
+	}
+	blacklist := new(OpenidList)
+	if err := user.postJSON(blacklistGetURL, req, blacklist, "ListBlacklist"); err != nil {
+		return nil, err
+	}
+	return blacklist, nil
+}
+
+//ListAllBlacklist 返回黑名单中所有用户的OpenID
+func (user *User) ListAllBlacklist() ([]string, error) {
+	nextOpenid := ""
+	openids := []string{}
+	count := 0
+	for {
+		bl, err := user.ListBlacklist(nextOpenid)
+		if err != nil {
+			return nil, err
+		}
+		openids = append(openids, bl.Data.OpenIDs...)
+		count += bl.Count
+		if bl.Count == 0 || bl.Total <= count || bl.NextOpenID == "" {
+			return openids, nil
+		}
+		nextOpenid = bl.NextOpenID
+	}
+}
+
+//BatchBlacklist 拉黑用户，超过20个openid时自动分批请求，单批失败不影响其他批次
+func (user *User) BatchBlacklist(openIDs []string) *BatchReport {
+	return user.batchBlacklist(blacklistBatchURL, openIDs, "BatchBlacklist")
+}
+
+//BatchUnblacklist 取消拉黑用户，超过20个openid时自动分批请求，单批失败不影响其他批次
+func (user *User) BatchUnblacklist(openIDs []string) *BatchReport {
+	return user.batchBlacklist(blacklistUnbatchURL, openIDs, "BatchUnblacklist")
+}
+
+func (user *User) batchBlacklist(urlStr string, openIDs []string, apiName string) *BatchReport {
+	report := &BatchReport{Total: len(openIDs)}
+	for start := 0; start < len(openIDs); start += batchBlacklistLimit {
+		end := start + batchBlacklistLimit
+		if end > len(openIDs) {
+			end = len(openIDs)
+		}
+		chunk := openIDs[start:end]
+		var res resTag
+		if err := user.postJSON(urlStr, &reqBatchBlacklist{OpenIDList: chunk}, &res, apiName); err != nil {
+			report.Failed = append(report.Failed, BatchFailure{OpenIDs: chunk, Err: err})
+			continue
+		}
+		report.Succeeded = append(report.Succeeded, chunk...)
+	}
+	return report
+}
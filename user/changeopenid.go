@@ -0,0 +1,95 @@
+package user
+
+import (
+	"github.com/fintcloud/wechat/util"
+)
+
+const (
+	changeOpenIDURL = "https://api.weixin.qq.com/cgi-bin/changeopenid?access_token=%s"
+
+	//changeOpenIDLimit 每次转换的openid数量上限
+	changeOpenIDLimit = 100
+)
+
+//ChangeOpenIDResult 单个openid的转换结果
+type ChangeOpenIDResult struct {
+	OriOpenID string `json:"ori_openid"` //原帐号的openid
+	NewOpenID string `json:"new_openid"` //新帐号的openid，转换失败时为空
+	ErrMsg    string `json:"err_msg"`    //转换失败的原因，成功时为 ok
+}
+
+//Success 是否转换成功
+func (res *ChangeOpenIDResult) Success() bool {
+	return res.NewOpenID != ""
+}
+
+//ChangeOpenIDReport openid 迁移结果
+type ChangeOpenIDReport struct {
+	Total   int
+	Results []*ChangeOpenIDResult //与输入的openid一一对应，整批请求失败时 ErrMsg 为请求的错误信息
+	Failed  int                   //转换失败的openid数量
+}
+
+//Mapping 返回转换成功的 原openid -> 新openid 映射
+func (report *ChangeOpenIDReport) Mapping() map[string]string {
+	mapping := make(map[string]string, len(report.Results))
+	for _, res := range report.Results {
+		if res.Success() {
+			mapping[res.OriOpenID] = res.NewOpenID
+		}
+	}
+	return mapping
+}
+
+type reqChangeOpenID struct {
+	FromAppID  string   `json:"from_appid"`
+	OpenIDList []string `json:"openid_list"`
+}
+
+type resChangeOpenID struct {
+	util.CommonError
+
+	ResultList []*ChangeOpenIDResult `json:"result_list"`
+}
+
+//ChangeOpenID 公众号迁移后将原帐号粉丝的openid转换为新帐号的openid，需使用新帐号的 access_token 调用
+//
+//fromAppID 为原帐号的appid，超过100个openid时自动分批请求，单批失败不影响其他批次
+func (user *User) ChangeOpenID(fromAppID string, openIDs []string) *ChangeOpenIDReport {
+	report := &ChangeOpenIDReport{
+		Total:   len(openIDs),
+		Results: make([]*ChangeOpenIDResult, 0, len(openIDs)),
+	}
+	for start := 0; start < len(openIDs); start += changeOpenIDLimit {
+		end := start + changeOpenIDLimit
+		if end > len(openIDs) {
+			end = len(openIDs)
+		}
+		chunk := openIDs[start:end]
+		var res resChangeOpenID
+		err := user.postJSON(changeOpenIDURL, &reqChangeOpenID{FromAppID: fromAppID, OpenIDList: chunk}, &res, "ChangeOpenID")
+		if err != nil {
+			for _, openID := range chunk {
+				report.Results = append(report.Results, &ChangeOpenIDResult{OriOpenID: openID, ErrMsg: err.Error()})
+			}
+			report.Failed += len(chunk)
+			continue
+		}
+		//按输入顺序整理结果，未在 result_list 中返回的openid记为失败
+		results := make(map[string]*ChangeOpenIDResult, len(res.ResultList))
+		for _, result := range res.ResultList {
+			results[result.OriOpenID] = result
+		}
+		for _, openID := range chunk {
+			result, ok := results[openID]
+			if !ok {
+				result = &ChangeOpenIDResult{OriOpenID: openID, ErrMsg: "not returned in result_list"}
+			}
+			if !result.Success() {
+				report.Failed++
+			}
+			report.Results = append(report.Results, result)
+		}
+	}
+	return report
+}
@@ -0,0 +1,31 @@
+package user
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestChangeOpenIDMissingResult(t *testing.T) {
+	user, restore := newTestUser(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req reqChangeOpenID
+		json.NewDecoder(r.Body).Decode(&req)
+		//只返回第一个openid的转换结果
+		fmt.Fprintf(w, `{"errcode":0,"errmsg":"ok","result_list":[{"ori_openid":%q,"new_openid":"new_%s","err_msg":"ok"}]}`, req.OpenIDList[0], req.OpenIDList[0])
+	}))
+	defer restore()
+
+	report := user.ChangeOpenID("wx_from", []string{"a", "b", "c"})
+	if report.Total != 3 || report.Failed != 2 || len(report.Results) != 3 {
+		t.Fatalf("report total=%d failed=%d results=%d", report.Total, report.Failed, len(report.Results))
+	}
+	for i, openID := range []string{"a", "b", "c"} {
+		if report.Results[i].OriOpenID != openID {
+			t.Errorf("results[%d] is %s, want %s", i, report.Results[i].OriOpenID, openID)
+		}
+	}
+	if mapping := report.Mapping(); len(mapping) != 1 || mapping["a"] != "new_a" {
+		t.Errorf("mapping %v", mapping)
+	}
+}
@@ -0,0 +1,455 @@
+package user
+
+import (
+	icontext "context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fintcloud/wechat/util"
+)
+
+const (
+	userBatchGetURL = "https://api.weixin.qq.com/cgi-bin/user/info/batchget?access_token=%s"
+
+	//batchGetLimit 每次批量获取用户信息的openid数量上限
+	batchGetLimit = 100
+	//userListLimit 每次拉取关注者列表的数量上限
+	userListLimit = 10000
+)
+
+//OpenIDIterator 逐页遍历关注者OpenID，每页最多10000个
+type OpenIDIterator struct {
+	user *User
+	next string
+	done bool
+}
+
+//NewOpenIDIterator 从 nextOpenid 开始遍历关注者，为空时从头开始
+func (user *User) NewOpenIDIterator(nextOpenid string) *OpenIDIterator {
+	return &OpenIDIterator{
+		user: user,
+		next: nextOpenid,
+	}
+}
+
+//Next 拉取下一页，遍历结束时返回 io.EOF
+func (it *OpenIDIterator) Next() ([]string, error) {
+	if it.done {
+		return nil, io.EOF
+	}
+	ul, err := it.user.ListUserOpenIDs(it.next)
+	if err != nil {
+		return nil, err
+	}
+	if ul.Count < userListLimit || ul.NextOpenID == "" {
+		it.done = true
+	}
+	if ul.Count == 0 {
+		return nil, io.EOF
+	}
+	it.next = ul.NextOpenID
+	return ul.Data.OpenIDs, nil
+}
+
+//NextOpenID 返回下一页的起始位置，可保存下来用于中断后继续遍历
+func (it *OpenIDIterator) NextOpenID() string {
+	return it.next
+}
+
+type reqBatchGetUser struct {
+	UserList []batchGetUserItem `json:"user_list"`
+}
+
+type batchGetUserItem struct {
+	OpenID string `json:"openid"`
+	Lang   string `json:"lang,omitempty"`
+}
+
+type resBatchGetUser struct {
+	util.CommonError
+
+	UserInfoList []*Info `json:"user_info_list"`
+}
+
+//BatchGetUserInfo 批量获取用户基本信息，超过100个openid时自动分批请求，lang 为空时使用 zh_CN
+func (user *User) BatchGetUserInfo(openIDs []string, lang string) ([]*Info, error) {
+	if lang == "" {
+		lang = "zh_CN"
+	}
+	infos := make([]*Info, 0, len(openIDs))
+	for start := 0; start < len(openIDs); start += batchGetLimit {
+		end := start + batchGetLimit
+		if end > len(openIDs) {
+			end = len(openIDs)
+		}
+		req := &reqBatchGetUser{UserList: make([]batchGetUserItem, 0, end-start)}
+		for _, openID := range openIDs[start:end] {
+			req.UserList = append(req.UserList, batchGetUserItem{OpenID: openID, Lang: lang})
+		}
+		var res resBatchGetUser
+		if err := user.postJSON(userBatchGetURL, req, &res, "BatchGetUserInfo"); err != nil {
+			return nil, err
+		}
+		infos = append(infos, res.UserInfoList...)
+	}
+	return infos, nil
+}
+
+//ExportFormat 导出文件格式
+type ExportFormat string
+
+const (
+	//ExportFormatJSONL 每行一个 json 格式的 Info
+	ExportFormatJSONL ExportFormat = "jsonl"
+	//ExportFormatCSV 带表头的 csv
+	ExportFormatCSV ExportFormat = "csv"
+)
+
+//ExportOpts 导出关注者信息的配置
+type ExportOpts struct {
+	Format     ExportFormat //默认 ExportFormatJSONL
+	Workers    int          //并发调用 batchget 的数量，默认4
+	Lang       string       //默认 zh_CN
+	Checkpoint string       //保存导出进度的文件路径，为空时不支持断点续传
+}
+
+var csvHeader = []string{
+	"openid", "unionid", "subscribe", "nickname", "sex", "city", "province", "country", "language", "headimgurl",
+	"subscribe_time", "remark", "groupid", "tagid_list", "subscribe_scene", "qr_scene", "qr_scene_str",
+}
+
+//exportCheckpoint 导出进度，每写完一页保存一次
+type exportCheckpoint struct {
+	NextOpenID string `json:"next_openid"`
+	Offset     int64  `json:"offset"` //已写完的页在 w 中的结束位置
+	Pages      int    `json:"pages"`  //已写完的页数
+	Done       bool   `json:"done"`   //所有页都已写完
+}
+
+//truncateWriter 支持截断的输出，如 *os.File
+type truncateWriter interface {
+	io.Writer
+	io.Seeker
+	Truncate(size int64) error
+}
+
+//ExportUserInfo 遍历所有关注者并将用户信息写入 w，返回本次写入的记录数
+//
+//拉取关注者列表、并发 batchget 与写入 w 流水线执行：写入当前页的同时拉取并获取下一页的用户信息。
+//每写完一页（10000个关注者）就将 next_openid 与输出位置保存到 Checkpoint 文件，中断后使用同一个 Checkpoint
+//再次调用会从上次的位置继续，全部导出完成后删除 Checkpoint 文件。
+//
+//w 为 *os.File 等支持 Seek 与 Truncate 的输出时，记录从 w 的末尾开始写入，继续导出前会把 w 截断到最后一次保存的位置，
+//中断时写了一半的页不会重复；其他类型的 w 无法回退，应以追加方式打开，中断时的那一页会再次写入（至少一次）
+func (user *User) ExportUserInfo(ctx icontext.Context, w io.Writer, opts *ExportOpts) (count int, err error) {
+	if opts == nil {
+		opts = &ExportOpts{}
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = 4
+	}
+	format := opts.Format
+	if format == "" {
+		format = ExportFormatJSONL
+	}
+	if format != ExportFormatJSONL && format != ExportFormatCSV {
+		return 0, fmt.Errorf("unsupported export format %q", format)
+	}
+
+	var cp *exportCheckpoint
+	if opts.Checkpoint != "" {
+		cp, err = readCheckpoint(opts.Checkpoint)
+		if err != nil {
+			return
+		}
+	}
+	resume := cp != nil
+	if !resume {
+		cp = &exportCheckpoint{}
+	}
+	out := &countingWriter{w: w}
+	if tw, ok := w.(truncateWriter); ok {
+		if out.n, err = seekOutput(tw, cp.Offset, resume); err != nil {
+			return
+		}
+	}
+	if opts.Checkpoint != "" && !resume {
+		cp.Offset = out.n
+		if err = writeCheckpoint(opts.Checkpoint, cp); err != nil {
+			return
+		}
+	}
+
+	if !cp.Done {
+		count, err = user.exportPages(ctx, out, format, workers, opts, cp)
+		if err != nil {
+			return
+		}
+	}
+
+	if opts.Checkpoint != "" {
+		if e := os.Remove(opts.Checkpoint); e != nil && !os.IsNotExist(e) {
+			err = e
+		}
+	}
+	return
+}
+
+//seekOutput 新导出时定位到 w 的末尾；继续导出时把 w 截断到 offset 并定位到该处
+func seekOutput(w truncateWriter, offset int64, resume bool) (int64, error) {
+	end, err := w.Seek(0, io.SeekEnd)
+	if err != nil || !resume {
+		return end, err
+	}
+	if end < offset {
+		return 0, fmt.Errorf("export output is shorter than checkpoint offset, size=%d, offset=%d", end, offset)
+	}
+	if err = w.Truncate(offset); err != nil {
+		return 0, err
+	}
+	return w.Seek(offset, io.SeekStart)
+}
+
+//exportPage 流水线中的一页关注者
+type exportPage struct {
+	chunks  [][]string
+	results [][]*Info
+	next    string
+	done    bool
+
+	wg      sync.WaitGroup
+	errOnce sync.Once
+	err     error
+}
+
+type exportJob struct {
+	page *exportPage
+	idx  int
+}
+
+func (user *User) exportPages(ctx icontext.Context, out *countingWriter, format ExportFormat, workers int, opts *ExportOpts, cp *exportCheckpoint) (count int, err error) {
+	ctx, cancel := icontext.WithCancel(ctx)
+	pages, wait := user.fetchPages(ctx, cp.NextOpenID, workers, opts.Lang)
+	defer func() {
+		cancel()
+		if e := wait(); err == nil {
+			err = e
+		}
+	}()
+
+	var csvWriter *csv.Writer
+	jsonEncoder := json.NewEncoder(out)
+	if format == ExportFormatCSV {
+		csvWriter = csv.NewWriter(out)
+		if cp.Pages == 0 {
+			if err = csvWriter.Write(csvHeader); err != nil {
+				return
+			}
+		}
+	}
+
+	for page := range pages {
+		page.wg.Wait()
+		if page.err != nil {
+			return count, page.err
+		}
+		for _, infos := range page.results {
+			for _, info := range infos {
+				if csvWriter != nil {
+					err = csvWriter.Write(infoToCSVRecord(info))
+				} else {
+					err = jsonEncoder.Encode(info)
+				}
+				if err != nil {
+					return
+				}
+				count++
+			}
+		}
+		if csvWriter != nil {
+			csvWriter.Flush()
+			if err = csvWriter.Error(); err != nil {
+				return
+			}
+		}
+
+		cp.NextOpenID = page.next
+		cp.Offset = out.n
+		cp.Pages++
+		cp.Done = page.done
+		if opts.Checkpoint != "" {
+			if err = writeCheckpoint(opts.Checkpoint, cp); err != nil {
+				return
+			}
+		}
+	}
+	return count, ctx.Err()
+}
+
+//fetchPages 逐页拉取关注者并将每页按100个一组交给 workers 并发 batchget，按顺序返回各页
+//
+//wait 等待所有 goroutine 退出，返回拉取关注者列表时的错误
+func (user *User) fetchPages(ctx icontext.Context, nextOpenid string, workers int, lang string) (pages <-chan *exportPage, wait func() error) {
+	pageCh := make(chan *exportPage)
+	jobs := make(chan exportJob)
+	var (
+		wg      sync.WaitGroup
+		listErr error
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				page := job.page
+				if ctx.Err() == nil {
+					infos, err := user.BatchGetUserInfo(page.chunks[job.idx], lang)
+					if err != nil {
+						page.errOnce.Do(func() {
+							page.err = err
+						})
+					}
+					page.results[job.idx] = infos
+				}
+				page.wg.Done()
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(pageCh)
+		defer close(jobs)
+
+		it := user.NewOpenIDIterator(nextOpenid)
+		for ctx.Err() == nil {
+			openIDs, err := it.Next()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				listErr = err
+				return
+			}
+			page := &exportPage{chunks: splitOpenIDs(openIDs), next: it.NextOpenID(), done: it.done}
+			page.results = make([][]*Info, len(page.chunks))
+			page.wg.Add(len(page.chunks))
+			for idx := range page.chunks {
+				select {
+				case jobs <- exportJob{page: page, idx: idx}:
+				case <-ctx.Done():
+					//未派发的部分不会再处理，该页也不会交给写入方
+					return
+				}
+			}
+			select {
+			case pageCh <- page:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return pageCh, func() error {
+		wg.Wait()
+		return listErr
+	}
+}
+
+func splitOpenIDs(openIDs []string) [][]string {
+	chunks := make([][]string, 0, len(openIDs)/batchGetLimit+1)
+	for start := 0; start < len(openIDs); start += batchGetLimit {
+		end := start + batchGetLimit
+		if end > len(openIDs) {
+			end = len(openIDs)
+		}
+		chunks = append(chunks, openIDs[start:end])
+	}
+	return chunks
+}
+
+//countingWriter 记录写入 w 后的位置
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+func infoToCSVRecord(info *Info) []string {
+	tagIDs := make([]string, 0, len(info.TagidList))
+	for _, tagID := range info.TagidList {
+		tagIDs = append(tagIDs, strconv.FormatInt(int64(tagID), 10))
+	}
+	return []string{
+		info.OpenID,
+		info.UnionID,
+		strconv.FormatInt(int64(info.Subscribe), 10),
+		info.Nickname,
+		strconv.FormatInt(int64(info.Sex), 10),
+		info.City,
+		info.Province,
+		info.Country,
+		info.Language,
+		info.Headimgurl,
+		strconv.FormatInt(int64(info.SubscribeTime), 10),
+		info.Remark,
+		strconv.FormatInt(int64(info.GroupID), 10),
+		strings.Join(tagIDs, ";"),
+		info.SubscribeScene,
+		strconv.Itoa(info.QrScene),
+		info.QrSceneStr,
+	}
+}
+
+//readCheckpoint 读取导出进度，文件不存在时返回 nil
+func readCheckpoint(path string) (*exportCheckpoint, error) {
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read checkpoint error, path=%s, err=%v", path, err)
+	}
+	cp := new(exportCheckpoint)
+	if err = json.Unmarshal(content, cp); err != nil {
+		return nil, fmt.Errorf("parse checkpoint error, path=%s, err=%v", path, err)
+	}
+	return cp, nil
+}
+
+//writeCheckpoint 先写入临时文件再重命名，避免中断时留下不完整的内容
+func writeCheckpoint(path string, cp *exportCheckpoint) error {
+	content, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
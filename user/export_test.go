@@ -0,0 +1,242 @@
+package user
+
+import (
+	"bufio"
+	"bytes"
+	icontext "context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fintcloud/wechat/cache"
+	"github.com/fintcloud/wechat/context"
+)
+
+//fakeUserAPI 模拟 user/get 与 user/info/batchget 接口
+type fakeUserAPI struct {
+	openIDs   []string
+	failBatch func(first string) bool
+	listCalls int32
+}
+
+func (api *fakeUserAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/cgi-bin/user/get":
+		atomic.AddInt32(&api.listCalls, 1)
+		start := 0
+		if next := r.URL.Query().Get("next_openid"); next != "" {
+			for i, openID := range api.openIDs {
+				if openID == next {
+					start = i + 1
+				}
+			}
+		}
+		end := start + userListLimit
+		if end > len(api.openIDs) {
+			end = len(api.openIDs)
+		}
+		res := map[string]interface{}{"total": len(api.openIDs), "count": end - start, "next_openid": ""}
+		if end > start {
+			res["data"] = map[string]interface{}{"openid": api.openIDs[start:end]}
+			res["next_openid"] = api.openIDs[end-1]
+		}
+		json.NewEncoder(w).Encode(res)
+	case "/cgi-bin/user/info/batchget":
+		var req reqBatchGetUser
+		json.NewDecoder(r.Body).Decode(&req)
+		if api.failBatch != nil && api.failBatch(req.UserList[0].OpenID) {
+			fmt.Fprint(w, `{"errcode":-1,"errmsg":"system error"}`)
+			return
+		}
+		infos := make([]*Info, 0, len(req.UserList))
+		for _, item := range req.UserList {
+			infos = append(infos, &Info{OpenID: item.OpenID, Nickname: "name_" + item.OpenID, TagidList: []int32{1, 2}})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"user_info_list": infos})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+type handlerTransport struct {
+	handler http.Handler
+}
+
+func (t *handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rec := httptest.NewRecorder()
+	t.handler.ServeHTTP(rec, req)
+	return rec.Result(), nil
+}
+
+//newTestUser 将默认 http client 的请求交给 api 处理，返回的函数用于恢复
+func newTestUser(api http.Handler) (*User, func()) {
+	transport := http.DefaultTransport
+	http.DefaultTransport = &handlerTransport{handler: api}
+	ctx := &context.Context{AppID: "wx_test", Cache: cache.NewMemory()}
+	ctx.SetAccessTokenLock(new(sync.RWMutex))
+	ctx.Cache.Set("access_token_wx_test", "token", time.Hour)
+	return NewUser(ctx), func() {
+		http.DefaultTransport = transport
+	}
+}
+
+func newFakeUserAPI(n int) *fakeUserAPI {
+	api := &fakeUserAPI{openIDs: make([]string, n)}
+	for i := range api.openIDs {
+		api.openIDs[i] = fmt.Sprintf("openid%05d", i)
+	}
+	return api
+}
+
+func TestOpenIDIterator(t *testing.T) {
+	api := newFakeUserAPI(userListLimit + 5)
+	user, restore := newTestUser(api)
+	defer restore()
+
+	it := user.NewOpenIDIterator("")
+	var sizes []int
+	for {
+		openIDs, err := it.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes = append(sizes, len(openIDs))
+	}
+	if len(sizes) != 2 || sizes[0] != userListLimit || sizes[1] != 5 {
+		t.Errorf("page sizes %v", sizes)
+	}
+	if it.NextOpenID() != "openid10004" {
+		t.Errorf("NextOpenID=%s", it.NextOpenID())
+	}
+	if _, err := it.Next(); err != io.EOF {
+		t.Errorf("Next after the last page should return io.EOF, got %v", err)
+	}
+	if api.listCalls != 2 {
+		t.Errorf("user/get called %d times", api.listCalls)
+	}
+
+	//从保存的位置继续
+	it = user.NewOpenIDIterator("openid09999")
+	if openIDs, err := it.Next(); err != nil || len(openIDs) != 5 || openIDs[0] != "openid10000" {
+		t.Errorf("resume from next_openid: %v %v", openIDs, err)
+	}
+}
+
+func TestExportUserInfoFormats(t *testing.T) {
+	api := newFakeUserAPI(250)
+	user, restore := newTestUser(api)
+	defer restore()
+
+	var buf bytes.Buffer
+	count, err := user.ExportUserInfo(icontext.Background(), &buf, &ExportOpts{Workers: 2})
+	if err != nil || count != 250 {
+		t.Fatalf("jsonl export count=%d err=%v", count, err)
+	}
+	scanner := bufio.NewScanner(&buf)
+	for i := 0; scanner.Scan(); i++ {
+		var info Info
+		if err = json.Unmarshal(scanner.Bytes(), &info); err != nil {
+			t.Fatal(err)
+		}
+		if info.OpenID != api.openIDs[i] || info.Nickname != "name_"+api.openIDs[i] {
+			t.Fatalf("line %d: %+v", i, info)
+		}
+	}
+
+	buf.Reset()
+	if count, err = user.ExportUserInfo(icontext.Background(), &buf, &ExportOpts{Format: ExportFormatCSV}); err != nil || count != 250 {
+		t.Fatalf("csv export count=%d err=%v", count, err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 251 || strings.Join(records[0], ",") != strings.Join(csvHeader, ",") {
+		t.Fatalf("csv header %v, %d records", records[0], len(records))
+	}
+	if records[1][0] != "openid00000" || records[1][3] != "name_openid00000" || records[1][13] != "1;2" {
+		t.Errorf("csv record %v", records[1])
+	}
+
+	if _, err = user.ExportUserInfo(icontext.Background(), &buf, &ExportOpts{Format: "xml"}); err == nil {
+		t.Error("unsupported format should fail")
+	}
+}
+
+func TestExportUserInfoResume(t *testing.T) {
+	api := newFakeUserAPI(userListLimit + 150)
+	failed := false
+	api.failBatch = func(first string) bool {
+		//第二页第一次 batchget 失败
+		if first == "openid10100" && !failed {
+			failed = true
+			return true
+		}
+		return false
+	}
+	user, restore := newTestUser(api)
+	defer restore()
+
+	dir, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	opts := &ExportOpts{Format: ExportFormatCSV, Checkpoint: filepath.Join(dir, "checkpoint")}
+	output := filepath.Join(dir, "users.csv")
+	f, err := os.OpenFile(output, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	count, err := user.ExportUserInfo(icontext.Background(), f, opts)
+	if err == nil || count != userListLimit {
+		t.Fatalf("first run count=%d err=%v", count, err)
+	}
+	cp, err := readCheckpoint(opts.Checkpoint)
+	if err != nil || cp == nil || cp.NextOpenID != "openid09999" || cp.Pages != 1 {
+		t.Fatalf("checkpoint %+v err=%v", cp, err)
+	}
+	//模拟写入第二页时中断，留下不完整的记录
+	if _, err = f.WriteString("openid10000,partial"); err != nil {
+		t.Fatal(err)
+	}
+
+	if count, err = user.ExportUserInfo(icontext.Background(), f, opts); err != nil || count != 150 {
+		t.Fatalf("resume count=%d err=%v", count, err)
+	}
+	if _, err = os.Stat(opts.Checkpoint); !os.IsNotExist(err) {
+		t.Error("checkpoint should be removed after export finished")
+	}
+	content, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(bytes.NewReader(content)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != len(api.openIDs)+1 {
+		t.Fatalf("got %d records, want %d", len(records), len(api.openIDs)+1)
+	}
+	for i, openID := range api.openIDs {
+		if records[i+1][0] != openID {
+			t.Fatalf("record %d is %s, want %s", i+1, records[i+1][0], openID)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package user
+
+import (
+	"fmt"
+
+	"github.com/fintcloud/wechat/util"
+)
+
+const (
+	tagCreateURL         = "https://api.weixin.qq.com/cgi-bin/tags/create?access_token=%s"
+	tagGetURL            = "https://api.weixin.qq.com/cgi-bin/tags/get?access_token=%s"
+	tagUpdateURL         = "https://api.weixin.qq.com/cgi-bin/tags/update?access_token=%s"
+	tagDeleteURL         = "https://api.weixin.qq.com/cgi-bin/tags/delete?access_token=%s"
+	tagBatchTaggingURL   = "https://api.weixin.qq.com/cgi-bin/tags/members/batchtagging?access_token=%s"
+	tagBatchUntaggingURL = "https://api.weixin.qq.com/cgi-bin/tags/members/batchuntagging?access_token=%s"
+	tagUserListURL       = "https://api.weixin.qq.com/cgi-bin/user/tag/get?access_token=%s"
+	tagUserTagsURL       = "https://api.weixin.qq.com/cgi-bin/tags/getidlist?access_token=%s"
+
+	//batchTaggingLimit 每次批量打标签或取消标签的openid数量上限
+	batchTaggingLimit = 50
+)
+
+//Tag 用户标签
+type Tag struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Count int64  `json:"count,omitempty"` //此标签下粉丝数
+}
+
+type reqTag struct {
+	Tag *Tag `json:"tag"`
+}
+
+type resTag struct {
+	util.CommonError
+
+	Tag *Tag `json:"tag"`
+}
+
+type resTagList struct {
+	util.CommonError
+
+	Tags []*Tag `json:"tags"`
+}
+
+type reqBatchTagging struct {
+	OpenIDList []string `json:"openid_list"`
+	TagID      int64    `json:"tagid"`
+}
+
+//CreateTag 创建标签，标签名长度不超过30个字符
+func (user *User) CreateTag(name string) (tag *Tag, err error) {
+	var res resTag
+	err = user.postJSON(tagCreateURL, &reqTag{&Tag{Name: name}}, &res, "CreateTag")
+	if err != nil {
+		return
+	}
+	tag = res.Tag
+	return
+}
+
+//GetTags 获取公众号已创建的标签
+func (user *User) GetTags() (tags []*Tag, err error) {
+	var accessToken string
+	accessToken, err = user.GetAccessToken()
+	if err != nil {
+		return
+	}
+	var response []byte
+	response, err = util.HTTPGet(fmt.Sprintf(tagGetURL, accessToken))
+	if err != nil {
+		return
+	}
+	var res resTagList
+	err = util.DecodeWithError(response, &res, "GetTags")
+	if err != nil {
+		return
+	}
+	tags = res.Tags
+	return
+}
+
+//UpdateTag 编辑标签
+func (user *User) UpdateTag(tagID int64, name string) error {
+	var res resTag
+	return user.postJSON(tagUpdateURL, &reqTag{&Tag{ID: tagID, Name: name}}, &res, "UpdateTag")
+}
+
+//DeleteTag 删除标签，粉丝数超过10w的标签需要先取消标签
+func (user *User) DeleteTag(tagID int64) error {
+	var res resTag
+	return user.postJSON(tagDeleteURL, &reqTag{&Tag{ID: tagID}}, &res, "DeleteTag")
+}
+
+//BatchTagging 批量为用户打标签，超过50个openid时自动分批请求
+func (user *User) BatchTagging(tagID int64, openIDs []string) error {
+	return user.batchTagging(tagBatchTaggingURL, tagID, openIDs, "BatchTagging")
+}
+
+//BatchUntagging 批量为用户取消标签，超过50个openid时自动分批请求
+func (user *User) BatchUntagging(tagID int64, openIDs []string) error {
+	return user.batchTagging(tagBatchUntaggingURL, tagID, openIDs, "BatchUntagging")
+}
+
+func (user *User) batchTagging(urlStr string, tagID int64, openIDs []string, apiName string) error {
+	for start := 0; start < len(openIDs); start += batchTaggingLimit {
+		end := start + batchTaggingLimit
+		if end > len(openIDs) {
+			end = len(openIDs)
+		}
+		var res resTag
+		err := user.postJSON(urlStr, &reqBatchTagging{OpenIDList: openIDs[start:end], TagID: tagID}, &res, apiName)
+		if err != nil {
+			return fmt.Errorf("%w , processed=%d , total=%d", err, start, len(openIDs))
+		}
+	}
+	return nil
+}
+
+type reqTagUserList struct {
+	TagID      int64  `json:"tagid"`
+	NextOpenID string `json:"next_openid"`
+}
+
+//TagUserList 标签下的粉丝列表
+type TagUserList struct {
+	util.CommonError
+
+	Count int `json:"count"` //这次获取的粉丝数量
+	Data  struct {
+		OpenIDs []string `json:"openid"`
+	} `json:"data"`
+	NextOpenID string `json:"next_openid"` //拉取列表最后一个用户的openid，为空时表示已拉取完毕
+}
+
+//ListTagUserOpenIDs 获取标签下的粉丝列表，每次最多10000个，nextOpenid 为空时从头开始拉取
+func (user *User) ListTagUserOpenIDs(tagID int64, nextOpenid ...string) (*TagUserList, error) {
+	req := &reqTagUserList{TagID: tagID}
+	if len(nextOpenid) > 0 {
+		req.NextOpenID = nextOpenid[0]
+	}
+	res := new(TagUserList)
+	if err := user.postJSON(tagUserListURL, req, res, "ListTagUserOpenIDs"); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+//ListAllTagUserOpenIDs 返回标签下所有粉丝的OpenID
+func (user *User) ListAllTagUserOpenIDs(tagID int64) ([]string, error) {
+	nextOpenid := ""
+	openids := []string{}
+	for {
+		ul, err := user.ListTagUserOpenIDs(tagID, nextOpenid)
+		if err != nil {
+			return nil, err
+		}
+		openids = append(openids, ul.Data.OpenIDs...)
+		if ul.Count == 0 || ul.NextOpenID == "" {
+			return openids, nil
+		}
+		nextOpenid = ul.NextOpenID
+	}
+}
+
+type resUserTags struct {
+	util.CommonError
+
+	TagIDList []int64 `json:"tagid_list"`
+}
+
+//GetUserTags 获取用户身上的标签列表
+func (user *User) GetUserTags(openID string) (tagIDs []int64, err error) {
+	var res resUserTags
+	err = user.postJSON(tagUserTagsURL, map[string]string{"openid": openID}, &res, "GetUserTags")
+	if err != nil {
+		return
+	}
+	tagIDs = res.TagIDList
+	return
+}
+
+//postJSON 发送 json 请求并按 CommonError 解析返回值
+func (user *User) postJSON(urlStr string, req, res interface{}, apiName string) error {
+	accessToken, err := user.GetAccessToken()
+	if err != nil {
+		return err
+	}
+	response, err := util.PostJSON(fmt.Sprintf(urlStr, accessToken), req)
+	if err != nil {
+		return err
+	}
+	return util.DecodeWithError(response, res, apiName)
+}
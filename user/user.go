@@ -52,6 +52,8 @@ type Info struct {
 
 // OpenidList 用户列表
 type OpenidList struct {
+	util.CommonError
+
 	Total int `json:"total"`
 	Count int `json:"count"`
 	Data  struct {
@@ -125,7 +127,7 @@ func (user *User) ListUserOpenIDs(nextOpenid ...string) (*OpenidList, error) {
 	}
 
 	userlist := new(OpenidList)
-	err = json.Unmarshal(response, userlist)
+	err = util.DecodeWithError(response, userlist, "ListUserOpenIDs")
 	if err != nil {
 		return nil, err
 	}
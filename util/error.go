@@ -2,6 +2,7 @@ package util
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"reflect"
 )
@@ -12,6 +13,32 @@ type CommonError struct {
 	ErrMsg  string `json:"errmsg"`
 }
 
+// APIError 微信接口返回的错误，可通过 ErrCode 区分具体的错误类型
+type APIError struct {
+	APIName string
+	ErrCode int64
+	ErrMsg  string
+}
+
+// Error 实现 error 接口
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s Error , errcode=%d , errmsg=%s", e.APIName, e.ErrCode, e.ErrMsg)
+}
+
+// IsErrCode 判断 err 是否为指定错误码的 APIError，支持被 fmt.Errorf("%w") 包装的错误
+func IsErrCode(err error, codes ...int64) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	for _, code := range codes {
+		if apiErr.ErrCode == code {
+			return true
+		}
+	}
+	return false
+}
+
 // DecodeWithCommonError 将返回值按照CommonError解析
 func DecodeWithCommonError(response []byte, apiName string) (err error) {
 	var commError CommonError
@@ -20,7 +47,7 @@ func DecodeWithCommonError(response []byte, apiName string) (err error) {
 		return
 	}
 	if commError.ErrCode != 0 {
-		return fmt.Errorf("%s Error , errcode=%d , errmsg=%s", apiName, commError.ErrCode, commError.ErrMsg)
+		return &APIError{APIName: apiName, ErrCode: commError.ErrCode, ErrMsg: commError.ErrMsg}
 	}
 	return nil
 }
@@ -45,7 +72,7 @@ func DecodeWithError(response []byte, obj interface{}, apiName string) error {
 		return fmt.Errorf("errcode or errmsg is invalid")
 	}
 	if errCode.Int() != 0 {
-		return fmt.Errorf("%s Error , errcode=%d , errmsg=%s", apiName, errCode.Int(), errMsg.String())
+		return &APIError{APIName: apiName, ErrCode: errCode.Int(), ErrMsg: errMsg.String()}
 	}
 	return nil
 }
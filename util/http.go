@@ -2,19 +2,17 @@ package util
 
 import (
 	"bytes"
-	"crypto/tls"
 	"encoding/json"
-	"encoding/pem"
 	"encoding/xml"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
+	"mime"
 	"mime/multipart"
 	"net/http"
 	"os"
-
-	"golang.org/x/crypto/pkcs12"
+	"path"
+	"path/filepath"
 )
 
 //HTTPGet get 请求
@@ -106,64 +104,185 @@ func PostFile(fieldname, filename, uri string) ([]byte, error) {
 	return PostMultipartForm(fields, uri)
 }
 
+//PostFileFromReader 上传文件，文件内容从 reader 中读取，size 小于0表示长度未知
+func PostFileFromReader(fieldname, filename string, reader io.Reader, size int64, uri string) ([]byte, error) {
+	fields := []MultipartFormField{
+		{
+			IsFile:    true,
+			Fieldname: fieldname,
+			Filename:  filename,
+			Reader:    reader,
+			Size:      size,
+		},
+	}
+	return PostMultipartForm(fields, uri)
+}
+
 //MultipartFormField 保存文件或其他字段信息
 type MultipartFormField struct {
 	IsFile    bool
 	Fieldname string
 	Value     []byte
 	Filename  string
+	Reader    io.Reader //文件内容，为空时打开 Filename 指定的文件
+	Size      int64     //Reader 的长度，小于0表示长度未知，此时先写入临时文件以得到长度
 }
 
-//PostMultipartForm 上传文件或其他多个字段
+//PostMultipartForm 上传文件或其他多个字段，文件内容边读边发送，不会整个读入内存
 func PostMultipartForm(fields []MultipartFormField, uri string) (respBody []byte, err error) {
-	bodyBuf := &bytes.Buffer{}
-	bodyWriter := multipart.NewWriter(bodyBuf)
+	body, contentLength, contentType, closeFiles, err := newMultipartBody(fields)
+	defer closeFiles()
+	if err != nil {
+		return
+	}
 
+	req, err := http.NewRequest(http.MethodPost, uri, body)
+	if err != nil {
+		return
+	}
+	req.ContentLength = contentLength
+	req.Header.Set("Content-Type", contentType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	//对象存储上传成功时返回 204
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return nil, fmt.Errorf("http code error : uri=%v , statusCode=%v", uri, resp.StatusCode)
+	}
+	respBody, err = ioutil.ReadAll(resp.Body)
+	return
+}
+
+//newMultipartBody 将各字段的头部和文件内容依次拼接成一个 reader，同时返回请求体的总长度
+//
+//微信接口不接受 chunked 方式上传（返回 41005），长度未知的文件内容会先写入临时文件
+func newMultipartBody(fields []MultipartFormField) (body io.Reader, contentLength int64, contentType string, closeFiles func(), err error) {
+	var files, tempFiles []*os.File
+	closeFiles = func() {
+		for _, fh := range files {
+			fh.Close()
+		}
+		for _, fh := range tempFiles {
+			fh.Close()
+			os.Remove(fh.Name())
+		}
+	}
+
+	//multipart.Writer 直接写入 buf，每个文件字段的头部写完后取出作为一段，文件内容作为下一段
+	buf := &bytes.Buffer{}
+	bodyWriter := multipart.NewWriter(buf)
+	var readers []io.Reader
 	for _, field := range fields {
-		if field.IsFile {
-			fileWriter, e := bodyWriter.CreateFormFile(field.Fieldname, field.Filename)
+		if !field.IsFile {
+			partWriter, e := bodyWriter.CreateFormField(field.Fieldname)
 			if e != nil {
-				err = fmt.Errorf("error writing to buffer , err=%v", e)
+				err = e
+				return
+			}
+			if _, err = partWriter.Write(field.Value); err != nil {
 				return
 			}
+			continue
+		}
 
+		reader, size := field.Reader, field.Size
+		if reader == nil {
 			fh, e := os.Open(field.Filename)
 			if e != nil {
 				err = fmt.Errorf("error opening file , err=%v", e)
 				return
 			}
-			defer fh.Close()
-
-			if _, err = io.Copy(fileWriter, fh); err != nil {
-				return
+			files = append(files, fh)
+			size = -1
+			if info, e := fh.Stat(); e == nil {
+				size = info.Size()
 			}
-		} else {
-			partWriter, e := bodyWriter.CreateFormField(field.Fieldname)
+			reader = fh
+		}
+		if size < 0 {
+			fh, e := ioutil.TempFile("", "wechat-upload")
 			if e != nil {
-				err = e
+				err = fmt.Errorf("error creating temp file , err=%v", e)
+				return
+			}
+			tempFiles = append(tempFiles, fh)
+			if size, err = io.Copy(fh, reader); err != nil {
 				return
 			}
-			valueReader := bytes.NewReader(field.Value)
-			if _, err = io.Copy(partWriter, valueReader); err != nil {
+			if _, err = fh.Seek(0, io.SeekStart); err != nil {
 				return
 			}
+			reader = fh
 		}
+		if _, e := bodyWriter.CreateFormFile(field.Fieldname, filepath.Base(field.Filename)); e != nil {
+			err = fmt.Errorf("error writing to buffer , err=%v", e)
+			return
+		}
+		contentLength += int64(buf.Len())
+		readers = append(readers, bytes.NewReader(copyBytes(buf)))
+		buf.Reset()
+		contentLength += size
+		readers = append(readers, io.LimitReader(reader, size))
+	}
+	if err = bodyWriter.Close(); err != nil {
+		return
 	}
+	contentLength += int64(buf.Len())
+	readers = append(readers, bytes.NewReader(copyBytes(buf)))
+	return io.MultiReader(readers...), contentLength, bodyWriter.FormDataContentType(), closeFiles, nil
+}
+
+func copyBytes(buf *bytes.Buffer) []byte {
+	data := make([]byte, buf.Len())
+	copy(data, buf.Bytes())
+	return data
+}
 
-	contentType := bodyWriter.FormDataContentType()
-	bodyWriter.Close()
+//commonExtensions 微信素材常用类型的扩展名，mime.ExtensionsByType 对 image/jpeg 等类型可能返回 .jfif 等微信不支持的扩展名
+var commonExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/bmp":  ".bmp",
+	"audio/mpeg": ".mp3",
+	"audio/amr":  ".amr",
+	"video/mp4":  ".mp4",
+}
 
-	resp, e := http.Post(uri, contentType, bodyBuf)
-	if e != nil {
-		err = e
+//OpenURL 请求 fileURL 并返回响应内容，用于将网络文件直接转发上传
+//
+//filename 取自 Content-Disposition 或 url 路径，没有扩展名时根据 Content-Type 补充；size 为 Content-Length，未知时为-1
+func OpenURL(fileURL string) (body io.ReadCloser, filename string, size int64, err error) {
+	response, err := http.Get(fileURL)
+	if err != nil {
 		return
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return nil, err
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		err = fmt.Errorf("http get error : uri=%v , statusCode=%v", fileURL, response.StatusCode)
+		return
 	}
-	respBody, err = ioutil.ReadAll(resp.Body)
-	return
+
+	if _, params, e := mime.ParseMediaType(response.Header.Get("Content-Disposition")); e == nil {
+		filename = params["filename"]
+	}
+	if filename == "" {
+		filename = path.Base(response.Request.URL.Path)
+	}
+	if filename == "" || filename == "/" || filename == "." {
+		filename = "file"
+	}
+	if path.Ext(filename) == "" {
+		mediaType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+		if ext, ok := commonExtensions[mediaType]; ok {
+			filename += ext
+		} else if exts, e := mime.ExtensionsByType(mediaType); e == nil && len(exts) > 0 {
+			filename += exts[0]
+		}
+	}
+	return response.Body, filename, response.ContentLength, nil
 }
 
 //PostXML perform a HTTP/POST request with XML body
@@ -188,57 +307,37 @@ func PostXML(uri string, obj interface{}) ([]byte, error) {
 
 //httpWithTLS CA证书
 func httpWithTLS(rootCa, key string) (*http.Client, error) {
-	var client *http.Client
-	certData, err := ioutil.ReadFile(rootCa)
+	cert, err := LoadPKCS12File(rootCa, key)
 	if err != nil {
-		return nil, fmt.Errorf("unable to find cert path=%s, error=%v", rootCa, err)
-	}
-	cert := pkcs12ToPem(certData, key)
-	config := &tls.Config{
-		Certificates: []tls.Certificate{cert},
-	}
-	tr := &http.Transport{
-		TLSClientConfig:    config,
-		DisableCompression: true,
+		return nil, err
 	}
-	client = &http.Client{Transport: tr}
-	return client, nil
+	client := NewTLSClient()
+	client.SetCertificate(cert)
+	return client.Client(), nil
 }
 
-//pkcs12ToPem 将Pkcs12转成Pem
-func pkcs12ToPem(p12 []byte, password string) tls.Certificate {
-	blocks, err := pkcs12.ToPEM(p12, password)
-	defer func() {
-		if x := recover(); x != nil {
-			log.Print(x)
-		}
-	}()
-	if err != nil {
-		panic(err)
-	}
-	var pemData []byte
-	for _, b := range blocks {
-		pemData = append(pemData, pem.EncodeToMemory(b)...)
-	}
-	cert, err := tls.X509KeyPair(pemData, pemData)
+//PostXMLWithTLS perform a HTTP/POST request with XML body and TLS
+//
+//每次调用都会重新读取证书，需要多次调用时使用 TLSClient 和 PostXMLWithClient
+func PostXMLWithTLS(uri string, obj interface{}, ca, key string) ([]byte, error) {
+	client, err := httpWithTLS(ca, key)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	return cert
+	return PostXMLWithClient(client, uri, obj)
 }
 
-//PostXMLWithTLS perform a HTTP/POST request with XML body and TLS
-func PostXMLWithTLS(uri string, obj interface{}, ca, key string) ([]byte, error) {
+//PostXMLWithClient 使用指定的 http.Client 发送 xml 请求，client 为 nil 时使用 http.DefaultClient
+func PostXMLWithClient(client *http.Client, uri string, obj interface{}) ([]byte, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
 	xmlData, err := xml.Marshal(obj)
 	if err != nil {
 		return nil, err
 	}
 
 	body := bytes.NewBuffer(xmlData)
-	client, err := httpWithTLS(ca, key)
-	if err != nil {
-		return nil, err
-	}
 	response, err := client.Post(uri, "application/xml;charset=utf-8", body)
 	if err != nil {
 		return nil, err
@@ -250,3 +349,25 @@ func PostXMLWithTLS(uri string, obj interface{}, ca, key string) ([]byte, error)
 	}
 	return ioutil.ReadAll(response.Body)
 }
+
+//PostXMLForStream 使用指定的 http.Client 发送 xml 请求并返回响应，client 为 nil 时使用 http.DefaultClient，
+//用于下载账单等响应体较大的接口，调用方负责关闭 response.Body
+func PostXMLForStream(client *http.Client, uri string, obj interface{}) (*http.Response, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	xmlData, err := xml.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := client.Post(uri, "application/xml;charset=utf-8", bytes.NewReader(xmlData))
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		return nil, fmt.Errorf("http code error : uri=%v , statusCode=%v", uri, response.StatusCode)
+	}
+	return response, nil
+}
@@ -0,0 +1,66 @@
+package util
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPostMultipartFormFromReader(t *testing.T) {
+	var contentLength int64
+	var transferEncoding []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentLength = r.ContentLength
+		transferEncoding = r.TransferEncoding
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Error(err)
+			return
+		}
+		file, header, err := r.FormFile("media")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer file.Close()
+		content, _ := ioutil.ReadAll(file)
+		w.Write([]byte(header.Filename + ":" + string(content) + ":" + r.FormValue("description")))
+	}))
+	defer server.Close()
+
+	for _, size := range []int64{11, -1} {
+		fields := []MultipartFormField{
+			{IsFile: true, Fieldname: "media", Filename: "/tmp/a.jpg", Reader: strings.NewReader("hello world"), Size: size},
+			{Fieldname: "description", Value: []byte("desc")},
+		}
+		body, err := PostMultipartForm(fields, server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != "a.jpg:hello world:desc" {
+			t.Errorf("unexpected response %q", body)
+		}
+		//长度未知时也不能使用 chunked 方式发送
+		if contentLength <= 11 || len(transferEncoding) != 0 {
+			t.Errorf("size %d: expected content length to be set, got %d %v", size, contentLength, transferEncoding)
+		}
+	}
+}
+
+func TestOpenURLFilename(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write([]byte("jpeg"))
+	}))
+	defer server.Close()
+
+	body, filename, size, err := OpenURL(server.URL + "/images/avatar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	if filename != "avatar.jpg" || size != 4 {
+		t.Errorf("unexpected filename=%s size=%d", filename, size)
+	}
+}
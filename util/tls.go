@@ -0,0 +1,93 @@
+package util
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"golang.org/x/crypto/pkcs12"
+)
+
+//LoadPKCS12 解析 PKCS#12 格式的证书，如微信支付的 apiclient_cert.p12，密码错误时返回错误
+func LoadPKCS12(p12 []byte, password string) (tls.Certificate, error) {
+	blocks, err := pkcs12.ToPEM(p12, password)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("decode pkcs12 error : %v", err)
+	}
+	var certPEM, keyPEM []byte
+	for _, b := range blocks {
+		if b.Type == "CERTIFICATE" {
+			certPEM = append(certPEM, pem.EncodeToMemory(b)...)
+		} else {
+			keyPEM = append(keyPEM, pem.EncodeToMemory(b)...)
+		}
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("load pkcs12 key pair error : %v", err)
+	}
+	return cert, nil
+}
+
+//LoadPKCS12File 读取并解析 PKCS#12 格式的证书文件
+func LoadPKCS12File(path, password string) (tls.Certificate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("unable to find cert path=%s, error=%v", path, err)
+	}
+	return LoadPKCS12(data, password)
+}
+
+//TLSClient 使用客户端证书的 http.Client，多次请求复用同一个连接池，
+//证书可以通过 SetCertificate 热更新，更新后新建立的连接使用新证书
+type TLSClient struct {
+	mu   sync.RWMutex
+	cert *tls.Certificate
+
+	transport *http.Transport
+	client    *http.Client
+}
+
+//NewTLSClient 创建 TLSClient，设置证书前发起的请求会在握手时失败
+func NewTLSClient() *TLSClient {
+	c := new(TLSClient)
+	c.transport = &http.Transport{
+		Proxy:              http.ProxyFromEnvironment,
+		TLSClientConfig:    &tls.Config{GetClientCertificate: c.getClientCertificate},
+		DisableCompression: true,
+	}
+	c.client = &http.Client{Transport: c.transport}
+	return c
+}
+
+//SetCertificate 设置或更新证书，并关闭使用旧证书的空闲连接
+func (c *TLSClient) SetCertificate(cert tls.Certificate) {
+	c.mu.Lock()
+	c.cert = &cert
+	c.mu.Unlock()
+	c.transport.CloseIdleConnections()
+}
+
+//Certificate 返回当前的证书，没有设置时返回 nil
+func (c *TLSClient) Certificate() *tls.Certificate {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert
+}
+
+//Client 返回使用证书的 http.Client
+func (c *TLSClient) Client() *http.Client {
+	return c.client
+}
+
+func (c *TLSClient) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	cert := c.Certificate()
+	if cert == nil {
+		return nil, errors.New("client certificate is not set")
+	}
+	return cert, nil
+}
@@ -0,0 +1,70 @@
+package util
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestCertificate(t *testing.T, commonName string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestLoadPKCS12Error(t *testing.T) {
+	if _, err := LoadPKCS12([]byte("not a pkcs12 file"), "1900000001"); err == nil {
+		t.Error("expected error for invalid pkcs12 data")
+	}
+}
+
+func TestTLSClientReload(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	client := NewTLSClient()
+	client.transport.TLSClientConfig.RootCAs = x509.NewCertPool()
+	client.transport.TLSClientConfig.RootCAs.AddCert(server.Certificate())
+
+	if _, err := client.Client().Get(server.URL); err == nil {
+		t.Error("expected handshake error without certificate")
+	}
+	for _, name := range []string{"first", "second"} {
+		client.SetCertificate(newTestCertificate(t, name))
+		resp, err := client.Client().Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != name {
+			t.Errorf("expected certificate %s, got %s", name, body)
+		}
+	}
+}
@@ -5,10 +5,14 @@ import (
 	"net/http"
 	"sync"
 
+	"github.com/fintcloud/wechat/broadcast"
 	"github.com/fintcloud/wechat/cache"
 	"github.com/fintcloud/wechat/context"
 	"github.com/fintcloud/wechat/device"
+	"github.com/fintcloud/wechat/draft"
+	"github.com/fintcloud/wechat/freepublish"
 	"github.com/fintcloud/wechat/js"
+	"github.com/fintcloud/wechat/kf"
 	"github.com/fintcloud/wechat/material"
 	"github.com/fintcloud/wechat/menu"
 	"github.com/fintcloud/wechat/message"
@@ -19,6 +23,7 @@ import (
 	"github.com/fintcloud/wechat/server"
 	"github.com/fintcloud/wechat/tcb"
 	"github.com/fintcloud/wechat/user"
+	"github.com/fintcloud/wechat/util"
 )
 
 // Wechat struct
@@ -35,7 +40,12 @@ type Config struct {
 	PayMchID       string //支付 - 商户 ID
 	PayNotifyURL   string //支付 - 接受微信支付结果通知的接口地址
 	PayKey         string //支付 - 商户后台设置的支付 key
-	Cache          cache.Cache
+
+	PayAPIv3Key     string //支付 v3 - 商户后台设置的 APIv3 密钥
+	PayCertSerialNo string //支付 v3 - 商户 API 证书序列号
+	PayPrivateKey   string //支付 v3 - 商户 API 私钥（apiclient_key.pem 的内容）
+
+	Cache cache.Cache
 }
 
 // NewWechat init
@@ -53,9 +63,13 @@ func copyConfigToContext(cfg *Config, context *context.Context) {
 	context.PayMchID = cfg.PayMchID
 	context.PayKey = cfg.PayKey
 	context.PayNotifyURL = cfg.PayNotifyURL
+	context.PayAPIv3Key = cfg.PayAPIv3Key
+	context.PayCertSerialNo = cfg.PayCertSerialNo
+	context.PayPrivateKey = cfg.PayPrivateKey
 	context.Cache = cfg.Cache
 	context.SetAccessTokenLock(new(sync.RWMutex))
 	context.SetJsAPITicketLock(new(sync.RWMutex))
+	context.SetPayTLSClient(util.NewTLSClient())
 }
 
 // GetServer 消息管理
@@ -100,6 +114,31 @@ func (wc *Wechat) GetTemplate() *message.Template {
 	return message.NewTemplate(wc.Context)
 }
 
+// GetKf 客服管理接口
+func (wc *Wechat) GetKf() *kf.Kf {
+	return kf.NewKf(wc.Context)
+}
+
+// GetSubscribeMsg 订阅通知接口
+func (wc *Wechat) GetSubscribeMsg() *message.SubscribeMsg {
+	return message.NewSubscribeMsg(wc.Context)
+}
+
+// GetBroadcast 群发消息接口
+func (wc *Wechat) GetBroadcast() *broadcast.Broadcast {
+	return broadcast.NewBroadcast(wc.Context)
+}
+
+// GetDraft 草稿箱接口
+func (wc *Wechat) GetDraft() *draft.Draft {
+	return draft.NewDraft(wc.Context)
+}
+
+// GetFreePublish 发布能力接口
+func (wc *Wechat) GetFreePublish() *freepublish.FreePublish {
+	return freepublish.NewFreePublish(wc.Context)
+}
+
 // GetPay 返回支付消息的实例
 func (wc *Wechat) GetPay() *pay.Pay {
 	return pay.NewPay(wc.Context)